@@ -0,0 +1,310 @@
+package boolexpr
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// evalOperand evaluates a side of a comparison. An int combined with an int
+// stays an int, so results are exact; combined with a float64 it is promoted
+// to float64, as in comparisons. "+" also concatenates strings. Arithmetic
+// on null is null.
+func evalOperand(o *Operand, syms Symbols) (evalVal, error) {
+	// Most operands are a single value; this stays small enough to inline.
+	if v := o.Value(); v != nil {
+		return evalValue(v, syms)
+	}
+
+	return evalSum(o, syms)
+}
+
+func evalSum(o *Operand, syms Symbols) (evalVal, error) {
+	l, err := evalTerm(&o.Term, syms)
+	if err != nil {
+		return evalVal{}, err
+	}
+
+	for i := range o.Ops {
+		r, err := evalTerm(&o.Ops[i].Term, syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		if l, err = arithEval(o.Ops[i].Op, l, r); err != nil {
+			return evalVal{}, err
+		}
+	}
+
+	traced(syms, o, l)
+	return l, nil
+}
+
+func evalTerm(t *Term, syms Symbols) (evalVal, error) {
+	l, err := evalFactor(&t.Factor, syms)
+	if err != nil {
+		return evalVal{}, err
+	}
+
+	for i := range t.Ops {
+		r, err := evalFactor(&t.Ops[i].Factor, syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		if l, err = arithEval(t.Ops[i].Op, l, r); err != nil {
+			return evalVal{}, err
+		}
+	}
+
+	return l, nil
+}
+
+func evalFactor(f *Factor, syms Symbols) (evalVal, error) {
+	switch {
+	case f.Value != nil:
+		return evalValue(f.Value, syms)
+	case f.Group != nil:
+		return evalOperand(f.Group, syms)
+	case f.Neg != nil:
+		v, err := evalFactor(f.Neg, syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		return negEval(v)
+	default:
+		return evalVal{}, ErrValueDoesntHaveAnyVal
+	}
+}
+
+// arithEval applies the binary arithmetic operator op to l and r.
+func arithEval(op string, l, r evalVal) (evalVal, error) {
+	if li, ok := l.toInt(); ok {
+		if ri, ok := r.toInt(); ok {
+			i, err := intArith(op, li, ri)
+			if err != nil {
+				return evalVal{}, err
+			}
+
+			return evalVal{kind: kindInt, i: i}, nil
+		}
+	}
+
+	if lf, ok := l.toFloat(); ok {
+		if rf, ok := r.toFloat(); ok {
+			f, err := floatArith(op, lf, rf)
+			if err != nil {
+				return evalVal{}, err
+			}
+
+			return evalVal{kind: kindFloat64, f: f}, nil
+		}
+	}
+
+	if op == "+" {
+		if ls, ok := l.toString(); ok {
+			if rs, ok := r.toString(); ok {
+				return evalVal{kind: kindString, s: ls + rs}, nil
+			}
+		}
+	}
+
+	if res, ok, err := timeArith(op, l, r); ok {
+		return res, err
+	}
+
+	if l.isNull() || r.isNull() {
+		return evalVal{kind: kindAny}, nil
+	}
+
+	return evalVal{}, newErrorDataTypeMismatch(op, l.toAny(), r.toAny())
+}
+
+// timeArith applies op to times and durations: a duration moves a time, two
+// times are apart by a duration, durations add up and scale by ints. It
+// reports false when op is not defined for the kinds of l and r.
+func timeArith(op string, l, r evalVal) (evalVal, bool, error) {
+	lt, lTime := l.toTime()
+	rt, rTime := r.toTime()
+	ld, lDur := l.toDuration()
+	rd, rDur := r.toDuration()
+	li, lInt := l.toInt()
+	ri, rInt := r.toInt()
+
+	var (
+		kind evalKind
+		a, b int
+	)
+
+	switch {
+	case lTime && rDur && (op == "+" || op == "-"):
+		kind, a, b = kindTime, 0, int(rd)
+	case lDur && rTime && op == "+":
+		kind, a, b = kindTime, int(ld), 0
+	case lTime && rTime && op == "-":
+		kind, a, b = kindDuration, 0, 0
+	case lDur && rDur && (op == "+" || op == "-"):
+		kind, a, b = kindDuration, int(ld), int(rd)
+	case lDur && rInt && (op == "*" || op == "/"):
+		kind, a, b = kindDuration, int(ld), ri
+	case lInt && rDur && op == "*":
+		kind, a, b = kindDuration, li, int(rd)
+	default:
+		return evalVal{}, false, nil
+	}
+
+	// Times are added as nanoseconds since 1970, so results out of the
+	// range of a time overflow as ints do.
+	var err error
+	if lTime {
+		if a, err = unixNano(lt); err != nil {
+			return evalVal{}, true, err
+		}
+	}
+	if rTime {
+		if b, err = unixNano(rt); err != nil {
+			return evalVal{}, true, err
+		}
+	}
+
+	res, err := intArith(op, a, b)
+	if err != nil {
+		return evalVal{}, true, err
+	}
+
+	return evalVal{kind: kind, i: res}, true, nil
+}
+
+// unixNano returns t as nanoseconds since 1970, or an error wrapping
+// [ErrOverflow] when it doesn't fit an int.
+func unixNano(t time.Time) (int, error) {
+	v, err := timeVal(t)
+	return v.i, err
+}
+
+func intArith(op string, l, r int) (int, error) {
+	var (
+		res      int
+		overflow bool
+	)
+
+	switch op {
+	case "+":
+		res = l + r
+		overflow = (l^res)&(r^res) < 0
+	case "-":
+		res = l - r
+		overflow = (l^r)&(l^res) < 0
+	case "*":
+		res = l * r
+		overflow = l != 0 && (res/l != r || l == -1 && r == math.MinInt)
+	case "/", "%":
+		if r == 0 {
+			return 0, fmt.Errorf("%w, %d %s %d", ErrDivisionByZero, l, op, r)
+		}
+
+		if op == "%" {
+			return l % r, nil
+		}
+
+		res = l / r
+		overflow = l == math.MinInt && r == -1
+	default:
+		return 0, fmt.Errorf("%w, %s", ErrOpDoesnotHaveVal, op)
+	}
+
+	if overflow {
+		return 0, fmt.Errorf("%w, %d %s %d", ErrOverflow, l, op, r)
+	}
+
+	return res, nil
+}
+
+func floatArith(op string, l, r float64) (float64, error) {
+	var res float64
+	switch op {
+	case "+":
+		res = l + r
+	case "-":
+		res = l - r
+	case "*":
+		res = l * r
+	case "/", "%":
+		if r == 0 {
+			return 0, fmt.Errorf("%w, %v %s %v", ErrDivisionByZero, l, op, r)
+		}
+
+		if op == "%" {
+			return math.Mod(l, r), nil
+		}
+
+		res = l / r
+	default:
+		return 0, fmt.Errorf("%w, %s", ErrOpDoesnotHaveVal, op)
+	}
+
+	if math.IsInf(res, 0) && !math.IsInf(l, 0) && !math.IsInf(r, 0) {
+		return 0, fmt.Errorf("%w, %v %s %v", ErrOverflow, l, op, r)
+	}
+
+	return res, nil
+}
+
+// negEval negates a number or a duration; the negation of the least int or
+// duration overflows.
+func negEval(v evalVal) (evalVal, error) {
+	if i, ok := v.toInt(); ok {
+		if i == math.MinInt {
+			return evalVal{}, fmt.Errorf("%w, -(%d)", ErrOverflow, i)
+		}
+
+		return evalVal{kind: kindInt, i: -i}, nil
+	}
+
+	if f, ok := v.toFloat(); ok {
+		return evalVal{kind: kindFloat64, f: -f}, nil
+	}
+
+	if d, ok := v.toDuration(); ok {
+		if d == math.MinInt64 {
+			return evalVal{}, fmt.Errorf("%w, -(%v)", ErrOverflow, d)
+		}
+
+		return evalVal{kind: kindDuration, i: int(-d)}, nil
+	}
+
+	if v.isNull() {
+		return v, nil
+	}
+
+	return evalVal{}, newErrorWrongDataType("-", v.toAny())
+}
+
+// walkOperand calls fn on each value of o, in source order.
+func walkOperand(o *Operand, fn func(*Value)) {
+	walkTerm(&o.Term, fn)
+	for i := range o.Ops {
+		walkTerm(&o.Ops[i].Term, fn)
+	}
+}
+
+func walkTerm(t *Term, fn func(*Value)) {
+	walkFactor(&t.Factor, fn)
+	for i := range t.Ops {
+		walkFactor(&t.Ops[i].Factor, fn)
+	}
+}
+
+func walkFactor(f *Factor, fn func(*Value)) {
+	switch {
+	case f.Value != nil:
+		fn(f.Value)
+	case f.Group != nil:
+		walkOperand(f.Group, fn)
+	case f.Neg != nil:
+		walkFactor(f.Neg, fn)
+	}
+}
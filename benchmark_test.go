@@ -2,6 +2,7 @@ package boolexpr
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -45,6 +46,7 @@ var parseCases = []struct {
 	{"Deep", `(((a = 1 and b = 2) or c = 3) and (d = 4 or e = 5)) and f = 6`},
 	{"Operators", `name contains "go" and tag excludes "x" and s starts_with "a" and e ends_with "z"`},
 	{"Match", `email match ".+@example\\.com$"`},
+	{"Nested", strings.Repeat("(", 100) + "x = 1" + strings.Repeat(")", 100)},
 }
 
 func BenchmarkParse(b *testing.B) {
@@ -63,6 +65,30 @@ func BenchmarkParse(b *testing.B) {
 	}
 }
 
+// parseErrorCases are invalid expressions whose errors take the most
+// re-parsing to locate, which is bounded however long or deeply nested they
+// are.
+var parseErrorCases = []struct {
+	name string
+	expr string
+}{
+	{"Short", `x = 1 and`},
+	{"Unclosed", strings.Repeat("(", 14) + "x = 1" + strings.Repeat(")", 13)},
+	{"Nested", strings.Repeat("(a = 1 and ", 50) + "x = 1" + strings.Repeat(")", 49)},
+	{"Long", strings.Repeat("a = 1 and ", 50) + "x ="},
+}
+
+func BenchmarkParseError(b *testing.B) {
+	for _, tc := range parseErrorCases {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchExpr, benchErr = Parse(tc.expr)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Evaluation of a pre-parsed expression (the hot path for reused expressions)
 // ---------------------------------------------------------------------------
@@ -88,8 +114,19 @@ var evalCases = []struct {
 	{"StartsWith", `s starts_with "he"`, SymbolsMap{"s": "hello"}},
 	{"EndsWith", `s ends_with "lo"`, SymbolsMap{"s": "hello"}},
 	{"Match", `s match "h.*o"`, SymbolsMap{"s": "hello"}},
+	{"IContainsString", `s icontains "ELL"`, SymbolsMap{"s": "hello"}},
+	{"IContainsSlice", `tags icontains "GO"`, SymbolsMap{"tags": []string{"c", "go", "rust"}}},
+	{"IStartsWith", `s istarts_with "HE"`, SymbolsMap{"s": "hello"}},
+	{"EqualFold", `s equals_fold "HELLO"`, SymbolsMap{"s": "hello"}},
+	{"IMatch", `s imatch "H.*O"`, SymbolsMap{"s": "hello"}},
+	{"Like", `s like "h%l_o"`, SymbolsMap{"s": "hello"}},
+	{"Glob", `s glob "h*[a-z]o"`, SymbolsMap{"s": "hello"}},
+	{"InList", `s in ("a", "b", "c", "d", "e", "f", "g", "hello")`, SymbolsMap{"s": "hello"}},
+	{"InListSymbols", `s in ("a", "b", "c", "d", "e", "f", "g", t)`, SymbolsMap{"s": "hello", "t": "hello"}},
 	{"FuncSymbol", `x = 1`, SymbolsMap{"x": func() int { return 1 }}},
 	{"FuncSymbolErr", `x = 1`, SymbolsMap{"x": func() (int, error) { return 1, nil }}},
+	{"Arithmetic", `price * quantity - discount > 100`, SymbolsMap{"price": 12.5, "quantity": 10, "discount": 5}},
+	{"Functions", `len(tags) > 2 and abs(x - 10) < 5 and round(score) = 4`, SymbolsMap{"tags": []string{"c", "go", "rust"}, "x": 8, "score": 3.7}},
 }
 
 func BenchmarkEval(b *testing.B) {
@@ -113,6 +150,40 @@ func BenchmarkEval(b *testing.B) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Evaluation of a compiled Program, on the same cases as BenchmarkEval
+// ---------------------------------------------------------------------------
+
+// BenchmarkCompiled runs evalCases through Compile, to compare with
+// BenchmarkEval:
+//
+//	go test -run=^$ -bench='BenchmarkEval$|BenchmarkCompiled$' -benchmem
+func BenchmarkCompiled(b *testing.B) {
+	for _, tc := range evalCases {
+		ast, err := Parse(tc.expr)
+		if err != nil {
+			b.Fatalf("parse %q: %v", tc.expr, err)
+		}
+
+		p, err := Compile(ast)
+		if err != nil {
+			b.Fatalf("compile %q: %v", tc.expr, err)
+		}
+
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var (
+				res bool
+				e   error
+			)
+			for i := 0; i < b.N; i++ {
+				res, e = p.Eval(tc.syms)
+			}
+			benchBool, benchErr = res, e
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // End-to-end: parse + evaluate together (the Eval convenience path)
 // ---------------------------------------------------------------------------
@@ -170,6 +241,25 @@ func BenchmarkSymbols(b *testing.B) {
 	})
 }
 
+// BenchmarkStructSymbols reads the same values as BenchmarkSymbols from struct
+// fields, showing the cost of reflection once the type's fields are cached.
+func BenchmarkStructSymbols(b *testing.B) {
+	ast, err := Parse(`a = 1 and b = 2 and c = 3 and d = 4`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	syms, err := NewStructSymbols(&struct{ A, B, C, D int }{1, 2, 3, 4})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchBool, benchErr = EvalExpression(ast, syms)
+	}
+}
+
 // BenchmarkSymbolsConcurrent exercises CachedMap under concurrent access,
 // the scenario it is designed for.
 func BenchmarkSymbolsConcurrent(b *testing.B) {
@@ -254,6 +344,28 @@ func BenchmarkEvalScaling(b *testing.B) {
 	}
 }
 
+func BenchmarkCompiledScaling(b *testing.B) {
+	for _, n := range []int{1, 4, 16, 64} {
+		expr, syms := buildConjunction(n)
+		ast, err := Parse(expr)
+		if err != nil {
+			b.Fatalf("parse n=%d: %v", n, err)
+		}
+
+		p, err := Compile(ast)
+		if err != nil {
+			b.Fatalf("compile n=%d: %v", n, err)
+		}
+
+		b.Run(fmt.Sprintf("Clauses=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchBool, benchErr = p.Eval(syms)
+			}
+		})
+	}
+}
+
 // buildConjunction creates an expression of n "vK = K" clauses joined by "and",
 // all true, so evaluation must visit every clause (no short-circuit).
 func buildConjunction(n int) (string, SymbolsMap) {
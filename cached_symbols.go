@@ -1,13 +1,19 @@
 package boolexpr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 )
 
 // CachedSymbols wraps a Symbols implementation, caching the results of Get calls
 // and tracking which symbols were accessed. Each key is looked up at most once from the
-// underlying Symbols implementation. Uses per-entry sync.Once for optimal concurrency.
+// underlying Symbols implementation. Uses a lock per entry for optimal concurrency.
+//
+// When the underlying implementation is a [BatchSymbols], [CachedSymbols.GetMany]
+// and [CachedSymbols.GetManyContext] look up the keys they are given in a
+// single call.
 type CachedSymbols struct {
 	underlying Symbols
 	mu         sync.Mutex
@@ -30,6 +36,14 @@ func NewCachedSymbols(symbols Symbols) *CachedSymbols {
 // Each key is looked up at most once from the underlying implementation, and the value
 // is resolved using resolveSymbol to handle function values.
 func (s *CachedSymbols) Get(key string) (any, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is Get under ctx: the underlying Symbols is asked with its
+// GetContext when it is a [ContextSymbols], and ctx is passed to a function
+// value that takes one. An error because ctx was done is not cached: the next
+// lookup of the key looks it up again.
+func (s *CachedSymbols) GetContext(ctx context.Context, key string) (any, error) {
 	// Get or create the entry for this key
 	s.mu.Lock()
 	entry, exists := s.entries[key]
@@ -39,37 +53,120 @@ func (s *CachedSymbols) Get(key string) (any, error) {
 	}
 	s.mu.Unlock()
 
-	// Use sync.Once to ensure we only fetch and resolve once
-	entry.once.Do(func() {
+	v, err := s.load(ctx, key, entry)
+	if err == nil {
+		entry.used.Store(true)
+	}
+
+	return v, err
+}
+
+// fetch caches the value of key ahead of its use, as prefetching does,
+// without marking it as used.
+func (s *CachedSymbols) fetch(ctx context.Context, key string) {
+	s.mu.Lock()
+	entry, exists := s.entries[key]
+	if !exists {
+		entry = &symbolEntry{}
+		s.entries[key] = entry
+	}
+	s.mu.Unlock()
+
+	_, _ = s.load(ctx, key, entry)
+}
+
+// GetMany returns the values of the given keys, caching them like Get. The
+// keys not looked up yet are looked up in a single call to GetMany when the
+// underlying Symbols is a [BatchSymbols], and one by one otherwise. Missing
+// keys are absent from the result; the first other error is returned along
+// with the values found.
+func (s *CachedSymbols) GetMany(keys []string) (map[string]any, error) {
+	return s.getMany(context.Background(), keys, true)
+}
+
+// GetManyContext is GetMany under ctx: the batch is looked up with
+// GetManyContext when the underlying Symbols is a [BatchContextSymbols], and
+// the keys one by one with GetContext otherwise. As with GetContext, an error
+// because ctx was done is not cached.
+func (s *CachedSymbols) GetManyContext(ctx context.Context, keys []string) (map[string]any, error) {
+	return s.getMany(ctx, keys, true)
+}
+
+// getMany is GetMany under ctx, marking the keys found as used when used is
+// set; prefetching leaves them to be marked when evaluation reads them.
+func (s *CachedSymbols) getMany(ctx context.Context, keys []string, used bool) (map[string]any, error) {
+	batchSyms, isBatch := s.underlying.(BatchSymbols)
+
+	// The entries created here are filled by one batch, looked up by the
+	// first of them to be loaded.
+	var batch *symbolBatch
+	entries := make([]*symbolEntry, len(keys))
+
+	s.mu.Lock()
+	for i, key := range keys {
+		entry, exists := s.entries[key]
+		if !exists {
+			entry = &symbolEntry{}
+			if isBatch {
+				if batch == nil {
+					batch = &symbolBatch{syms: batchSyms}
+				}
+				batch.keys = append(batch.keys, key)
+				entry.batch = batch
+			}
+			s.entries[key] = entry
+		}
+		entries[i] = entry
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	result := make(map[string]any, len(keys))
+	for i, key := range keys {
+		v, err := s.load(ctx, key, entries[i])
+		switch {
+		case err == nil:
+			result[key] = v
+			if used {
+				entries[i].used.Store(true)
+			}
+		case firstErr == nil && !errors.Is(err, ErrSymbolNotFound):
+			firstErr = err
+		}
+	}
+
+	return result, firstErr
+}
+
+// load fetches and resolves the value of entry, the entry of key, once.
+func (s *CachedSymbols) load(ctx context.Context, key string, entry *symbolEntry) (any, error) {
+	return entry.load(ctx, func() (val any, err error) {
 		defer func() {
 			if r := recover(); r != nil {
-				entry.err = fmt.Errorf("symbol: %s panicked: %v", key, r)
+				val, err = nil, fmt.Errorf("symbol: %s panicked: %v", key, r)
 			}
 		}()
 
-		// Fetch from underlying Symbols
-		rawValue, err := s.underlying.Get(key)
+		// Fetch from underlying Symbols, or the batch the entry is part of
+		var rawValue any
+		if entry.batch != nil {
+			rawValue, err = entry.batch.get(ctx, key)
+		} else {
+			rawValue, err = getContext(ctx, s.underlying, key)
+		}
 		if err != nil {
-			entry.err = err
-			return
+			return nil, err
 		}
 
 		// Resolve the symbol (handles functions, etc.)
-		resolved, resolveErr := resolveSymbol(rawValue)
-		if resolveErr != nil {
-			entry.err = resolveErr
-			return
-		}
-
-		entry.val = resolved
-		entry.used.Store(true)
+		return resolveSymbol(ctx, rawValue)
 	})
-
-	return entry.val, entry.err
 }
 
-// Used returns a map of all symbols that were successfully accessed via Get.
-// Symbols that resulted in errors are not included. This matches the behavior of CachedMap.
+// Used returns a map of all symbols that were successfully accessed via Get,
+// GetContext or GetMany. Symbols that resulted in errors are not included, nor
+// are those [WithPrefetch] looked up but evaluation never read. This matches
+// the behavior of CachedMap.
 func (s *CachedSymbols) Used() map[string]any {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -83,3 +180,40 @@ func (s *CachedSymbols) Used() map[string]any {
 
 	return result
 }
+
+// symbolBatch is a lookup of several keys in one call to GetMany. Its entry
+// holds the map of their values.
+type symbolBatch struct {
+	entry symbolEntry
+	syms  BatchSymbols
+	keys  []string
+}
+
+// get returns the value of key, looking up the whole batch under ctx on the
+// first call.
+func (b *symbolBatch) get(ctx context.Context, key string) (any, error) {
+	vals, err := b.entry.load(ctx, func() (vals any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				vals, err = nil, fmt.Errorf("symbols: %v panicked: %v", b.keys, r)
+			}
+		}()
+
+		m, err := getManyContext(ctx, b.syms, b.keys)
+		if err != nil {
+			return nil, err
+		}
+
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := vals.(map[string]any)[key]
+	if !ok {
+		return nil, fmt.Errorf("symbol: %s, %w", key, ErrSymbolNotFound)
+	}
+
+	return v, nil
+}
@@ -1,6 +1,7 @@
 package boolexpr
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"sync/atomic"
@@ -385,3 +386,130 @@ func TestCachedSymbols_Integration(t *testing.T) {
 		assert.Equal(t, "Alice", used["name"])
 	})
 }
+
+// batchSymbols is a test implementation of BatchSymbols that records the
+// names of each GetMany call, and fails Get.
+type batchSymbols struct {
+	data    map[string]any
+	err     error
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (b *batchSymbols) Get(key string) (any, error) {
+	return nil, errors.New("Get called on batchSymbols")
+}
+
+func (b *batchSymbols) GetMany(names []string) (map[string]any, error) {
+	b.mu.Lock()
+	b.batches = append(b.batches, names)
+	b.mu.Unlock()
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	vals := make(map[string]any, len(names))
+	for _, name := range names {
+		if v, ok := b.data[name]; ok {
+			vals[name] = v
+		}
+	}
+
+	return vals, nil
+}
+
+// contextBatchSymbols is a batchSymbols whose GetManyContext gives up when
+// ctx is done.
+type contextBatchSymbols struct {
+	batchSymbols
+}
+
+func (b *contextBatchSymbols) GetManyContext(ctx context.Context, names []string) (map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return b.GetMany(names)
+}
+
+func TestCachedSymbols_GetMany(t *testing.T) {
+	t.Run("looks up a BatchSymbols in one call", func(t *testing.T) {
+		var _ BatchSymbols = NewCachedSymbols(nil)
+		underlying := &batchSymbols{data: map[string]any{
+			"a": 1,
+			"b": func() string { return "x" },
+			"c": 3,
+		}}
+		wrapper := NewCachedSymbols(underlying)
+
+		vals, err := wrapper.GetMany([]string{"a", "b", "missing"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"a": 1, "b": "x"}, vals)
+		assert.Equal(t, [][]string{{"a", "b", "missing"}}, underlying.batches)
+
+		a, err := wrapper.Get("a")
+		require.NoError(t, err)
+		assert.Equal(t, 1, a)
+
+		_, err = wrapper.Get("missing")
+		assert.ErrorIs(t, err, ErrSymbolNotFound)
+
+		vals, err = wrapper.GetMany([]string{"a", "c"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"a": 1, "c": 3}, vals)
+		assert.Equal(t, [][]string{{"a", "b", "missing"}, {"c"}}, underlying.batches)
+
+		assert.Equal(t, map[string]any{"a": 1, "b": "x", "c": 3}, wrapper.Used())
+	})
+
+	t.Run("looks up a BatchContextSymbols under ctx", func(t *testing.T) {
+		var _ BatchContextSymbols = NewCachedSymbols(nil)
+		underlying := &contextBatchSymbols{batchSymbols{data: map[string]any{"a": 1, "b": 2}}}
+		wrapper := NewCachedSymbols(underlying)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := wrapper.GetManyContext(ctx, []string{"a", "b"})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, underlying.batches)
+
+		// The canceled lookup is not cached.
+		vals, err := wrapper.GetManyContext(context.Background(), []string{"a", "b"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"a": 1, "b": 2}, vals)
+		assert.Equal(t, [][]string{{"a", "b"}}, underlying.batches)
+
+		b, err := wrapper.Get("b")
+		require.NoError(t, err)
+		assert.Equal(t, 2, b)
+		assert.Len(t, underlying.batches, 1)
+	})
+
+	t.Run("fails every symbol of a failed batch", func(t *testing.T) {
+		fail := errors.New("unavailable")
+		wrapper := NewCachedSymbols(&batchSymbols{err: fail})
+
+		vals, err := wrapper.GetMany([]string{"a", "b"})
+		assert.ErrorIs(t, err, fail)
+		assert.Empty(t, vals)
+
+		_, err = wrapper.Get("b")
+		assert.ErrorIs(t, err, fail)
+		assert.Empty(t, wrapper.Used())
+	})
+
+	t.Run("looks up other Symbols one by one", func(t *testing.T) {
+		underlying := newMockSymbols(map[string]any{"a": 1, "b": 2})
+		wrapper := NewCachedSymbols(underlying)
+
+		vals, err := wrapper.GetMany([]string{"a", "b", "a"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"a": 1, "b": 2}, vals)
+		assert.Equal(t, int32(1), underlying.getCount("a"))
+		assert.Equal(t, int32(1), underlying.getCount("b"))
+
+		_, err = wrapper.GetMany([]string{"c"})
+		assert.EqualError(t, err, "symbol not found")
+	})
+}
@@ -0,0 +1,441 @@
+package boolexpr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// Kind is the declared type of a symbol in a [Schema]. The kinds mirror the
+// values [resolveSymbol] can produce.
+type Kind uint8
+
+const (
+	KindBool Kind = iota + 1
+	KindInt
+	KindFloat
+	KindString
+	KindStringSlice
+	KindIntSlice
+	KindFloatSlice
+	KindBoolSlice
+	// KindAny declares a symbol whose type is only known at evaluation time,
+	// such as one resolved from a func() any. It is never reported.
+	KindAny
+	KindTime
+	KindDuration
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindBool:
+		return "bool"
+	case KindInt:
+		return "int"
+	case KindFloat:
+		return "float64"
+	case KindString:
+		return "string"
+	case KindStringSlice:
+		return "[]string"
+	case KindIntSlice:
+		return "[]int"
+	case KindFloatSlice:
+		return "[]float64"
+	case KindBoolSlice:
+		return "[]bool"
+	case KindAny:
+		return "any"
+	case KindTime:
+		return "time.Time"
+	case KindDuration:
+		return "time.Duration"
+	default:
+		return "unknown"
+	}
+}
+
+func (k Kind) numeric() bool { return k == KindInt || k == KindFloat }
+
+// Schema declares the kind of every symbol an expression may reference. A
+// symbol with a path is declared by its full path, such as items[0].sku. It is
+// used by [Check] to find type errors before an expression is evaluated.
+type Schema map[string]Kind
+
+// CheckError is a single problem found by [Check], located by the source span
+// of the node it concerns: the symbol for an unknown symbol, the comparison or
+// the function call for a type mismatch. The cause is wrapped, so errors.Is matches
+// [ErrSymbolNotFound], [ErrorWrongDataType] or [ErrOpDoesnotHaveVal] just as
+// it would for the same problem found during evaluation.
+type CheckError struct {
+	Start Position
+	End   Position
+	Err   error
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("%d:%d: %v", e.Start.Line, e.Start.Column, e.Err)
+}
+
+func (e *CheckError) Unwrap() error { return e.Err }
+
+// CheckErrors is the error returned by [Check]: every problem found, in the
+// order the tree was walked. errors.Is and errors.As see through it to each
+// [*CheckError].
+type CheckErrors []*CheckError
+
+func (e CheckErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (e CheckErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// Check verifies exp against schema without evaluating it. Unlike evaluation,
+// which only reports the first error on a branch it actually reaches, Check
+// walks every branch and reports every symbol missing from schema and every
+// operator or function applied to operands of the wrong kinds, as
+// [CheckErrors]. It returns nil when exp is well typed.
+//
+// A comparison involving an unknown or [KindAny] symbol is not type checked.
+func Check(exp Expression, schema Schema) error {
+	if exp.e == nil {
+		return errors.New("Check called on zero-value Expression; use Parse to obtain a valid Expression")
+	}
+
+	c := checker{schema: schema}
+	c.boolExpr(exp.e)
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+
+	return nil
+}
+
+type checker struct {
+	schema Schema
+	// static checks an expression as it is parsed, with no schema: symbols
+	// are of unknown kind and are not reported.
+	static bool
+	errs   CheckErrors
+}
+
+// span is the source span of the node type errors of an operand are reported
+// on.
+type span struct{ start, end lexer.Position }
+
+func (c *checker) report(start, end lexer.Position, err error) {
+	c.errs = append(c.errs, &CheckError{Start: newPosition(start), End: newPosition(end), Err: err})
+}
+
+func (c *checker) boolExpr(b *BoolExpr) {
+	c.andExpr(&b.And)
+	for i := range b.OrOps {
+		c.andExpr(&b.OrOps[i].And)
+	}
+}
+
+func (c *checker) andExpr(a *AndExpr) {
+	c.expr(a.Expr)
+	for _, op := range a.AndOps {
+		c.expr(op.Expr)
+	}
+}
+
+func (c *checker) expr(x Expr) {
+	switch e := x.(type) {
+	case *Compare:
+		c.compare(e)
+	case *NullTest:
+		// A symbol tested for its presence need not be declared.
+		if !e.Exists {
+			c.operand(span{e.Pos, e.EndPos}, &e.Operand)
+		}
+	case *BoolValue:
+		k := c.value(&e.Value)
+		if k != 0 && k != KindAny && k != KindBool {
+			c.report(e.Value.Pos, e.Value.EndPos,
+				fmt.Errorf("%w, bare value must be bool, got %s", ErrorWrongDataType, k))
+		}
+	case *SubExpr:
+		c.boolExpr(&e.BoolExpr)
+	case *NotExpr:
+		c.expr(e.Expr)
+	}
+}
+
+// value returns the kind of v, or 0 when it is not known because v is an
+// undeclared symbol, which is reported.
+func (c *checker) value(v *Value) Kind {
+	switch {
+	case v.Bool != nil:
+		return KindBool
+	case v.Float != nil:
+		return KindFloat
+	case v.Int != nil:
+		return KindInt
+	case v.String != nil:
+		return KindString
+	case v.Time != nil:
+		return KindTime
+	case v.Duration != nil:
+		return KindDuration
+	case v.Null:
+		// null compares with a value of any kind.
+		return 0
+	case v.Symbol != nil:
+		if c.static {
+			return 0
+		}
+
+		k, ok := c.schema[v.Name()]
+		if !ok {
+			c.report(v.Pos, v.EndPos, fmt.Errorf("Symbol: %s, %w", v.Name(), ErrSymbolNotFound))
+		}
+
+		return k
+	case v.Call != nil:
+		return c.call(v)
+	default:
+		return 0
+	}
+}
+
+// call returns the kind of the result of the function call v, reporting on v
+// arguments the function does not accept.
+func (c *checker) call(v *Value) Kind {
+	args := make([]Kind, len(v.Call.Args))
+	for i := range v.Call.Args {
+		args[i] = c.operand(span{v.Pos, v.EndPos}, &v.Call.Args[i])
+	}
+
+	f, ok := v.Call.Func.(*function)
+	if !ok {
+		return 0
+	}
+
+	k, err := f.check(args)
+	if err != nil {
+		c.report(v.Pos, v.EndPos, err)
+		return 0
+	}
+
+	return k
+}
+
+func (c *checker) compare(e *Compare) {
+	at := span{e.Pos, e.EndPos}
+	l := c.operand(at, &e.Left)
+
+	if rv := e.Right.Value(); (e.Op.In || e.Op.NotIn) && rv != nil && rv.List != nil {
+		// Every element is visited to report unknown symbols, but a
+		// comparison is reported only once.
+		var mismatch error
+		for i := range rv.List.Values {
+			r := c.value(&rv.List.Values[i])
+			if err := checkOp(ComparisonOp{In: true}, l, r); err != nil && mismatch == nil {
+				mismatch = err
+			}
+		}
+
+		if mismatch != nil {
+			c.report(e.Pos, e.EndPos, mismatch)
+		}
+
+		return
+	}
+
+	r := c.operand(at, &e.Right)
+	if !checked(l, r) {
+		return
+	}
+
+	var err error
+	if e.Op.In || e.Op.NotIn {
+		// A right operand that is not a list: "x in s" is "s contains x".
+		err = checkContains(opName(e.Op), r, l)
+	} else {
+		err = checkOp(e.Op, l, r)
+	}
+
+	if err != nil {
+		c.report(e.Pos, e.EndPos, err)
+	}
+}
+
+// operand returns the kind of an arithmetic operand. Its type errors are
+// reported on at, the comparison or call it belongs to, as evaluation does,
+// and make its kind 0 so that node is not reported too.
+func (c *checker) operand(at span, o *Operand) Kind {
+	if v := o.Value(); v != nil {
+		return c.value(v)
+	}
+
+	l := c.term(at, &o.Term)
+	for i := range o.Ops {
+		l = c.arith(at, o.Ops[i].Op, l, c.term(at, &o.Ops[i].Term))
+	}
+
+	return l
+}
+
+func (c *checker) term(at span, t *Term) Kind {
+	l := c.factor(at, &t.Factor)
+	for i := range t.Ops {
+		l = c.arith(at, t.Ops[i].Op, l, c.factor(at, &t.Ops[i].Factor))
+	}
+
+	return l
+}
+
+func (c *checker) factor(at span, f *Factor) Kind {
+	switch {
+	case f.Value != nil:
+		return c.value(f.Value)
+	case f.Group != nil:
+		return c.operand(at, f.Group)
+	case f.Neg != nil:
+		k := c.factor(at, f.Neg)
+		if checked(k, k) && !k.numeric() && k != KindDuration {
+			c.report(at.start, at.end, newErrorKind("-", k))
+			return 0
+		}
+
+		return k
+	default:
+		return 0
+	}
+}
+
+// arith applies the type rules of arithEval: ints stay ints, a float makes
+// a float, "+" also joins strings, and times and durations combine as
+// timeArith combines them.
+func (c *checker) arith(at span, op string, l, r Kind) Kind {
+	if !checked(l, r) {
+		return 0
+	}
+
+	sum := op == "+" || op == "-"
+	switch {
+	case l == KindInt && r == KindInt:
+		return KindInt
+	case l.numeric() && r.numeric():
+		return KindFloat
+	case op == "+" && l == KindString && r == KindString:
+		return KindString
+	case l == KindTime && r == KindDuration && sum, l == KindDuration && r == KindTime && op == "+":
+		return KindTime
+	case l == KindTime && r == KindTime && op == "-", l == KindDuration && r == KindDuration && sum,
+		l == KindDuration && r == KindInt && (op == "*" || op == "/"), l == KindInt && r == KindDuration && op == "*":
+		return KindDuration
+	}
+
+	c.report(at.start, at.end, newErrorKindMismatch(op, l, r))
+	return 0
+}
+
+// checked reports whether a comparison between kinds l and r is type checked:
+// unknown (0) and KindAny operands are only known at evaluation time.
+func checked(l, r Kind) bool {
+	return l != 0 && r != 0 && l != KindAny && r != KindAny
+}
+
+// checkOp applies the type rules of evaluation to the kinds of the operands
+// of o. For "in" it checks one list element, which compares like "=".
+// Unknown (0) and KindAny operands always pass, as do the operands of a
+// registered operator, which takes values of any type.
+func checkOp(o ComparisonOp, l, r Kind) error {
+	if !checked(l, r) || o.Custom != "" {
+		return nil
+	}
+
+	switch {
+	case o.Contains || o.Excludes:
+		return checkContains(opName(o), l, r)
+	case o.IContains:
+		if l != KindString && l != KindStringSlice {
+			return newErrorKind(opName(o), l)
+		}
+
+		return checkContains(opName(o), l, r)
+	case o.StartsWith || o.EndsWith || o.Match || o.IStartsWith || o.IEndsWith || o.IMatch || o.EqualFold ||
+		o.Like || o.Glob:
+		if l != KindString {
+			return newErrorKind(opName(o), l)
+		}
+
+		if r != KindString {
+			return newErrorKindMismatch(opName(o), l, r)
+		}
+
+		return nil
+	}
+
+	switch {
+	case l == KindBool:
+		if r != KindBool {
+			return newErrorKindMismatch(opName(o), l, r)
+		}
+
+		if !(o.Eq || o.EqEq || o.Neq || o.In) {
+			return fmt.Errorf("%w, %s is not defined for bool", ErrOpDoesnotHaveVal, opName(o))
+		}
+	case l.numeric():
+		if !r.numeric() {
+			return newErrorKindMismatch(opName(o), l, r)
+		}
+	case l == KindString, l == KindTime, l == KindDuration:
+		if r != l {
+			return newErrorKindMismatch(opName(o), l, r)
+		}
+	default:
+		return newErrorKind(opName(o), l)
+	}
+
+	return nil
+}
+
+// checkContains applies the type rules of containsEval: a string contains a
+// string, and a slice contains an element of its own kind, ints and floats
+// being interchangeable.
+func checkContains(op string, container, elem Kind) error {
+	var ok bool
+	switch container {
+	case KindString, KindStringSlice:
+		ok = elem == KindString
+	case KindIntSlice, KindFloatSlice:
+		ok = elem.numeric()
+	case KindBoolSlice:
+		ok = elem == KindBool
+	default:
+		return newErrorKind(op, container)
+	}
+
+	if !ok {
+		return newErrorKindMismatch(op, container, elem)
+	}
+
+	return nil
+}
+
+func newErrorKindMismatch(op string, l, r Kind) error {
+	return fmt.Errorf("%w, Can't use %s on %s and %s", ErrorWrongDataType, op, l, r)
+}
+
+func newErrorKind(op string, l Kind) error {
+	return fmt.Errorf("%w, Can't use %s on %s", ErrorWrongDataType, op, l)
+}
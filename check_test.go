@@ -0,0 +1,206 @@
+package boolexpr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var checkSchema = Schema{
+	"active": KindBool,
+	"age":    KindInt,
+	"score":  KindFloat,
+	"name":   KindString,
+	"tags":   KindStringSlice,
+	"ids":    KindIntSlice,
+	"scores": KindFloatSlice,
+	"flags":  KindBoolSlice,
+	"raw":    KindAny,
+	"at":     KindTime,
+	"ttl":    KindDuration,
+
+	"items[0].sku": KindString,
+}
+
+func TestCheck(t *testing.T) {
+	tcs := []string{
+		`active`,
+		`not active and age > 18`,
+		`age = score or score >= 1`,
+		`name = "x" and name < "y" and "a" != name`,
+		`active = true and active != false`,
+		`name contains "a" and tags contains "go" and tags excludes name`,
+		`ids contains 1 and ids contains 1.5 and scores excludes age and flags contains active`,
+		`name starts_with "a" and name ends_with name and name match "^a"`,
+		`age in (1, 2.5, score) and name not in ("a", name)`,
+		`"go" in tags and age not in ids and "a" in name`,
+		`raw > 1 and raw contains "x" and raw and age = raw`,
+		`items[0].sku starts_with "A"`,
+		`age * 2 + 1 > 30 and age % 7 = 0 and -score < age / 2`,
+		`name + "x" = "ax" and raw + age > 1`,
+		`len(tags) > 2 and len(name) = 4 and lower(name) ends_with "x" and upper(raw) = trim(name)`,
+		`abs(age) > 1 and round(score) = 2.0 and max(age, score, 1) > 0 and min(age, 2) in ids`,
+		`len(raw) > 1 and abs(raw) > 1 and max(raw, 1) = age and lower(name) + "x" = name`,
+		`at > 2024-01-01 and at - 7d < now() and now() - at < ttl * 2 and -ttl < 1h30m`,
+		`at in (2024-01-01, 2024-06-01T12:00:00Z) and ttl not in (1h, 2h) and raw > at`,
+		`name is null and age + 1 is not null and other exists and age != null and null = raw`,
+		`name icontains "a" and tags icontains "GO" and name istarts_with "a" and name iends_with name`,
+		`name imatch "^a" and name equals_fold "x" and raw equals_fold name and raw icontains "x"`,
+		`name like "a%" and name glob "*.go" and raw like name`,
+	}
+
+	for _, input := range tcs {
+		input := input
+		t.Run(input, func(t *testing.T) {
+			exp, err := Parse(input)
+			require.NoError(t, err)
+			assert.NoError(t, Check(exp, checkSchema))
+		})
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	type problem struct {
+		err        error
+		start, end int // byte offsets of the reported span
+	}
+
+	tcs := []struct {
+		input    string
+		problems []problem
+	}{
+		{
+			input:    `age contains 3`,
+			problems: []problem{{ErrorWrongDataType, 0, 14}},
+		},
+		{
+			input:    `name > true`,
+			problems: []problem{{ErrorWrongDataType, 0, 11}},
+		},
+		{
+			input:    `active > false`,
+			problems: []problem{{ErrOpDoesnotHaveVal, 0, 14}},
+		},
+		{
+			input:    `age`,
+			problems: []problem{{ErrorWrongDataType, 0, 3}},
+		},
+		{
+			input:    `missing = 1`,
+			problems: []problem{{ErrSymbolNotFound, 0, 7}},
+		},
+		{
+			input:    `missing is null`,
+			problems: []problem{{ErrSymbolNotFound, 0, 7}},
+		},
+		{
+			// short-circuiting would skip both branches on evaluation
+			input: `true or (tags starts_with "a" and nope)`,
+			problems: []problem{
+				{ErrorWrongDataType, 9, 29},
+				{ErrSymbolNotFound, 34, 38},
+			},
+		},
+		{
+			input: `age in (1, name, other)`,
+			problems: []problem{
+				{ErrSymbolNotFound, 17, 22},
+				{ErrorWrongDataType, 0, 23},
+			},
+		},
+		{
+			input:    `"a" in ids`,
+			problems: []problem{{ErrorWrongDataType, 0, 10}},
+		},
+		{
+			input:    `age like "1%" or name glob age`,
+			problems: []problem{{ErrorWrongDataType, 0, 13}, {ErrorWrongDataType, 17, 30}},
+		},
+		{
+			input:    `ids icontains 1 or age equals_fold "1"`,
+			problems: []problem{{ErrorWrongDataType, 0, 15}, {ErrorWrongDataType, 19, 38}},
+		},
+		{
+			input:    `tags = tags`,
+			problems: []problem{{ErrorWrongDataType, 0, 11}},
+		},
+		{
+			input:    `age + name > 1`,
+			problems: []problem{{ErrorWrongDataType, 0, 14}},
+		},
+		{
+			input:    `-name = "a" or name - "a" = "b"`,
+			problems: []problem{{ErrorWrongDataType, 0, 11}, {ErrorWrongDataType, 15, 31}},
+		},
+		{
+			input:    `age * 1.5 contains 1`,
+			problems: []problem{{ErrorWrongDataType, 0, 20}},
+		},
+		{
+			input:    `items[1].sku = "A"`,
+			problems: []problem{{ErrSymbolNotFound, 0, 12}},
+		},
+		{
+			input:    `not (1 = "x")`,
+			problems: []problem{{ErrorWrongDataType, 5, 12}},
+		},
+		{
+			input:    `len(age) > 1`,
+			problems: []problem{{ErrorWrongDataType, 0, 8}},
+		},
+		{
+			input:    `max(age, name) > 1 or lower(name) > 1`,
+			problems: []problem{{ErrorWrongDataType, 0, 14}, {ErrorWrongDataType, 22, 37}},
+		},
+		{
+			input:    `abs(age + name) > 1 and len(nope) > 1`,
+			problems: []problem{{ErrorWrongDataType, 0, 15}, {ErrSymbolNotFound, 28, 32}},
+		},
+		{
+			input:    `at > "2024-01-01" or ttl < 60`,
+			problems: []problem{{ErrorWrongDataType, 0, 17}, {ErrorWrongDataType, 21, 29}},
+		},
+		{
+			input:    `at + at > now() or -at < now()`,
+			problems: []problem{{ErrorWrongDataType, 0, 15}, {ErrorWrongDataType, 19, 30}},
+		},
+		{
+			input:    `round(score) contains 1`,
+			problems: []problem{{ErrorWrongDataType, 0, 23}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+
+			err = Check(exp, checkSchema)
+			var errs CheckErrors
+			require.True(t, errors.As(err, &errs), "expected CheckErrors, got %v", err)
+			require.Len(t, errs, len(tc.problems))
+
+			for i, p := range tc.problems {
+				assert.ErrorIs(t, errs[i], p.err)
+				assert.Equal(t, p.start, errs[i].Start.Offset)
+				assert.Equal(t, p.end, errs[i].End.Offset)
+			}
+		})
+	}
+
+	t.Run("errors.Is sees every problem", func(t *testing.T) {
+		exp, err := Parse(`missing or age contains 1`)
+		require.NoError(t, err)
+
+		err = Check(exp, checkSchema)
+		assert.ErrorIs(t, err, ErrSymbolNotFound)
+		assert.ErrorIs(t, err, ErrorWrongDataType)
+	})
+
+	t.Run("zero value Expression", func(t *testing.T) {
+		assert.Error(t, Check(Expression{}, checkSchema))
+	})
+}
@@ -0,0 +1,662 @@
+package boolexpr
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// Program is an [Expression] compiled by [Compile] for repeated evaluation.
+// Like an Expression it holds no symbol values, and may be evaluated
+// concurrently against different [Symbols]. The zero value is not usable;
+// always obtain a Program from [Compile].
+type Program struct {
+	eval    evalFunc
+	missing MissingSymbols
+}
+
+// evalFunc evaluates a compiled node.
+type evalFunc func(syms Symbols) (bool, error)
+
+// valueFunc evaluates a compiled operand.
+type valueFunc func(syms Symbols) (evalVal, error)
+
+// Compile turns e into a [Program] that evaluates it faster than
+// [EvalExpression]. Each node is resolved once into a function specialised
+// for it: the operator of a comparison is chosen ahead of time, a comparison
+// between a symbol and a literal compares the symbol's value directly when it
+// has the literal's type, and literal match patterns are compiled once.
+func Compile(e Expression) (Program, error) {
+	if e.e == nil {
+		return Program{}, errors.New("Compile called on zero-value Expression; use Parse to obtain a valid Expression")
+	}
+
+	f, err := compileBoolExpr(e.e)
+	if err != nil {
+		return Program{}, err
+	}
+
+	return Program{eval: f, missing: e.missing}, nil
+}
+
+// Eval evaluates the program against syms, with the same result and errors
+// as [EvalExpression] on the compiled expression. It doesn't allocate, short
+// of errors, of calls to functions of more than one argument, such as min,
+// of what syms allocates to resolve symbols, and of carrying the
+// [MissingSymbols] the expression was parsed with, other than MissingError.
+func (p Program) Eval(syms Symbols) (bool, error) {
+	if p.eval == nil {
+		return false, errors.New("Eval called on zero-value Program; use Compile to obtain a valid Program")
+	}
+
+	return knownResult(p.eval(withOptions(syms, nil, p.missing)))
+}
+
+// EvalContext evaluates the program against syms under ctx, with the same
+// result and errors as [EvalExpressionContext] on the compiled expression.
+func (p Program) EvalContext(ctx context.Context, syms Symbols) (bool, error) {
+	if p.eval == nil {
+		return false, errors.New("EvalContext called on zero-value Program; use Compile to obtain a valid Program")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return knownResult(p.eval(withContext(ctx, withOptions(syms, nil, p.missing))))
+}
+
+func compileBoolExpr(b *BoolExpr) (evalFunc, error) {
+	if len(b.OrOps) == 0 {
+		return compileAndExpr(&b.And)
+	}
+
+	fs := make([]evalFunc, 0, len(b.OrOps)+1)
+	f, err := compileAndExpr(&b.And)
+	if err != nil {
+		return nil, err
+	}
+	fs = append(fs, f)
+
+	for i := range b.OrOps {
+		f, err := compileAndExpr(&b.OrOps[i].And)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+
+	return func(syms Symbols) (bool, error) {
+		var k kleene
+		for i, f := range fs {
+			if i > 0 {
+				if err := contextErr(syms); err != nil {
+					return false, err
+				}
+			}
+
+			res, err := k.or(f(syms))
+			if err != nil {
+				return false, err
+			}
+
+			if res {
+				// short circuit: the whole OR is already true
+				return true, nil
+			}
+		}
+
+		return k.result(false, true)
+	}, nil
+}
+
+func compileAndExpr(a *AndExpr) (evalFunc, error) {
+	if len(a.AndOps) == 0 {
+		return compileExpr(a.Expr)
+	}
+
+	fs := make([]evalFunc, 0, len(a.AndOps)+1)
+	f, err := compileExpr(a.Expr)
+	if err != nil {
+		return nil, err
+	}
+	fs = append(fs, f)
+
+	for _, op := range a.AndOps {
+		f, err := compileExpr(op.Expr)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+
+	return func(syms Symbols) (bool, error) {
+		var k kleene
+		for i, f := range fs {
+			if i > 0 {
+				if err := contextErr(syms); err != nil {
+					return false, err
+				}
+			}
+
+			res, err := k.and(f(syms))
+			if err != nil {
+				return false, err
+			}
+
+			if !res {
+				// short circuit: the whole AND is already false
+				return false, nil
+			}
+		}
+
+		return k.result(true, false)
+	}, nil
+}
+
+func compileExpr(x Expr) (evalFunc, error) {
+	switch e := x.(type) {
+	case *Compare:
+		return compileCompare(e), nil
+	case *NullTest:
+		return func(syms Symbols) (bool, error) {
+			res, err := evalNullTest(e, syms)
+			if err != nil {
+				return false, newEvalError(e.Pos, e.EndPos, err)
+			}
+
+			return res, nil
+		}, nil
+	case *BoolValue:
+		return compileBoolValue(e), nil
+	case *SubExpr:
+		return compileBoolExpr(&e.BoolExpr)
+	case *NotExpr:
+		f, err := compileExpr(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(syms Symbols) (bool, error) {
+			res, err := f(syms)
+			if err != nil {
+				return false, err
+			}
+
+			return !res, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("Expr type is unhandled %T", x)
+	}
+}
+
+func compileBoolValue(e *BoolValue) evalFunc {
+	if e.Value.Call != nil {
+		call := compileCall(&e.Value)
+		return func(syms Symbols) (bool, error) {
+			v, err := call(syms)
+			if err != nil {
+				return false, newEvalError(e.Value.Pos, e.Value.EndPos, err)
+			}
+
+			if b, ok := v.toBool(); ok {
+				return b, nil
+			}
+
+			if v.isNull() {
+				return nullCondition(syms)
+			}
+
+			return false, newEvalError(e.Value.Pos, e.Value.EndPos,
+				fmt.Errorf("%w, bare value must be bool, got %T", ErrorWrongDataType, v.toAny()))
+		}
+	}
+
+	if e.Value.Null {
+		return nullCondition
+	}
+
+	if e.Value.Symbol == nil {
+		res, err := evalBoolValue(e, nil)
+		if err != nil {
+			err = newEvalError(e.Value.Pos, e.Value.EndPos, err)
+		}
+
+		return func(Symbols) (bool, error) { return res, err }
+	}
+
+	return func(syms Symbols) (bool, error) {
+		v, err := getSymbol(&e.Value, syms)
+		if err != nil {
+			return false, newEvalError(e.Value.Pos, e.Value.EndPos, err)
+		}
+
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+
+		if v == nil {
+			return nullCondition(syms)
+		}
+
+		return false, newEvalError(e.Value.Pos, e.Value.EndPos,
+			fmt.Errorf("%w, bare value must be bool, got %T", ErrorWrongDataType, v))
+	}
+}
+
+func compileValue(v *Value) valueFunc {
+	if v.Call != nil {
+		return compileCall(v)
+	}
+
+	if v.Symbol == nil {
+		val, err := evalValue(v, nil)
+		return func(Symbols) (evalVal, error) { return val, err }
+	}
+
+	return func(syms Symbols) (evalVal, error) {
+		val, err := getSymbol(v, syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		return evalVal{kind: kindAny, a: val}, nil
+	}
+}
+
+// compileCall compiles the arguments of the call v once, and calls its
+// function with them.
+func compileCall(v *Value) valueFunc {
+	c := v.Call
+	f, ok := c.Func.(*function)
+	if !ok || f.checkArity(len(c.Args)) != nil {
+		return func(syms Symbols) (evalVal, error) { return evalCall(v, syms) }
+	}
+
+	args := make([]valueFunc, len(c.Args))
+	for i := range c.Args {
+		args[i] = compileOperand(&c.Args[i])
+	}
+
+	if f.call1 != nil {
+		arg := args[0]
+		return func(syms Symbols) (evalVal, error) {
+			a, err := arg(syms)
+			if err != nil {
+				return evalVal{}, err
+			}
+
+			if a.isNull() && !f.nulls {
+				return a, nil
+			}
+
+			res, err := f.call1(a)
+			return res, locatePanic(v, err)
+		}
+	}
+
+	return func(syms Symbols) (evalVal, error) {
+		vals := make([]evalVal, len(args))
+		for i, arg := range args {
+			var err error
+			if vals[i], err = arg(syms); err != nil {
+				return evalVal{}, err
+			}
+		}
+
+		res, err := f.callArgs(vals)
+		return res, locatePanic(v, err)
+	}
+}
+
+// compileOperand compiles an arithmetic operand into a tree of closures, or a
+// single value into its valueFunc.
+func compileOperand(o *Operand) valueFunc {
+	if v := o.Value(); v != nil {
+		return compileValue(v)
+	}
+
+	l := compileTerm(&o.Term)
+	for i := range o.Ops {
+		l = compileArith(o.Ops[i].Op, l, compileTerm(&o.Ops[i].Term))
+	}
+
+	return l
+}
+
+func compileTerm(t *Term) valueFunc {
+	l := compileFactor(&t.Factor)
+	for i := range t.Ops {
+		l = compileArith(t.Ops[i].Op, l, compileFactor(&t.Ops[i].Factor))
+	}
+
+	return l
+}
+
+func compileFactor(f *Factor) valueFunc {
+	switch {
+	case f.Value != nil:
+		return compileValue(f.Value)
+	case f.Group != nil:
+		return compileOperand(f.Group)
+	case f.Neg != nil:
+		v := compileFactor(f.Neg)
+		return func(syms Symbols) (evalVal, error) {
+			val, err := v(syms)
+			if err != nil {
+				return evalVal{}, err
+			}
+
+			return negEval(val)
+		}
+	default:
+		return func(Symbols) (evalVal, error) { return evalVal{}, ErrValueDoesntHaveAnyVal }
+	}
+}
+
+func compileArith(op string, l, r valueFunc) valueFunc {
+	return func(syms Symbols) (evalVal, error) {
+		lv, err := l(syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		rv, err := r(syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		return arithEval(op, lv, rv)
+	}
+}
+
+func compileCompare(e *Compare) evalFunc {
+	o := e.Op
+	wrap := func(res bool, err error) (bool, error) {
+		if err != nil {
+			return false, newEvalError(e.Pos, e.EndPos, err)
+		}
+
+		return res, nil
+	}
+
+	if o.In || o.NotIn {
+		l := compileOperand(&e.Left)
+		return func(syms Symbols) (bool, error) {
+			lv, err := l(syms)
+			if err != nil {
+				return wrap(false, err)
+			}
+
+			res, err := inEval(lv, &e.Right, syms)
+			return wrap(res != o.NotIn, err)
+		}
+	}
+
+	if o.Custom != "" {
+		l, r := compileOperand(&e.Left), compileOperand(&e.Right)
+		return func(syms Symbols) (bool, error) {
+			lv, err := l(syms)
+			if err != nil {
+				return wrap(false, err)
+			}
+
+			rv, err := r(syms)
+			if err != nil {
+				return wrap(false, err)
+			}
+
+			return wrap(operatorEval(&e.Op, lv, rv, syms))
+		}
+	}
+
+	if f := compileSymbolCompare(e, wrap); f != nil {
+		return f
+	}
+
+	if e.Pattern != nil {
+		return compileMatch(e, wrap)
+	}
+
+	op := opFunc(o)
+	l, r := compileOperand(&e.Left), compileOperand(&e.Right)
+	return func(syms Symbols) (bool, error) {
+		lv, err := l(syms)
+		if err != nil {
+			return wrap(false, err)
+		}
+
+		rv, err := r(syms)
+		if err != nil {
+			return wrap(false, err)
+		}
+
+		if lv.isNull() || rv.isNull() {
+			return nullCompare(o, lv, rv, syms)
+		}
+
+		return wrap(op(lv, rv))
+	}
+}
+
+// opFunc selects the operator of o once, instead of on every evaluation as
+// evalComparisonOpVal does.
+func opFunc(o ComparisonOp) func(l, r evalVal) (bool, error) {
+	switch {
+	case o.Contains:
+		return containsEval
+	case o.Excludes:
+		return func(l, r evalVal) (bool, error) {
+			res, err := containsEval(l, r)
+			return !res && err == nil, err
+		}
+	case o.StartsWith:
+		return startsWithEval
+	case o.EndsWith:
+		return endsWithEval
+	case o.Match:
+		return matchEval
+	case o.IContains:
+		return icontainsEval
+	case o.IStartsWith:
+		return istartsWithEval
+	case o.IEndsWith:
+		return iendsWithEval
+	case o.IMatch:
+		return imatchEval
+	case o.EqualFold:
+		return equalFoldEval
+	case o.Like:
+		return likeEval
+	case o.Glob:
+		return globEval
+	default:
+		return func(l, r evalVal) (bool, error) { return evalCmpVal(o, l, r) }
+	}
+}
+
+// compileMatch compiles a match, imatch, like or glob against the literal
+// pattern compiled when parsing.
+func compileMatch(e *Compare, wrap func(bool, error) (bool, error)) evalFunc {
+	pattern, _ := evalValue(e.Right.Value(), nil)
+	l := compileOperand(&e.Left)
+
+	return func(syms Symbols) (bool, error) {
+		lv, err := l(syms)
+		if err != nil {
+			return wrap(false, err)
+		}
+
+		if lv.isNull() {
+			return nullCompare(e.Op, lv, pattern, syms)
+		}
+
+		return wrap(literalPatternEval(e.Op, e.Pattern, lv))
+	}
+}
+
+// compileSymbolCompare specialises an ordered comparison or equality between
+// a symbol and a literal: when the symbol's value has the literal's type, or
+// is the other numeric type, it is compared directly, without going through
+// evalVal. Other values take the generic path, so errors are unchanged. It
+// returns nil for any other comparison, or when the symbol has a path.
+func compileSymbolCompare(e *Compare, wrap func(bool, error) (bool, error)) evalFunc {
+	o := e.Op
+	sym, lit := e.Left.Value(), e.Right.Value()
+	if sym == nil || lit == nil {
+		return nil
+	}
+
+	symLeft := sym.Symbol != nil
+	if !symLeft {
+		// A literal on the left is compared with the mirrored operator:
+		// 1 < x is x > 1.
+		sym, lit = lit, sym
+		o = mirror(o)
+	}
+
+	if sym.Symbol == nil || len(sym.Path) > 0 || lit.Symbol != nil || lit.List != nil {
+		return nil
+	}
+
+	litVal, _ := evalValue(lit, nil)
+	if litVal.isNull() {
+		return nil
+	}
+
+	name := *sym.Symbol
+	generic := func(syms Symbols, v any, err error) (bool, error) {
+		if err != nil {
+			if err = missingSymbol(syms, err); err != nil {
+				return false, err
+			}
+			v = nil
+		}
+
+		l, r := evalVal{kind: kindAny, a: v}, litVal
+		if !symLeft {
+			l, r = r, l
+		}
+
+		if v == nil {
+			return nullCompare(e.Op, l, r, syms)
+		}
+
+		return evalCmpVal(e.Op, l, r)
+	}
+
+	switch litVal.kind {
+	case kindInt:
+		ints, floats := orderedOp[int](o), orderedOp[float64](o)
+		if ints == nil {
+			return nil
+		}
+
+		i, f := litVal.i, float64(litVal.i)
+		return func(syms Symbols) (bool, error) {
+			v, err := syms.Get(name)
+			if err == nil {
+				switch v := v.(type) {
+				case int:
+					return ints(v, i), nil
+				case float64:
+					return floats(v, f), nil
+				}
+			}
+
+			return wrap(generic(syms, v, err))
+		}
+	case kindFloat64:
+		floats := orderedOp[float64](o)
+		if floats == nil {
+			return nil
+		}
+
+		f := litVal.f
+		return func(syms Symbols) (bool, error) {
+			v, err := syms.Get(name)
+			if err == nil {
+				switch v := v.(type) {
+				case float64:
+					return floats(v, f), nil
+				case int:
+					return floats(float64(v), f), nil
+				}
+			}
+
+			return wrap(generic(syms, v, err))
+		}
+	case kindString:
+		strs := orderedOp[string](o)
+		if strs == nil {
+			return nil
+		}
+
+		s := litVal.s
+		return func(syms Symbols) (bool, error) {
+			v, err := syms.Get(name)
+			if v, ok := v.(string); ok && err == nil {
+				return strs(v, s), nil
+			}
+
+			return wrap(generic(syms, v, err))
+		}
+	case kindBool:
+		if !(o.Eq || o.EqEq || o.Neq) {
+			return nil
+		}
+
+		want := litVal.b != o.Neq
+		return func(syms Symbols) (bool, error) {
+			v, err := syms.Get(name)
+			if v, ok := v.(bool); ok && err == nil {
+				return v == want, nil
+			}
+
+			return wrap(generic(syms, v, err))
+		}
+	default:
+		return nil
+	}
+}
+
+// orderedOp returns the comparison function of o, or nil when o is not an
+// equality or ordering.
+func orderedOp[T cmp.Ordered](o ComparisonOp) func(l, r T) bool {
+	switch {
+	case o.Eq || o.EqEq:
+		return func(l, r T) bool { return l == r }
+	case o.Neq:
+		return func(l, r T) bool { return l != r }
+	case o.Gt:
+		return func(l, r T) bool { return l > r }
+	case o.Gte:
+		return func(l, r T) bool { return l >= r }
+	case o.Lt:
+		return func(l, r T) bool { return l < r }
+	case o.Lte:
+		return func(l, r T) bool { return l <= r }
+	default:
+		return nil
+	}
+}
+
+// mirror returns the operator comparing the operands of o the other way
+// round.
+func mirror(o ComparisonOp) ComparisonOp {
+	switch {
+	case o.Gt:
+		return ComparisonOp{Lt: true}
+	case o.Gte:
+		return ComparisonOp{Lte: true}
+	case o.Lt:
+		return ComparisonOp{Gt: true}
+	case o.Lte:
+		return ComparisonOp{Gte: true}
+	default:
+		return o
+	}
+}
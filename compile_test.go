@@ -0,0 +1,126 @@
+package boolexpr
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertCompiledLikeEval checks that the compiled input evaluates exactly like
+// EvalExpression: same result, same error.
+func assertCompiledLikeEval(t *testing.T, input string, syms SymbolsMap) {
+	t.Helper()
+
+	exp, err := Parse(input)
+	if err != nil {
+		return
+	}
+
+	p, err := Compile(exp)
+	require.NoError(t, err)
+
+	want, wantErr := EvalExpression(exp, syms)
+	got, gotErr := p.Eval(syms)
+	assert.Equal(t, want, got)
+	if wantErr == nil {
+		assert.NoError(t, gotErr)
+	} else {
+		assert.EqualError(t, gotErr, wantErr.Error())
+		assert.Equal(t, wantErr, gotErr)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	for _, tc := range evalTests {
+		tc := tc
+		t.Run(fmt.Sprintf("%s -> %t", tc.input, tc.expected), func(t *testing.T) {
+			assertCompiledLikeEval(t, tc.input, tc.symbols)
+		})
+	}
+
+	for _, tc := range evalErrorTests {
+		tc := tc
+		t.Run(fmt.Sprintf("%s -> %s", tc.input, tc.expected), func(t *testing.T) {
+			assertCompiledLikeEval(t, tc.input, tc.symbols)
+		})
+	}
+
+	// The specialised comparisons between a symbol and a literal, with values
+	// of every type on either side.
+	syms := SymbolsMap{
+		"i":    7,
+		"f":    7.5,
+		"big":  math.MaxInt64,
+		"nan":  math.NaN(),
+		"s":    "abc",
+		"b":    true,
+		"tags": []string{"a"},
+		"fn":   func() int { return 7 },
+	}
+	for _, sym := range []string{"i", "f", "big", "nan", "s", "b", "tags", "fn", "missing"} {
+		for _, lit := range []string{"7", "7.0", "7.5", "9223372036854775806", `"abc"`, "true", "false"} {
+			for _, op := range []string{"=", "==", "!=", ">", ">=", "<", "<="} {
+				for _, input := range []string{sym + " " + op + " " + lit, lit + " " + op + " " + sym} {
+					input := input
+					t.Run(input, func(t *testing.T) {
+						assertCompiledLikeEval(t, input, syms)
+					})
+				}
+			}
+		}
+	}
+
+	for _, input := range []string{
+		`s match "^a"`,
+		`s match "("`,
+		`i match "^a"`,
+		`missing match "^a"`,
+		`s match s`,
+		`"abc" match "b"`,
+		`s contains "b" and s excludes "z" and s starts_with "a" and s ends_with "c"`,
+		`tags contains "a" and tags excludes "b"`,
+		`i in (1, 7) and s not in ("x", s)`,
+		`not b or i > 100`,
+		`(b and not (i < f)) or missing`,
+		`b`,
+		`i`,
+		`true and false or true`,
+		`1`,
+	} {
+		input := input
+		t.Run(input, func(t *testing.T) {
+			assertCompiledLikeEval(t, input, syms)
+		})
+	}
+
+	t.Run("zero values", func(t *testing.T) {
+		_, err := Compile(Expression{})
+		require.Error(t, err)
+
+		_, err = Program{}.Eval(SymbolsMap{})
+		require.Error(t, err)
+	})
+}
+
+func TestProgramEvalAllocs(t *testing.T) {
+	for _, tc := range evalCases {
+		if tc.name == "FuncSymbol" || tc.name == "FuncSymbolErr" {
+			// Resolving a function symbol boxes its result.
+			continue
+		}
+
+		exp, err := Parse(tc.expr)
+		require.NoError(t, err)
+
+		p, err := Compile(exp)
+		require.NoError(t, err)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			benchBool, benchErr = p.Eval(tc.syms)
+		})
+		assert.Zero(t, allocs, tc.name)
+	}
+}
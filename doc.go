@@ -28,6 +28,20 @@
 //	ok2, _ := boolexpr.EvalExpression(ast, boolexpr.SymbolsMap{"x": 0})
 //	// ok1 == true, ok2 == false
 //
+// # Symbols from structs
+//
+// [NewStructSymbols] reads symbols from the exported fields and zero-argument
+// methods of a struct, named by `boolexpr:"name"` tags or the snake_case of
+// their Go names. Named types read as their underlying kind:
+//
+//	type User struct {
+//		Name   string `boolexpr:"login"`
+//		Status Status // type Status string
+//		Age    int
+//	}
+//	syms, _ := boolexpr.NewStructSymbols(&user)
+//	ok, err := boolexpr.Eval(`login = "joanna" and status = "active"`, syms)
+//
 // # Syntax
 //
 // A comparison always takes the form "value operator value", where each value
@@ -40,6 +54,8 @@
 // Supported comparison operators:
 //
 //	=  ==  !=  >  <  >=  <=  contains  excludes  starts_with  ends_with  match
+//	icontains  istarts_with  iends_with  imatch  equals_fold  like  glob
+//	in  not in
 //
 // Comparisons are joined with the logical operators "and" (or "&&") and "or"
 // (or "||"), and may be grouped with parentheses:
@@ -53,15 +69,30 @@
 // A bare boolean symbol or literal may be used without a comparison operator,
 // e.g. "active" or "true".
 //
-// Literal value types are int, float, string and bool. Strings are written
-// with double quotes.
+// The prefix operator "not" (or "!") negates the expression that follows it.
+// It binds tighter than "and", and applies to a whole comparison, a bare bool
+// or a parenthesized group:
+//
+//	not (role = "admin" or banned)
+//	!active and x > 1    // (not active) and x > 1
+//	not x = 1            // not (x = 1)
+//
+// Each side of a comparison may be an arithmetic expression, or call a
+// function; see Arithmetic and Functions below.
+//
+// Literal value types are int, float, string, bool, timestamp and duration,
+// and there is the null literal. Strings are written with double quotes; see
+// Times and durations below for those two, and Null and missing symbols for
+// null. The words "and", "or", "not", "in" and "null" are reserved and cannot
+// be used as symbol names.
 //
 // # Symbols
 //
 // A [Symbols] provides the value for each symbol name during evaluation.
 // [SymbolsMap] is the simplest implementation, wrapping a map[string]any.
 //
-// A value may be a literal (string, int, float64, bool), a slice
+// A value may be a literal (string, int, float64, bool, time.Time,
+// time.Duration), a slice
 // ([]string, []int, []float64, []bool) for use with contains/excludes, or a
 // function that is called lazily during evaluation. Both plain
 // (func() int) and error-returning (func() (int, error)) function variants are
@@ -72,6 +103,176 @@
 // Functions are only called when evaluation actually reaches the symbol, so
 // expensive lookups can be deferred and skipped via short-circuiting.
 //
+// # Contexts
+//
+// [EvalExpressionContext] and [Program.EvalContext] evaluate under a
+// [context.Context]. Evaluation stops with ctx.Err() once it is done, checked
+// before each operand of "and" and "or"; a function value of the form
+// func(context.Context) (T, error) is called with ctx, and a [ContextSymbols]
+// is asked with GetContext rather than Get, so lookups can honour its
+// deadline:
+//
+//	syms := boolexpr.SymbolsMap{
+//		"balance": func(ctx context.Context) (int, error) { return db.Balance(ctx, id) },
+//	}
+//	ok, err := boolexpr.EvalExpressionContext(ctx, exp, syms)
+//
+// Other evaluations call such functions with [context.Background].
+//
+// # Prefetching
+//
+// Symbols are looked up one at a time, as evaluation reaches them. When each
+// lookup is a slow remote call, [WithPrefetch] looks them up concurrently
+// before evaluating instead, with a bound on the lookups in flight:
+// [PrefetchAll] every symbol of the expression, and [PrefetchFirstBranch]
+// those of the first operand of each "or", leaving the other branches to be
+// looked up if evaluation reaches them:
+//
+//	ok, err := boolexpr.EvalExpression(exp, syms, boolexpr.WithPrefetch(boolexpr.PrefetchAll, 4))
+//
+// [PrefetchAndLevel] looks up the symbols of the operands of each "and" as
+// evaluation reaches it, so the branches short-circuiting skips are never
+// looked up. The values are cached in a [CachedSymbols], or the [CachedMap] or
+// CachedSymbols given, and the result and errors are those of the lazy
+// evaluation, [PrefetchNone], which stays the default.
+//
+// A [BatchSymbols] looks several symbols up in one call to GetMany, such as a
+// single request to a remote store, and a [BatchContextSymbols] does so under
+// a context with GetManyContext. Prefetching looks its symbols up in one call
+// rather than concurrently, and [CachedSymbols.GetMany] and
+// [CachedSymbols.GetManyContext] fill a cache in one call; evaluation without
+// either looks symbols up one at a time:
+//
+//	cache := boolexpr.NewCachedSymbols(store)
+//	cache.GetMany(boolexpr.ListSymbols(exp))
+//
+// # Arithmetic
+//
+// The sides of a comparison may combine values with "+", "-", "*", "/" and
+// "%", and be negated with a unary "-". "*", "/" and "%" bind tighter than
+// "+" and "-", all bind tighter than comparisons, and parentheses group:
+//
+//	price * quantity > 100
+//	end - start >= 3600
+//	-(balance + pending) < limit
+//	first + " " + last = "Ada Lovelace"
+//
+// An int combined with an int stays an int, computed exactly, so 7 / 2 is 3;
+// combined with a float it is promoted to float64, so 7.0 / 2 is 3.5. "+"
+// also concatenates two strings. Division by zero fails with
+// [ErrDivisionByZero], and a result out of the range of its type with
+// [ErrOverflow].
+//
+// # Functions
+//
+// A value may be a call to a function, whose arguments may be any operand,
+// such as a symbol, an arithmetic expression or another call:
+//
+//	lower(email) ends_with "@corp.com"
+//	len(tags) > 2
+//	abs(a - b) < max(tolerance, 0.5)
+//
+// The functions are:
+//
+//	len(v)          the number of characters of a string, or elements of a slice
+//	lower(s)        s in lower case
+//	upper(s)        s in upper case
+//	trim(s)         s without leading and trailing white space
+//	abs(n)          the absolute value of n
+//	round(n)        n rounded to the nearest whole number, halves away from zero
+//	floor(n)        the greatest whole number not above n
+//	ceil(n)         the least whole number not below n
+//	min(n, ...)     the least of one or more numbers
+//	max(n, ...)     the greatest of one or more numbers
+//	now()           the current time
+//
+// abs, round, floor and ceil keep the type of their argument, and min and max
+// return an int when all their arguments are ints, as arithmetic does. A call
+// to a function that doesn't exist fails to parse with [ErrUnknownFunction],
+// and one with too few or too many arguments with [ErrArgumentCount].
+// Arguments of the wrong kind fail with [ErrorWrongDataType]: when parsing
+// for literals, or by evaluation for symbols, unless [Check] finds them first.
+//
+// More functions can be registered in a [Functions] registry and given to
+// [Parse] with [WithFunctions]. A function may take and return bools, ints,
+// float64s, strings, time.Times, time.Durations, slices of those or any, may be variadic, and may return
+// an error as its second result:
+//
+//	fns := boolexpr.NewFunctions()
+//	err := fns.Register("has_permission", func(user, perm string) (bool, error) {
+//		...
+//	})
+//	e, err := boolexpr.Parse(`has_permission(user, "write")`, boolexpr.WithFunctions(fns))
+//
+// Registered functions are checked like the built-in ones when parsing, and
+// replace a built-in one of the same name. Given to [EvalExpression],
+// WithFunctions binds the functions of that name again for that evaluation.
+// So they are only ever called by evaluation: [PartialEval] and [Simplify]
+// leave their calls in place. A function that panics fails the evaluation
+// with an [EvalError] located at its call.
+//
+// # Times and durations
+//
+// A timestamp is written in RFC 3339, or as a date alone for midnight UTC,
+// and a duration as in Go, with "d" for a day of 24 hours:
+//
+//	created_at >= 2024-01-01
+//	expires_at < 2024-06-01T12:00:00+02:00
+//	timeout <= 1h30m
+//	now() - last_login > 7d
+//
+// Timestamps and durations compare in order with each other of their own
+// kind, whether literals or symbols holding a time.Time or time.Duration.
+// Subtracting two timestamps gives a duration; adding a duration to a
+// timestamp, or subtracting one from it, gives a timestamp; and durations add,
+// subtract, negate, and multiply or divide by an int. A timestamp outside the
+// years 1678 to 2262 fails with [ErrOverflow].
+//
+// now() reads the wall clock, unless another clock is given with
+// [WithClock], such as a fixed time in tests:
+//
+//	clock := func() time.Time { return time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) }
+//	e, err := boolexpr.Parse(`now() - created_at < 30d`, boolexpr.WithClock(clock))
+//
+// # Null and missing symbols
+//
+// A symbol whose value is nil is null, as is the literal null. Null is only
+// equal to null, and every other comparison with it is false; arithmetic on
+// null and the built-in functions of null give null. Three tests look at a
+// symbol without comparing it:
+//
+//	deleted_at is null
+//	email is not null
+//	nickname exists      // present, even when nil
+//
+// A missing symbol, one [Symbols] reports with [ErrSymbolNotFound], fails
+// evaluation by default. [WithMissingSymbols] chooses otherwise:
+// [MissingNull] treats it as null, and [MissingThreeValued] as null under
+// SQL's three-valued logic, where a comparison with null is neither true nor
+// false but unknown, and so is its negation:
+//
+//	e, err := boolexpr.Parse(`not age > 18`, boolexpr.WithMissingSymbols(boolexpr.MissingThreeValued))
+//	ok, err := boolexpr.EvalExpression(e, boolexpr.SymbolsMap{}) // false
+//
+// "and" and "or" follow Kleene's rules there: false and unknown is false, and
+// true or unknown is true. An expression that is unknown in the end evaluates
+// to false, and a [Trace] marks its unknown nodes with "?".
+//
+// # Paths
+//
+// A symbol may be followed by a path into the value it holds: ".field" for a
+// map key or struct field, "[0]" for an element of a slice or array, and
+// ["x-key"] for a key that is not an identifier:
+//
+//	items[0].sku = "A-1"
+//	meta["x-key"] = "v" and order.customer.tier = "gold"
+//
+// The root symbol is looked up in [Symbols] and its value walked through
+// maps with string keys, slices and structs, whose fields and methods are
+// named as by [StructSymbols]. A missing key or an index out of range is
+// reported with [ErrSymbolNotFound]. [ListSymbols] lists the root symbols and
+// [ListSymbolPaths] the full paths.
+//
 // # contains and excludes
 //
 // "contains" tests whether the left operand contains the right operand;
@@ -84,6 +285,24 @@
 // For numeric slices int and float64 are interchangeable, matching the
 // behaviour of "=".
 //
+// # in and not in
+//
+// "in" tests whether the left operand is a member of a parenthesized list of
+// values; "not in" is its negation. The list may mix literals and symbols, and
+// each element is compared using the rules of "=", so ints and floats compare
+// with each other:
+//
+//	country in ("DE", "FR", "NL")
+//	status not in (404, 410)
+//	id in (1, 2, other_id)
+//
+// A list made only of literals is turned into a hash set when the expression
+// is parsed, so its length does not affect evaluation cost. Such a list must
+// hold a single kind of literal. A list is only valid after "in"/"not in".
+//
+// The right operand may also be a slice symbol instead of a list, in which
+// case "x in tags" is the same as "tags contains x".
+//
 // # starts_with and ends_with
 //
 // Both operands must be strings:
@@ -99,10 +318,160 @@
 //	x match "pattern.*"
 //	email match valid_email_regex
 //
-// Both operands must be strings and the match is unanchored. Compiled patterns
-// are cached, so each distinct pattern is compiled only once across all
+// Both operands must be strings and the match is unanchored. A literal
+// pattern is compiled by [Parse], which reports an invalid one; a pattern held
+// in a symbol is compiled once per distinct pattern and cached, across all
 // evaluations.
 //
+// # like and glob
+//
+// "like" and "glob" match the whole left string against a wildcard pattern,
+// simpler to write than a regular expression. like takes SQL's wildcards, "%"
+// for any run of characters and "_" for one character:
+//
+//	name like "Jo%"
+//	code like "A_-%"
+//
+// glob takes the shell's: "*" for any run of characters, "?" for one, and
+// "[a-z]" for one in a set, or "[!a-z]" for one outside it. Unlike in a
+// shell, "*" also matches "/":
+//
+//	file glob "*.pdf"
+//	sku glob "[A-C]??-*"
+//
+// In both, "\" makes the character after it literal, and is itself escaped
+// in a string literal: name like "50\\%" matches "50%" alone. Both
+// operands must be strings, and patterns are compiled as for match: a literal
+// one when parsing, where an invalid one such as an unclosed "[" fails, and
+// one held in a symbol once, then cached.
+//
+// # Case-insensitive operators
+//
+// icontains, istarts_with, iends_with and imatch are contains, starts_with,
+// ends_with and match ignoring case, and equals_fold is "=" ignoring case:
+//
+//	email iends_with "@Example.com"
+//	tags icontains "GO"
+//	country equals_fold "nl"
+//
+// Case is folded as by [strings.EqualFold], Unicode's simple case folding, so
+// "Σ" matches "σ" and "ς", but "ß" doesn't match "SS". The operands are
+// strings, and for icontains the left one may also be a []string, one of
+// whose elements must equal the right operand. Neither operand is copied to
+// fold it, so they don't allocate. imatch applies the (?i) flag to its
+// pattern.
+//
+// # Custom operators
+//
+// Domain comparisons can be registered as infix operators in an [Operators]
+// registry, and given to [Parse] with [WithOperators]:
+//
+//	ops := boolexpr.NewOperators()
+//	err := ops.Register("in_cidr", func(l, r any) (bool, error) { ... })
+//	e, err := boolexpr.Parse(`ip in_cidr "10.0.0.0/8"`, boolexpr.WithOperators(ops))
+//
+// An identifier between two operands is an operator, and one that is neither
+// built in nor registered fails to parse with [ErrUnknownOperator]. The
+// function is given the operand values as evaluation found them, and any
+// error it returns aborts evaluation. Given to [EvalExpression],
+// WithOperators binds the operators of that name again for that evaluation.
+//
+// # Errors
+//
+// [Parse] reports a syntax error as a [*ParseError] holding the position of the
+// offending token, its text and the tokens that would have been accepted
+// there, so a user interface can underline the problem:
+//
+//	_, err := boolexpr.Parse(`x = 1 and`)
+//	var perr *boolexpr.ParseError
+//	if errors.As(err, &perr) {
+//		// perr.Line == 1, perr.Column == 10, perr.Got == "<EOF>"
+//		// perr.Expected == [<symbol> <int> <float> <string> <time> <duration> true false null not ! (]
+//	}
+//
+// An error during evaluation is an [*EvalError] carrying the source span of the
+// comparison (or bare value) that failed. Both wrap their cause, so errors.Is
+// still matches sentinel errors such as [ErrSymbolNotFound].
+//
+// # Type checking
+//
+// Type errors normally surface during evaluation, and only on branches that
+// short-circuiting did not skip. [Check] finds them ahead of time from a
+// [Schema] declaring the [Kind] of each symbol, walking every branch:
+//
+//	exp, _ := boolexpr.Parse(`age contains 3 or name > true`)
+//	err := boolexpr.Check(exp, boolexpr.Schema{
+//		"age":  boolexpr.KindInt,
+//		"name": boolexpr.KindString,
+//	})
+//	// err lists both comparisons as [*CheckError] values
+//
+// # Formatting
+//
+// [Expression.String] returns the canonical text of an expression: operators
+// spelled as words, single spaces, and parentheses only where precedence
+// requires them. Parsing it yields an equivalent expression:
+//
+//	exp, _ := boolexpr.Parse(`((x==1)&&!(y||z))`)
+//	exp.String() // x == 1 and not (y or z)
+//
+// # Compilation
+//
+// An expression evaluated many times can be compiled with [Compile] into a
+// [Program], which resolves each node once into a specialised function.
+// [Program.Eval] has the semantics of [EvalExpression], is several times
+// faster, and does not allocate.
+//
+// # Tracing
+//
+// [EvalExpressionTrace] evaluates like [EvalExpression] and also returns a
+// [Trace]: the resolved operands and result of every comparison, and which
+// operands short-circuiting skipped. Printed, it shows why an expression
+// evaluated the way it did:
+//
+//	✗ age >= 18 and country in ("NL", "BE") and verified
+//	  ✓ age >= 18 (21 >= 18)
+//	  ✗ country in ("NL", "BE") ("DE" in ("NL", "BE"))
+//	  - verified (skipped)
+//
+// # Partial evaluation
+//
+// [PartialEval] evaluates an expression with the symbols known ahead of time,
+// folding every comparison it can, and returns the residual expression to
+// evaluate once the rest are known:
+//
+//	exp, _ := boolexpr.Parse(`(plan = "free" or seats > 5) and age >= min_age`)
+//	r, _ := boolexpr.PartialEval(exp, boolexpr.SymbolsMap{"plan": "pro", "seats": 10, "min_age": 18})
+//	r.String() // age >= 18
+//
+// # Optimization
+//
+// [Optimize] reorders the operands of each "and" and "or" to evaluate first
+// those most likely to decide it for the least cost, as estimated from the
+// per-symbol and per-operator [Costs] given, and optionally from the
+// selectivity [Stats] recorded from traces. The result is unchanged whenever
+// no operand fails:
+//
+//	fast := boolexpr.Optimize(exp, boolexpr.Costs{
+//		Symbols:   map[string]float64{"remote_score": 100},
+//		Operators: map[string]float64{"match": 20},
+//	})
+//
+// # Simplification
+//
+// [Simplify] folds comparisons of literals alone, drops duplicate and
+// absorbed operands of "and" and "or", and flattens redundant parentheses;
+// [ToDNF] and [ToCNF] return the disjunctive and conjunctive normal forms,
+// failing with [ErrTooLarge] past a size limit:
+//
+//	exp, _ := boolexpr.Parse(`a = 1 and a = 1 or (a = 1 and b = 2) or 2 < 1`)
+//	boolexpr.Simplify(exp).String() // a = 1
+//
+// # SQL
+//
+// The sql subpackage translates an Expression into a parameterised SQL WHERE
+// clause, so the same rules can also select rows from a database.
+//
 // # Short-circuit evaluation
 //
 // Logical operators short-circuit: with "and" a false left operand skips the
@@ -2,14 +2,15 @@ package boolexpr
 
 import (
 	"cmp"
+	"context"
 	"errors"
 	"fmt"
-	"regexp"
+	"math"
 	"slices"
 	"strings"
-	"sync"
-	"sync/atomic"
+	"time"
 
+	"github.com/alecthomas/participle/v2/lexer"
 	. "github.com/emad-elsaid/boolexpr/internal"
 )
 
@@ -33,8 +34,61 @@ var (
 	// ErrorWrongDataType is returned when an operator is applied to operands of
 	// incompatible types, e.g. comparing a string with an int.
 	ErrorWrongDataType = errors.New("Wrong data type")
+	// ErrDivisionByZero is returned when the right operand of "/" or "%" is
+	// zero.
+	ErrDivisionByZero = errors.New("Division by zero")
+	// ErrOverflow is returned when the result of arithmetic does not fit its
+	// type: an int outside the range of int, or a float64 that would be
+	// infinite.
+	ErrOverflow = errors.New("Arithmetic overflow")
+	// ErrUnknownFunction is returned by [Parse] for a call to a function
+	// that doesn't exist.
+	ErrUnknownFunction = errors.New("Function not found")
+	// ErrArgumentCount is returned for a call to a function with too few or
+	// too many arguments.
+	ErrArgumentCount = errors.New("Wrong number of arguments")
+	// ErrInvalidFunction is returned by [Functions.Register] for a function
+	// that can't be called from an expression.
+	ErrInvalidFunction = errors.New("Invalid function")
+	// ErrUnknownOperator is returned by [Parse] for a comparison by an
+	// operator that is neither built in nor registered.
+	ErrUnknownOperator = errors.New("Operator not found")
+	// ErrInvalidOperator is returned by [Operators.Register] for an operator
+	// name that can't be used in an expression.
+	ErrInvalidOperator = errors.New("Invalid operator")
+	// ErrTooLarge is returned by [ToDNF] and [ToCNF] when the normal form
+	// would exceed the size limit given.
+	ErrTooLarge = errors.New("Expression too large")
 )
 
+// EvalError is returned by evaluation when a comparison, or a bare value used
+// as a condition, fails. It carries the source span of the failing node so the
+// caller can point at it; Start is the node's first character and End is just
+// past its last. The cause is wrapped, so errors.Is keeps matching
+// [ErrSymbolNotFound], [ErrorWrongDataType] or a symbol function's own error.
+type EvalError struct {
+	Start Position
+	End   Position
+	Err   error
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%d:%d: %v", e.Start.Line, e.Start.Column, e.Err)
+}
+
+func (e *EvalError) Unwrap() error { return e.Err }
+
+// newEvalError locates err at the node from start to end. An unknown result
+// is not an error, and is returned as is, as is the panic of a function,
+// already located at its call.
+func newEvalError(start, end lexer.Position, err error) error {
+	if err == errUnknown || errors.Is(err, errPanicked) {
+		return err
+	}
+
+	return &EvalError{Start: newPosition(start), End: newPosition(end), Err: err}
+}
+
 func newErrorDataTypeMismatch(op string, l, r any) error {
 	return fmt.Errorf("%w, Can't use %s on %v of type %T and %v of type %T",
 		ErrorWrongDataType,
@@ -49,31 +103,57 @@ func newErrorWrongDataType(op string, l any) error {
 
 // Eval parses the expression string s and evaluates it against syms in a
 // single call. It is a convenience wrapper around [Parse] followed by
-// [EvalExpression]. When the same expression is evaluated more than once,
-// prefer parsing it once with [Parse] and reusing the result.
-func Eval(s string, syms Symbols) (bool, error) {
-	ast, err := Parse(s)
+// [EvalExpression], both given opts. When the same expression is evaluated
+// more than once, prefer parsing it once with [Parse] and reusing the result.
+func Eval(s string, syms Symbols, opts ...Option) (bool, error) {
+	ast, err := Parse(s, opts...)
 	if err != nil {
 		return false, err
 	}
 
-	return EvalExpression(ast, syms)
+	return EvalExpression(ast, syms, opts...)
 }
 
 // EvalExpression evaluates an already-parsed [Expression] against syms and
 // returns the boolean result. A single parsed Expression may be evaluated
-// concurrently against different Symbols.
-func EvalExpression(e Expression, syms Symbols) (bool, error) {
+// concurrently against different Symbols, and options.
+func EvalExpression(e Expression, syms Symbols, opts ...Option) (bool, error) {
 	if e.e == nil {
 		return false, errors.New("EvalExpression called on zero-value Expression; use Parse to obtain a valid Expression")
 	}
-	return evalBoolExpr(e.e, syms)
+
+	syms = prefetch(context.Background(), e.e, withOptions(syms, opts, e.missing))
+
+	return knownResult(evalBoolExpr(e.e, syms))
+}
+
+// EvalExpressionContext is [EvalExpression] under ctx. Evaluation stops with
+// ctx.Err() once ctx is done, checked before each operand of "and" and "or",
+// and symbols are looked up under ctx: with GetContext when syms is a
+// [ContextSymbols], and function values taking a [context.Context] are called
+// with ctx. Plain Symbols work unchanged.
+func EvalExpressionContext(ctx context.Context, e Expression, syms Symbols, opts ...Option) (bool, error) {
+	if e.e == nil {
+		return false, errors.New("EvalExpressionContext called on zero-value Expression; use Parse to obtain a valid Expression")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	syms = prefetch(ctx, e.e, withContext(ctx, withOptions(syms, opts, e.missing)))
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return knownResult(evalBoolExpr(e.e, syms))
 }
 
 // evalBoolExpr evaluates the OR level: the leading AND-expression OR-ed with the
 // rest. It short-circuits as soon as one AND-expression is true.
 func evalBoolExpr(b *BoolExpr, syms Symbols) (bool, error) {
-	res, err := evalAndExpr(b.And, syms)
+	var k kleene
+	res, err := k.or(evalAndExpr(b.And, syms))
 	if err != nil {
 		return false, err
 	}
@@ -84,19 +164,26 @@ func evalBoolExpr(b *BoolExpr, syms Symbols) (bool, error) {
 			return true, nil
 		}
 
-		res, err = evalAndExpr(o.And, syms)
+		if err := contextErr(syms); err != nil {
+			return false, err
+		}
+
+		res, err = k.or(evalAndExpr(o.And, syms))
 		if err != nil {
 			return false, err
 		}
 	}
 
-	return res, nil
+	return k.result(res, true)
 }
 
 // evalAndExpr evaluates the AND level: the leading primary expression AND-ed
 // with the rest. It short-circuits as soon as one operand is false.
 func evalAndExpr(a AndExpr, syms Symbols) (bool, error) {
-	res, err := evalExpr(a.Expr, syms)
+	prefetchLevel(&a, syms)
+
+	var k kleene
+	res, err := k.and(evalExpr(a.Expr, syms))
 	if err != nil {
 		return false, err
 	}
@@ -107,48 +194,124 @@ func evalAndExpr(a AndExpr, syms Symbols) (bool, error) {
 			return false, nil
 		}
 
-		res, err = evalExpr(op.Expr, syms)
+		if err := contextErr(syms); err != nil {
+			return false, err
+		}
+
+		res, err = k.and(evalExpr(op.Expr, syms))
 		if err != nil {
 			return false, err
 		}
 	}
 
-	return res, nil
+	return k.result(res, false)
 }
 
 func evalExpr(b Expr, syms Symbols) (bool, error) {
 	switch e := b.(type) {
-	case Compare:
-		l, err := evalValue(e.Left, syms)
+	case *Compare:
+		res, err := evalCompare(e, syms)
 		if err != nil {
-			return false, err
+			return false, newEvalError(e.Pos, e.EndPos, err)
 		}
 
-		r, err := evalValue(e.Right, syms)
+		return res, nil
+	case *NullTest:
+		res, err := evalNullTest(e, syms)
 		if err != nil {
-			return false, err
+			return false, newEvalError(e.Pos, e.EndPos, err)
 		}
 
-		return evalComparisonOpVal(e.Op, l, r)
-	case BoolValue:
-		v, err := evalValue(e.Value, syms)
+		return res, nil
+	case *BoolValue:
+		res, err := evalBoolValue(e, syms)
 		if err != nil {
-			return false, err
+			return false, newEvalError(e.Value.Pos, e.Value.EndPos, err)
 		}
 
-		bv, ok := v.toBool()
-		if !ok {
-			return false, fmt.Errorf("%w, bare value must be bool, got %T", ErrorWrongDataType, v.toAny())
+		return res, nil
+	case *SubExpr:
+		return evalBoolExpr(&e.BoolExpr, syms)
+	case *NotExpr:
+		res, err := evalExpr(e.Expr, syms)
+		if err != nil {
+			return false, err
 		}
 
-		return bv, nil
-	case SubExpr:
-		return evalBoolExpr(&e.BoolExpr, syms)
+		return !res, nil
 	default:
 		return false, fmt.Errorf("Expr type is unhandled %T", b)
 	}
 }
 
+func evalCompare(e *Compare, syms Symbols) (bool, error) {
+	// Single values are evaluated here rather than through evalOperand, which
+	// saves copying their evalVal through another call on the hot path.
+	var (
+		l   evalVal
+		err error
+	)
+	if v := e.Left.Value(); v != nil {
+		l, err = evalValue(v, syms)
+	} else {
+		l, err = evalSum(&e.Left, syms)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if e.Op.In || e.Op.NotIn {
+		res, err := inEval(l, &e.Right, syms)
+		if err != nil {
+			return false, err
+		}
+
+		return res != e.Op.NotIn, nil
+	}
+
+	var r evalVal
+	if v := e.Right.Value(); v != nil {
+		r, err = evalValue(v, syms)
+	} else {
+		r, err = evalSum(&e.Right, syms)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if e.Op.Custom != "" {
+		return operatorEval(&e.Op, l, r, syms)
+	}
+
+	if l.isNull() || r.isNull() {
+		return nullCompare(e.Op, l, r, syms)
+	}
+
+	if e.Pattern != nil {
+		return literalPatternEval(e.Op, e.Pattern, l)
+	}
+
+	return evalComparisonOpVal(e.Op, l, r)
+}
+
+func evalBoolValue(e *BoolValue, syms Symbols) (bool, error) {
+	v, err := evalValue(&e.Value, syms)
+	if err != nil {
+		return false, err
+	}
+
+	if v.isNull() {
+		return nullCondition(syms)
+	}
+
+	bv, ok := v.toBool()
+	if !ok {
+		return false, fmt.Errorf("%w, bare value must be bool, got %T", ErrorWrongDataType, v.toAny())
+	}
+
+	return bv, nil
+}
+
 type evalKind uint8
 
 const (
@@ -156,6 +319,10 @@ const (
 	kindFloat64
 	kindInt
 	kindString
+	// kindTime and kindDuration hold nanoseconds in i: since 1970 for a
+	// time, as [time.Time.UnixNano] counts them.
+	kindTime
+	kindDuration
 	kindAny
 )
 
@@ -179,11 +346,49 @@ func (v evalVal) toAny() any {
 		return v.i
 	case kindString:
 		return v.s
+	case kindTime:
+		return time.Unix(0, int64(v.i)).UTC()
+	case kindDuration:
+		return time.Duration(v.i)
 	default:
 		return v.a
 	}
 }
 
+// timeVal returns t as an evalVal, or an error wrapping [ErrOverflow] when it
+// is out of the range of [time.Time.UnixNano].
+func timeVal(t time.Time) (evalVal, error) {
+	if t.Before(MinTime) || t.After(MaxTime) {
+		return evalVal{}, fmt.Errorf("%w, %v is out of range", ErrOverflow, t)
+	}
+
+	return evalVal{kind: kindTime, i: int(t.UnixNano())}, nil
+}
+
+func (v evalVal) toTime() (time.Time, bool) {
+	switch v.kind {
+	case kindTime:
+		return time.Unix(0, int64(v.i)), true
+	case kindAny:
+		t, ok := v.a.(time.Time)
+		return t, ok
+	default:
+		return time.Time{}, false
+	}
+}
+
+func (v evalVal) toDuration() (time.Duration, bool) {
+	switch v.kind {
+	case kindDuration:
+		return time.Duration(v.i), true
+	case kindAny:
+		d, ok := v.a.(time.Duration)
+		return d, ok
+	default:
+		return 0, false
+	}
+}
+
 func (v evalVal) toBool() (bool, bool) {
 	switch v.kind {
 	case kindBool:
@@ -244,7 +449,7 @@ func (v evalVal) toString() (string, bool) {
 	}
 }
 
-func evalValue(v Value, syms Symbols) (evalVal, error) {
+func evalValue(v *Value, syms Symbols) (evalVal, error) {
 	switch {
 	case v.Bool != nil:
 		return evalVal{kind: kindBool, b: bool(*v.Bool)}, nil
@@ -254,13 +459,31 @@ func evalValue(v Value, syms Symbols) (evalVal, error) {
 		return evalVal{kind: kindInt, i: *v.Int}, nil
 	case v.String != nil:
 		return evalVal{kind: kindString, s: *v.String}, nil
+	case v.Time != nil:
+		return evalVal{kind: kindTime, i: int(v.Time.UnixNano())}, nil
+	case v.Duration != nil:
+		return evalVal{kind: kindDuration, i: int(*v.Duration)}, nil
+	case v.Null:
+		return evalVal{kind: kindAny}, nil
 	case v.Symbol != nil:
-		val, err := syms.Get(*v.Symbol)
+		val, err := getSymbol(v, syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		r := evalVal{kind: kindAny, a: val}
+		traced(syms, v, r)
+		return r, nil
+	case v.Call != nil:
+		r, err := evalCall(v, syms)
 		if err != nil {
 			return evalVal{}, err
 		}
 
-		return evalVal{kind: kindAny, a: val}, nil
+		traced(syms, v, r)
+		return r, nil
+	case v.List != nil:
+		return evalVal{}, fmt.Errorf("%w, a list can only be the right operand of in or not in", ErrorWrongDataType)
 	default:
 		return evalVal{}, ErrValueDoesntHaveAnyVal
 	}
@@ -281,6 +504,20 @@ func evalComparisonOpVal(o ComparisonOp, l, r evalVal) (bool, error) {
 		return endsWithEval(l, r)
 	} else if o.Match {
 		return matchEval(l, r)
+	} else if o.IContains {
+		return icontainsEval(l, r)
+	} else if o.IStartsWith {
+		return istartsWithEval(l, r)
+	} else if o.IEndsWith {
+		return iendsWithEval(l, r)
+	} else if o.IMatch {
+		return imatchEval(l, r)
+	} else if o.EqualFold {
+		return equalFoldEval(l, r)
+	} else if o.Like {
+		return likeEval(l, r)
+	} else if o.Glob {
+		return globEval(l, r)
 	}
 
 	return evalCmpVal(o, l, r)
@@ -301,6 +538,13 @@ func evalCmpVal(o ComparisonOp, l, r evalVal) (bool, error) {
 	case kindString:
 		return cmpStrEval(o, l.s, r)
 
+	case kindTime:
+		lt, _ := l.toTime()
+		return cmpTimeEval(o, lt, r)
+
+	case kindDuration:
+		return cmpDurationEval(o, time.Duration(l.i), r)
+
 	default: // kindAny: resolved symbol value
 		switch lv := l.a.(type) {
 		case bool:
@@ -309,6 +553,10 @@ func evalCmpVal(o ComparisonOp, l, r evalVal) (bool, error) {
 			return cmpNumEval(o, l, r)
 		case string:
 			return cmpStrEval(o, lv, r)
+		case time.Time:
+			return cmpTimeEval(o, lv, r)
+		case time.Duration:
+			return cmpDurationEval(o, lv, r)
 		default:
 			return false, newErrorWrongDataType(opName(o), l.toAny())
 		}
@@ -359,9 +607,30 @@ func cmpStrEval(o ComparisonOp, l string, r evalVal) (bool, error) {
 	return applyCmpOrdered(o, l, rs)
 }
 
+// cmpTimeEval compares a time left operand against r as instants: times in
+// different locations are equal when they are the same instant.
+func cmpTimeEval(o ComparisonOp, l time.Time, r evalVal) (bool, error) {
+	rt, ok := r.toTime()
+	if !ok {
+		return false, newErrorDataTypeMismatch(opName(o), l, r.toAny())
+	}
+
+	return applyCmpOrdered(o, l.Compare(rt), 0)
+}
+
+// cmpDurationEval compares a duration left operand against r.
+func cmpDurationEval(o ComparisonOp, l time.Duration, r evalVal) (bool, error) {
+	rd, ok := r.toDuration()
+	if !ok {
+		return false, newErrorDataTypeMismatch(opName(o), l, r.toAny())
+	}
+
+	return applyCmpOrdered(o, l, rd)
+}
+
 func applyCmpBool(o ComparisonOp, l, r bool) (bool, error) {
 	switch {
-	case o.Eq || o.EqEq:
+	case o.Eq || o.EqEq || o.In:
 		return l == r, nil
 	case o.Neq:
 		return l != r, nil
@@ -372,7 +641,7 @@ func applyCmpBool(o ComparisonOp, l, r bool) (bool, error) {
 
 func applyCmpOrdered[T cmp.Ordered](o ComparisonOp, l, r T) (bool, error) {
 	switch {
-	case o.Eq || o.EqEq:
+	case o.Eq || o.EqEq || o.In:
 		return l == r, nil
 	case o.Neq:
 		return l != r, nil
@@ -413,6 +682,26 @@ func opName(o ComparisonOp) string {
 		return "ends_with"
 	case o.Match:
 		return "match"
+	case o.IContains:
+		return "icontains"
+	case o.IStartsWith:
+		return "istarts_with"
+	case o.IEndsWith:
+		return "iends_with"
+	case o.IMatch:
+		return "imatch"
+	case o.EqualFold:
+		return "equals_fold"
+	case o.Like:
+		return "like"
+	case o.Glob:
+		return "glob"
+	case o.In:
+		return "in"
+	case o.NotIn:
+		return "not in"
+	case o.Custom != "":
+		return o.Custom
 	default:
 		return "?"
 	}
@@ -474,6 +763,110 @@ func containsEval(l, r evalVal) (bool, error) {
 	}
 }
 
+// inEval reports whether l is a member of the right operand of "in". A list
+// literal is searched through its precomputed set when it only holds literals,
+// otherwise element by element with the same type rules as "=" (ints and floats
+// compare with each other). Any other right operand is evaluated and must be a
+// slice or string, making "x in tags" the same as "tags contains x".
+//
+// A null l is only in a list holding null. Under [MissingThreeValued] it is
+// unknown whether a null is in anything, or whether l is in a list without
+// it but holding null, as SQL has it.
+func inEval(l evalVal, o *Operand, syms Symbols) (bool, error) {
+	r := o.Value()
+	if r == nil || r.List == nil {
+		rv, err := evalOperand(o, syms)
+		if err != nil {
+			return false, err
+		}
+
+		if l.isNull() || rv.isNull() {
+			return nullCompare(ComparisonOp{In: true}, l, rv, syms)
+		}
+
+		return containsEval(rv, l)
+	}
+
+	if r.List.Set != nil && !l.isNull() {
+		return setContains(r.List.Set, l)
+	}
+
+	eq := ComparisonOp{In: true}
+	hasNull := false
+	for i := range r.List.Values {
+		rv, err := evalValue(&r.List.Values[i], syms)
+		if err != nil {
+			return false, err
+		}
+
+		if l.isNull() || rv.isNull() {
+			hasNull = hasNull || rv.isNull()
+			continue
+		}
+
+		found, err := evalCmpVal(eq, l, rv)
+		if err != nil {
+			return false, err
+		}
+
+		if found {
+			return true, nil
+		}
+	}
+
+	if missingMode(syms) == MissingThreeValued && (l.isNull() || hasNull) {
+		return false, errUnknown
+	}
+
+	return l.isNull() && hasNull, nil
+}
+
+// setContains looks l up in the hash set of a literal-only list. The set holds
+// one kind of literal, so a left operand of another kind is a type mismatch,
+// just as it would be for "=".
+func setContains(s *LiteralSet, l evalVal) (bool, error) {
+	if s.Ints != nil || s.Floats != nil {
+		if li, ok := l.toInt(); ok {
+			if _, ok := s.Ints[li]; ok {
+				return true, nil
+			}
+
+			_, ok := s.Floats[float64(li)]
+			return ok, nil
+		}
+
+		if lf, ok := l.toFloat(); ok {
+			if _, ok := s.Floats[lf]; ok {
+				return true, nil
+			}
+
+			// A whole float matches the equal int element, as in cmpNumEval.
+			if lf == math.Trunc(lf) && lf >= math.MinInt && lf < math.MaxInt {
+				_, ok := s.Ints[int(lf)]
+				return ok, nil
+			}
+
+			return false, nil
+		}
+	}
+
+	if s.Strings != nil {
+		if ls, ok := l.toString(); ok {
+			_, ok := s.Strings[ls]
+			return ok, nil
+		}
+	}
+
+	if s.Bools != nil {
+		if lb, ok := l.toBool(); ok {
+			_, ok := s.Bools[lb]
+			return ok, nil
+		}
+	}
+
+	return false, newErrorWrongDataType("in", l.toAny())
+}
+
 func startsWithEval(l, r evalVal) (bool, error) {
 	lv, rv, err := stringOperands("starts_with", l, r)
 	if err != nil {
@@ -492,26 +885,9 @@ func endsWithEval(l, r evalVal) (bool, error) {
 	return strings.HasSuffix(lv, rv), nil
 }
 
-// matchEval reports whether the left string matches the regular expression in
-// the right operand. Both operands must be strings; the pattern uses Go's
-// regexp (RE2) syntax. The match is unanchored, like [regexp.Regexp.MatchString].
-// Compiled patterns are cached so each distinct pattern is compiled only once.
-func matchEval(l, r evalVal) (bool, error) {
-	lv, rv, err := stringOperands("match", l, r)
-	if err != nil {
-		return false, err
-	}
-
-	re, err := compilePattern(rv)
-	if err != nil {
-		return false, fmt.Errorf("%w, invalid match pattern %q: %v", ErrorWrongDataType, rv, err)
-	}
-
-	return re.MatchString(lv), nil
-}
-
 // stringOperands extracts two string operands without boxing, returning a typed
-// error for the string-only operators (starts_with, ends_with, match).
+// error for the string-only operators (starts_with, ends_with, match and their
+// case-insensitive variants, like and glob).
 func stringOperands(op string, l, r evalVal) (string, string, error) {
 	lv, ok := l.toString()
 	if !ok {
@@ -525,34 +901,3 @@ func stringOperands(op string, l, r evalVal) (string, string, error) {
 
 	return lv, rv, nil
 }
-
-// matchCache memoizes compiled patterns so a regular expression is compiled
-// once per distinct pattern, not on every evaluation. Patterns may originate
-// from symbols, so the pattern string is only known at evaluation time; keying
-// the cache on it covers both literal and symbol-supplied patterns.
-// The cache is capped at matchCacheMax entries to bound memory growth when
-// patterns come from high-cardinality symbol values.
-var (
-	matchCache    sync.Map // map[string]*regexp.Regexp
-	matchCacheLen atomic.Int64
-)
-
-const matchCacheMax = 1024
-
-func compilePattern(pattern string) (*regexp.Regexp, error) {
-	if re, ok := matchCache.Load(pattern); ok {
-		return re.(*regexp.Regexp), nil
-	}
-
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, err
-	}
-
-	if matchCacheLen.Load() < matchCacheMax {
-		if _, loaded := matchCache.LoadOrStore(pattern, re); !loaded {
-			matchCacheLen.Add(1)
-		}
-	}
-	return re, nil
-}
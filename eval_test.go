@@ -1,570 +1,835 @@
 package boolexpr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestEval(t *testing.T) {
-	tcs := []struct {
-		input    string
-		expected bool
-		symbols  SymbolsMap
-	}{
-		{
-			input:    "x == 1",
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 1 },
-			},
-		},
-		{
-			input:    "x == 1",
-			expected: true,
-			symbols: map[string]any{
-				"x": 1,
-			},
-		},
-		{
-			input:    "x == 1",
-			expected: true,
-			symbols: map[string]any{
-				"x": 1.0,
-			},
-		},
-		{
-			input:    `x == "hello"`,
-			expected: true,
-			symbols: map[string]any{
-				"x": "hello",
-			},
-		},
-		{
-			input:    `x == "hello"`,
-			expected: false,
-			symbols: map[string]any{
-				"x": "world",
-			},
-		},
-		{
-			input:    `x == true`,
-			expected: true,
-			symbols: map[string]any{
-				"x": true,
-			},
-		},
-		{
-			input:    "x == 2",
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 1 },
-			},
-		},
-		{
-			input:    `x == "Hello"`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return "Hello" },
-			},
-		},
-		{
-			input:    `x == "Hello"`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return "World" },
-			},
-		},
-		{
-			input:    `x == 2`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 2.4 },
-			},
-		},
-		{
-			input:    `x == 2`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 2.0 },
-			},
-		},
-		{
-			input:    "x = 1",
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 1 },
-			},
-		},
-		{
-			input:    "x = 1",
-			expected: true,
-			symbols: map[string]any{
-				"x": 1,
-			},
-		},
-		{
-			input:    "x = 1",
-			expected: true,
-			symbols: map[string]any{
-				"x": 1.0,
-			},
-		},
-		{
-			input:    `x = "hello"`,
-			expected: true,
-			symbols: map[string]any{
-				"x": "hello",
-			},
-		},
-		{
-			input:    `x = "hello"`,
-			expected: false,
-			symbols: map[string]any{
-				"x": "world",
-			},
-		},
-		{
-			input:    `x = true`,
-			expected: true,
-			symbols: map[string]any{
-				"x": true,
-			},
-		},
-		{
-			input:    "x = 2",
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 1 },
-			},
-		},
-		{
-			input:    `x = "Hello"`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return "Hello" },
-			},
-		},
-		{
-			input:    `x = "Hello"`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return "World" },
-			},
-		},
-		{
-			input:    `x = 2`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 2.4 },
-			},
-		},
-		{
-			input:    `x = 2`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 2.0 },
-			},
-		},
-		{
-			input:    `x >= 10`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 11 },
-			},
-		},
-		{
-			input:    `x != 10`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 11 },
-			},
-		},
-		{
-			input:    `x <= 10`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 11 },
-			},
-		},
-		{
-			input:    "x = 1.0",
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 1.0 },
-			},
-		},
-		{
-			input:    "x = 1.1",
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 1.0 },
-			},
-		},
-		{
-			input:    "10 = 1.0 or 1.0 = 10 or 1.0 = 10.0 or 10.0 = 1.0",
-			expected: false,
-			symbols:  map[string]any{},
-		},
-		{
-			input:    "x = true",
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return true },
-			},
-		},
-		{
-			input:    "x = true",
-			expected: true,
-			symbols: map[string]any{
-				"x": func() (any, error) { return true, nil },
-			},
-		},
-		{
-			input:    `x >= 10 and y < 0`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 11 },
-				"y": func() any { return -1 },
-			},
-		},
-		{
-			input:    `x >= 10 and y < 0`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 11 },
-				"y": func() any { return 0 },
-			},
-		},
-		{
-			input:    `x >= 10 or y < 0`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 11 },
-				"y": func() any { return 0 },
-			},
-		},
-		{
-			input:    `x >= 10 or y < 0 or ( z = "hello" or z = "world" )`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 0 },
-				"y": func() any { return 0 },
-				"z": func() any { return "hello" },
-			},
-		},
-		{
-			input:    `x >= 10 or y < 0 or ( z = "hello" or z = "world" )`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 0 },
-				"y": func() any { return 0 },
-				"z": func() any { return "NO" },
-			},
-		},
-		{
-			input:    `x > y and y > z`,
-			expected: true,
-			symbols: map[string]any{
-				"x": func() any { return 10 },
-				"y": func() any { return 5 },
-				"z": func() any { return 2 },
-			},
-		},
-		{
-			input:    `x > y and y > z`,
-			expected: false,
-			symbols: map[string]any{
-				"x": func() any { return 10 },
-				"y": func() any { return 5 },
-				"z": func() any { return 6 },
-			},
-		},
-		{input: `1 = 1 && 2 = 2`, expected: true},
-		{input: `1 = 1 && 2 = 3`, expected: false},
-		{input: `1 = 2 || 2 = 2`, expected: true},
-		{input: `1 = 2 || 2 = 3`, expected: false},
-		{input: `1 = 1 && 2 = 2 || 3 = 4`, expected: true},
-		{input: `1 = 2 && 2 = 2 || ( 3 = 3 )`, expected: true},
-
-		// Operator precedence: "and" binds tighter than "or", matching Go.
-		// Each case below flips result if evaluated flat left-to-right
-		// (the previous behavior) instead of `a or (b and c)`, so they pin
-		// the precedence down. The parenthesized twin forces the flat reading
-		// and must give the opposite result.
-		{input: `true or false and false`, expected: true},      // true or (false and false)
-		{input: `( true or false ) and false`, expected: false}, // flat reading -> false
-		{input: `true or true and false`, expected: true},       // true or (true and false)
-		{input: `( true or true ) and false`, expected: false},
-		{input: `true and true or false and false`, expected: true}, // (T and T) or (F and F)
-		{input: `true and ( true or false ) and false`, expected: false},
-
-		{input: `1 > 0.9`, expected: true},
-		{input: `1.1 > 1`, expected: true},
-		{input: `1.1 > 1.0`, expected: true},
-		{input: `"AB" > "AA"`, expected: true},
-
-		{input: `1 >= 0.9`, expected: true},
-		{input: `1.1 >= 1`, expected: true},
-		{input: `1.1 >= 1.0`, expected: true},
-		{input: `"AB" >= "AA"`, expected: true},
-
-		{input: `0.9 < 1`, expected: true},
-		{input: `1 < 1.1`, expected: true},
-		{input: `1 < 1.1`, expected: true},
-		{input: `1.0 < 1.1`, expected: true},
-		{input: `"AA" < "AB"`, expected: true},
-
-		{input: `0.9 <= 1`, expected: true},
-		{input: `1 <= 1.1`, expected: true},
-		{input: `1 <= 1.1`, expected: true},
-		{input: `1.0 <= 1.1`, expected: true},
-		{input: `"AA" <= "AB"`, expected: true},
-
-		{input: `0.9 != 1`, expected: true},
-		{input: `1 != 1.1`, expected: true},
-		{input: `1 != 1.1`, expected: true},
-		{input: `1.0 != 1.1`, expected: true},
-		{input: `"AA" != "AB"`, expected: true},
-		{input: `true != false`, expected: true},
-
-		// bare bool value
-		{input: `true`, expected: true},
-		{input: `false`, expected: false},
-		{
-			input:    `x`,
-			expected: true,
-			symbols:  SymbolsMap{"x": true},
+// evalTests are shared by the tests of every way to evaluate an expression.
+var evalTests = []struct {
+	input    string
+	expected bool
+	symbols  SymbolsMap
+}{
+	{
+		input:    "x == 1",
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 1 },
 		},
-		{
-			input:    `x`,
-			expected: false,
-			symbols:  SymbolsMap{"x": false},
+	},
+	{
+		input:    "x == 1",
+		expected: true,
+		symbols: map[string]any{
+			"x": 1,
+		},
+	},
+	{
+		input:    "x == 1",
+		expected: true,
+		symbols: map[string]any{
+			"x": 1.0,
+		},
+	},
+	{
+		input:    `x == "hello"`,
+		expected: true,
+		symbols: map[string]any{
+			"x": "hello",
+		},
+	},
+	{
+		input:    `x == "hello"`,
+		expected: false,
+		symbols: map[string]any{
+			"x": "world",
+		},
+	},
+	{
+		input:    `x == true`,
+		expected: true,
+		symbols: map[string]any{
+			"x": true,
+		},
+	},
+	{
+		input:    "x == 2",
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 1 },
 		},
-		{
-			input:    `x and y`,
-			expected: true,
-			symbols:  SymbolsMap{"x": true, "y": true},
+	},
+	{
+		input:    `x == "Hello"`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return "Hello" },
+		},
+	},
+	{
+		input:    `x == "Hello"`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return "World" },
+		},
+	},
+	{
+		input:    `x == 2`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 2.4 },
+		},
+	},
+	{
+		input:    `x == 2`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 2.0 },
+		},
+	},
+	{
+		input:    "x = 1",
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 1 },
 		},
-		{
-			input:    `x and y = 1`,
-			expected: true,
-			symbols:  SymbolsMap{"x": true, "y": 1},
+	},
+	{
+		input:    "x = 1",
+		expected: true,
+		symbols: map[string]any{
+			"x": 1,
+		},
+	},
+	{
+		input:    "x = 1",
+		expected: true,
+		symbols: map[string]any{
+			"x": 1.0,
+		},
+	},
+	{
+		input:    `x = "hello"`,
+		expected: true,
+		symbols: map[string]any{
+			"x": "hello",
+		},
+	},
+	{
+		input:    `x = "hello"`,
+		expected: false,
+		symbols: map[string]any{
+			"x": "world",
+		},
+	},
+	{
+		input:    `x = true`,
+		expected: true,
+		symbols: map[string]any{
+			"x": true,
+		},
+	},
+	{
+		input:    "x = 2",
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 1 },
 		},
+	},
+	{
+		input:    `x = "Hello"`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return "Hello" },
+		},
+	},
+	{
+		input:    `x = "Hello"`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return "World" },
+		},
+	},
+	{
+		input:    `x = 2`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 2.4 },
+		},
+	},
+	{
+		input:    `x = 2`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 2.0 },
+		},
+	},
+	{
+		input:    `x >= 10`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 11 },
+		},
+	},
+	{
+		input:    `x != 10`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 11 },
+		},
+	},
+	{
+		input:    `x <= 10`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 11 },
+		},
+	},
+	{
+		input:    "x = 1.0",
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 1.0 },
+		},
+	},
+	{
+		input:    "x = 1.1",
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 1.0 },
+		},
+	},
+	{
+		input:    "10 = 1.0 or 1.0 = 10 or 1.0 = 10.0 or 10.0 = 1.0",
+		expected: false,
+		symbols:  map[string]any{},
+	},
+	{
+		input:    "x = true",
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return true },
+		},
+	},
+	{
+		input:    "x = true",
+		expected: true,
+		symbols: map[string]any{
+			"x": func() (any, error) { return true, nil },
+		},
+	},
+	{
+		input:    `x >= 10 and y < 0`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 11 },
+			"y": func() any { return -1 },
+		},
+	},
+	{
+		input:    `x >= 10 and y < 0`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 11 },
+			"y": func() any { return 0 },
+		},
+	},
+	{
+		input:    `x >= 10 or y < 0`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 11 },
+			"y": func() any { return 0 },
+		},
+	},
+	{
+		input:    `x >= 10 or y < 0 or ( z = "hello" or z = "world" )`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 0 },
+			"y": func() any { return 0 },
+			"z": func() any { return "hello" },
+		},
+	},
+	{
+		input:    `x >= 10 or y < 0 or ( z = "hello" or z = "world" )`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 0 },
+			"y": func() any { return 0 },
+			"z": func() any { return "NO" },
+		},
+	},
+	{
+		input:    `x > y and y > z`,
+		expected: true,
+		symbols: map[string]any{
+			"x": func() any { return 10 },
+			"y": func() any { return 5 },
+			"z": func() any { return 2 },
+		},
+	},
+	{
+		input:    `x > y and y > z`,
+		expected: false,
+		symbols: map[string]any{
+			"x": func() any { return 10 },
+			"y": func() any { return 5 },
+			"z": func() any { return 6 },
+		},
+	},
+	{input: `1 = 1 && 2 = 2`, expected: true},
+	{input: `1 = 1 && 2 = 3`, expected: false},
+	{input: `1 = 2 || 2 = 2`, expected: true},
+	{input: `1 = 2 || 2 = 3`, expected: false},
+	{input: `1 = 1 && 2 = 2 || 3 = 4`, expected: true},
+	{input: `1 = 2 && 2 = 2 || ( 3 = 3 )`, expected: true},
 
-		// contains: string contains substring
-		{input: `"hello world" contains "world"`, expected: true},
-		{input: `"hello world" contains "xyz"`, expected: false},
-		{input: `"hello world" contains ""`, expected: true},
+	// Operator precedence: "and" binds tighter than "or", matching Go.
+	// Each case below flips result if evaluated flat left-to-right
+	// (the previous behavior) instead of `a or (b and c)`, so they pin
+	// the precedence down. The parenthesized twin forces the flat reading
+	// and must give the opposite result.
+	{input: `true or false and false`, expected: true},      // true or (false and false)
+	{input: `( true or false ) and false`, expected: false}, // flat reading -> false
+	{input: `true or true and false`, expected: true},       // true or (true and false)
+	{input: `( true or true ) and false`, expected: false},
+	{input: `true and true or false and false`, expected: true}, // (T and T) or (F and F)
+	{input: `true and ( true or false ) and false`, expected: false},
 
-		// contains: []string variable contains a string literal
-		{
-			input:    `tags contains "go"`,
-			expected: true,
-			symbols:  SymbolsMap{"tags": []string{"go", "rust", "c"}},
-		},
-		{
-			input:    `tags contains "java"`,
-			expected: false,
-			symbols:  SymbolsMap{"tags": []string{"go", "rust", "c"}},
-		},
+	{input: `1 > 0.9`, expected: true},
+	{input: `1.1 > 1`, expected: true},
+	{input: `1.1 > 1.0`, expected: true},
+	{input: `"AB" > "AA"`, expected: true},
 
-		// contains: []int variable
-		{
-			input:    `ids contains 42`,
-			expected: true,
-			symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
-		},
-		{
-			input:    `ids contains 0`,
-			expected: false,
-			symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
-		},
-		// int/float64 cross-compatibility
-		{
-			input:    `ids contains 42.0`,
-			expected: true,
-			symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
-		},
-		{
-			input:    `ids contains 0.0`,
-			expected: false,
-			symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
-		},
-		// contains: []float64 variable
-		{
-			input:    `scores contains 3.0`,
-			expected: true,
-			symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
-		},
-		{
-			input:    `scores contains 2.0`,
-			expected: false,
-			symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
-		},
-		{
-			input:    `scores contains 3`,
-			expected: true,
-			symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
-		},
-		{
-			input:    `scores contains 2`,
-			expected: false,
-			symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
-		},
-		// contains: []bool variable
-		{
-			input:    `flags contains true`,
-			expected: true,
-			symbols:  SymbolsMap{"flags": []bool{false, true}},
-		},
-		{
-			input:    `flags contains true`,
-			expected: false,
-			symbols:  SymbolsMap{"flags": []bool{false, false}},
-		},
+	{input: `1 >= 0.9`, expected: true},
+	{input: `1.1 >= 1`, expected: true},
+	{input: `1.1 >= 1.0`, expected: true},
+	{input: `"AB" >= "AA"`, expected: true},
 
-		// excludes: negation of contains
-		{input: `"hello world" excludes "xyz"`, expected: true},
-		{input: `"hello world" excludes "world"`, expected: false},
-		{
-			input:    `tags excludes "java"`,
-			expected: true,
-			symbols:  SymbolsMap{"tags": []string{"go", "rust"}},
-		},
-		{
-			input:    `tags excludes "go"`,
-			expected: false,
-			symbols:  SymbolsMap{"tags": []string{"go", "rust"}},
-		},
-		{
-			input:    `ids excludes 0`,
-			expected: true,
-			symbols:  SymbolsMap{"ids": []int{1, 2, 3}},
-		},
-		{
-			input:    `ids excludes 1`,
-			expected: false,
-			symbols:  SymbolsMap{"ids": []int{1, 2, 3}},
-		},
-		{
-			input:    `scores excludes 9.9`,
-			expected: false,
-			symbols:  SymbolsMap{"scores": []float64{1.5, 9.9}},
-		},
-		{
-			input:    `scores excludes 2.0`,
-			expected: true,
-			symbols:  SymbolsMap{"scores": []float64{1.5, 9.9}},
-		},
-		{
-			input:    `flags excludes false`,
-			expected: true,
-			symbols:  SymbolsMap{"flags": []bool{true, true}},
-		},
-		{
-			input:    `flags excludes false`,
-			expected: false,
-			symbols:  SymbolsMap{"flags": []bool{true, false}},
-		},
+	{input: `0.9 < 1`, expected: true},
+	{input: `1 < 1.1`, expected: true},
+	{input: `1 < 1.1`, expected: true},
+	{input: `1.0 < 1.1`, expected: true},
+	{input: `"AA" < "AB"`, expected: true},
 
-		// starts_with
-		{input: `"hello world" starts_with "hello"`, expected: true},
-		{input: `"hello world" starts_with "world"`, expected: false},
-		{input: `"hello world" starts_with ""`, expected: true},
-		{
-			input:    `name starts_with "Jo"`,
-			expected: true,
-			symbols:  SymbolsMap{"name": "John"},
-		},
+	{input: `0.9 <= 1`, expected: true},
+	{input: `1 <= 1.1`, expected: true},
+	{input: `1 <= 1.1`, expected: true},
+	{input: `1.0 <= 1.1`, expected: true},
+	{input: `"AA" <= "AB"`, expected: true},
 
-		// ends_with
-		{input: `"hello world" ends_with "world"`, expected: true},
-		{input: `"hello world" ends_with "hello"`, expected: false},
-		{input: `"hello world" ends_with ""`, expected: true},
-		{
-			input:    `name ends_with "hn"`,
-			expected: true,
-			symbols:  SymbolsMap{"name": "John"},
-		},
+	{input: `0.9 != 1`, expected: true},
+	{input: `1 != 1.1`, expected: true},
+	{input: `1 != 1.1`, expected: true},
+	{input: `1.0 != 1.1`, expected: true},
+	{input: `"AA" != "AB"`, expected: true},
+	{input: `true != false`, expected: true},
 
-		// match
-		{input: `"pattern123" match "pattern.*"`, expected: true},
-		{input: `"abc" match "^abc$"`, expected: true},
-		{input: `"abcd" match "^abc$"`, expected: false},
-		{
-			input:    `x match "pattern.*"`,
-			expected: true,
-			symbols:  SymbolsMap{"x": "pattern123"},
-		},
-		{
-			input:    `email match pattern`,
-			expected: true,
-			symbols:  SymbolsMap{"email": "joanna@example.com", "pattern": `.+@example\.com$`},
-		},
-		{
-			input:    `x match p`,
-			expected: true,
-			symbols: SymbolsMap{
-				"x": func() string { return "foo42" },
-				"p": func() string { return "[0-9]+" },
-			},
-		},
+	// bare bool value
+	{input: `true`, expected: true},
+	{input: `false`, expected: false},
+	{
+		input:    `x`,
+		expected: true,
+		symbols:  SymbolsMap{"x": true},
+	},
+	{
+		input:    `x`,
+		expected: false,
+		symbols:  SymbolsMap{"x": false},
+	},
+	{
+		input:    `x and y`,
+		expected: true,
+		symbols:  SymbolsMap{"x": true, "y": true},
+	},
+	{
+		input:    `x and y = 1`,
+		expected: true,
+		symbols:  SymbolsMap{"x": true, "y": 1},
+	},
 
-		// Exact integer comparisons beyond 2^53, where float64 coercion would
-		// collapse distinct integers. 9007199254740992 is 2^53.
-		{
-			input:    `x = 9007199254740992`,
-			expected: false,
-			symbols:  SymbolsMap{"x": 9007199254740993},
-		},
-		{
-			input:    `x != 9007199254740992`,
-			expected: true,
-			symbols:  SymbolsMap{"x": 9007199254740993},
-		},
-		{
-			input:    `x > 9007199254740992`,
-			expected: true,
-			symbols:  SymbolsMap{"x": 9007199254740993},
-		},
-		{
-			input:    `x >= 9007199254740993`,
-			expected: true,
-			symbols:  SymbolsMap{"x": 9007199254740993},
-		},
-		{
-			input:    `x < 9007199254740994`,
-			expected: true,
-			symbols:  SymbolsMap{"x": 9007199254740993},
-		},
-		// Both operands are integer symbols just past 2^53.
-		{
-			input:    `x = y`,
-			expected: false,
-			symbols:  SymbolsMap{"x": 9007199254740993, "y": 9007199254740992},
-		},
-		// []int membership must use exact integer comparison.
-		{
-			input:    `ids contains 9007199254740992`,
-			expected: false,
-			symbols:  SymbolsMap{"ids": []int{9007199254740993}},
-		},
-		{
-			input:    `ids excludes 9007199254740992`,
-			expected: true,
-			symbols:  SymbolsMap{"ids": []int{9007199254740993}},
-		},
-		{
-			input:    `ids contains 9007199254740993`,
-			expected: true,
-			symbols:  SymbolsMap{"ids": []int{9007199254740993}},
-		},
-	}
+	// not / ! negation
+	{input: `not true`, expected: false},
+	{input: `!false`, expected: true},
+	{input: `not not true`, expected: true},
+	{input: `not 1 = 2`, expected: true},
+	{input: `not false and false`, expected: false}, // (not false) and false
+	{input: `not (false and false)`, expected: true},
+	{input: `false or !true`, expected: false},
+	{
+		input:    `not (role = "admin" or banned)`,
+		expected: true,
+		symbols:  SymbolsMap{"role": "user", "banned": false},
+	},
+	{
+		input:    `not (role = "admin" or banned)`,
+		expected: false,
+		symbols:  SymbolsMap{"role": "user", "banned": true},
+	},
+	{
+		input:    `!active`,
+		expected: false,
+		symbols:  SymbolsMap{"active": func() bool { return true }},
+	},
 
-	for _, tc := range tcs {
+	// contains: string contains substring
+	{input: `"hello world" contains "world"`, expected: true},
+	{input: `"hello world" contains "xyz"`, expected: false},
+	{input: `"hello world" contains ""`, expected: true},
+
+	// contains: []string variable contains a string literal
+	{
+		input:    `tags contains "go"`,
+		expected: true,
+		symbols:  SymbolsMap{"tags": []string{"go", "rust", "c"}},
+	},
+	{
+		input:    `tags contains "java"`,
+		expected: false,
+		symbols:  SymbolsMap{"tags": []string{"go", "rust", "c"}},
+	},
+
+	// contains: []int variable
+	{
+		input:    `ids contains 42`,
+		expected: true,
+		symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
+	},
+	{
+		input:    `ids contains 0`,
+		expected: false,
+		symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
+	},
+	// int/float64 cross-compatibility
+	{
+		input:    `ids contains 42.0`,
+		expected: true,
+		symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
+	},
+	{
+		input:    `ids contains 0.0`,
+		expected: false,
+		symbols:  SymbolsMap{"ids": []int{1, 42, 99}},
+	},
+	// contains: []float64 variable
+	{
+		input:    `scores contains 3.0`,
+		expected: true,
+		symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
+	},
+	{
+		input:    `scores contains 2.0`,
+		expected: false,
+		symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
+	},
+	{
+		input:    `scores contains 3`,
+		expected: true,
+		symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
+	},
+	{
+		input:    `scores contains 2`,
+		expected: false,
+		symbols:  SymbolsMap{"scores": []float64{1.5, 3.0, 9.9}},
+	},
+	// contains: []bool variable
+	{
+		input:    `flags contains true`,
+		expected: true,
+		symbols:  SymbolsMap{"flags": []bool{false, true}},
+	},
+	{
+		input:    `flags contains true`,
+		expected: false,
+		symbols:  SymbolsMap{"flags": []bool{false, false}},
+	},
+
+	// excludes: negation of contains
+	{input: `"hello world" excludes "xyz"`, expected: true},
+	{input: `"hello world" excludes "world"`, expected: false},
+	{
+		input:    `tags excludes "java"`,
+		expected: true,
+		symbols:  SymbolsMap{"tags": []string{"go", "rust"}},
+	},
+	{
+		input:    `tags excludes "go"`,
+		expected: false,
+		symbols:  SymbolsMap{"tags": []string{"go", "rust"}},
+	},
+	{
+		input:    `ids excludes 0`,
+		expected: true,
+		symbols:  SymbolsMap{"ids": []int{1, 2, 3}},
+	},
+	{
+		input:    `ids excludes 1`,
+		expected: false,
+		symbols:  SymbolsMap{"ids": []int{1, 2, 3}},
+	},
+	{
+		input:    `scores excludes 9.9`,
+		expected: false,
+		symbols:  SymbolsMap{"scores": []float64{1.5, 9.9}},
+	},
+	{
+		input:    `scores excludes 2.0`,
+		expected: true,
+		symbols:  SymbolsMap{"scores": []float64{1.5, 9.9}},
+	},
+	{
+		input:    `flags excludes false`,
+		expected: true,
+		symbols:  SymbolsMap{"flags": []bool{true, true}},
+	},
+	{
+		input:    `flags excludes false`,
+		expected: false,
+		symbols:  SymbolsMap{"flags": []bool{true, false}},
+	},
+
+	// in / not in: literal lists use the precomputed set
+	{input: `"DE" in ("DE", "FR", "NL")`, expected: true},
+	{input: `"US" in ("DE", "FR", "NL")`, expected: false},
+	{input: `"US" not in ("DE", "FR", "NL")`, expected: true},
+	{input: `true in (true)`, expected: true},
+	{input: `false in (true)`, expected: false},
+	{
+		input:    `country in ("DE", "FR", "NL")`,
+		expected: true,
+		symbols:  SymbolsMap{"country": "FR"},
+	},
+	{
+		input:    `status not in (404, 410)`,
+		expected: false,
+		symbols:  SymbolsMap{"status": 410},
+	},
+	{
+		input:    `status not in (404, 410)`,
+		expected: true,
+		symbols:  SymbolsMap{"status": 200},
+	},
+	// int/float64 cross-compatibility, as with "="
+	{input: `410.0 in (404, 410)`, expected: true},
+	{input: `410.5 in (404, 410)`, expected: false},
+	{input: `2 in (1.0, 2.0)`, expected: true},
+	{input: `2 in (1.5, 2.5)`, expected: false},
+	{input: `9007199254740993 in (9007199254740992)`, expected: false},
+	// lists holding symbols are scanned element by element
+	{
+		input:    `x in (1, y, 3.5)`,
+		expected: true,
+		symbols:  SymbolsMap{"x": 2, "y": func() int { return 2 }},
+	},
+	{
+		input:    `x in (1, y)`,
+		expected: true,
+		symbols:  SymbolsMap{"x": 2, "y": 2.0},
+	},
+	{
+		input:    `x not in ("a", y)`,
+		expected: false,
+		symbols:  SymbolsMap{"x": "b", "y": "b"},
+	},
+	// a non-list right operand is a membership test on a slice symbol
+	{
+		input:    `"go" in tags`,
+		expected: true,
+		symbols:  SymbolsMap{"tags": []string{"go", "rust"}},
+	},
+	{
+		input:    `id not in ids`,
+		expected: true,
+		symbols:  SymbolsMap{"id": 7, "ids": []int{1, 2}},
+	},
+	// parenthesized groups are still groups, not lists
+	{input: `(1 = 1)`, expected: true},
+	{input: `((1 = 1) and (true))`, expected: true},
+
+	// starts_with
+	{input: `"hello world" starts_with "hello"`, expected: true},
+	{input: `"hello world" starts_with "world"`, expected: false},
+	{input: `"hello world" starts_with ""`, expected: true},
+	{
+		input:    `name starts_with "Jo"`,
+		expected: true,
+		symbols:  SymbolsMap{"name": "John"},
+	},
+
+	// ends_with
+	{input: `"hello world" ends_with "world"`, expected: true},
+	{input: `"hello world" ends_with "hello"`, expected: false},
+	{input: `"hello world" ends_with ""`, expected: true},
+	{
+		input:    `name ends_with "hn"`,
+		expected: true,
+		symbols:  SymbolsMap{"name": "John"},
+	},
+
+	// match
+	{input: `"pattern123" match "pattern.*"`, expected: true},
+	{input: `"abc" match "^abc$"`, expected: true},
+	{input: `"abcd" match "^abc$"`, expected: false},
+	{
+		input:    `x match "pattern.*"`,
+		expected: true,
+		symbols:  SymbolsMap{"x": "pattern123"},
+	},
+	{
+		input:    `email match pattern`,
+		expected: true,
+		symbols:  SymbolsMap{"email": "joanna@example.com", "pattern": `.+@example\.com$`},
+	},
+	{
+		input:    `x match p`,
+		expected: true,
+		symbols: SymbolsMap{
+			"x": func() string { return "foo42" },
+			"p": func() string { return "[0-9]+" },
+		},
+	},
+
+	// case-insensitive variants
+	{input: `"Hello World" icontains "WORLD"`, expected: true},
+	{input: `"Hello World" icontains "planet"`, expected: false},
+	{input: `"Hello" icontains ""`, expected: true},
+	{input: `"ΣΊΣΥΦΟΣ" icontains "σίσυφος"`, expected: true},
+	{
+		input:    `tags icontains "GO" and not tags icontains "rus"`,
+		expected: true,
+		symbols:  SymbolsMap{"tags": []string{"c", "Go", "rust"}},
+	},
+	{input: `"Hello" istarts_with "hE"`, expected: true},
+	{input: `"Hello" istarts_with "ello"`, expected: false},
+	{input: `"Hello" iends_with "LLO"`, expected: true},
+	{input: `"Hello" iends_with "HELL"`, expected: false},
+	{input: `"Straße" equals_fold "STRASSE"`, expected: false},
+	{input: `"Straße" equals_fold "STRAßE"`, expected: true},
+	{
+		input:    `email equals_fold "Ada@Example.com"`,
+		expected: true,
+		symbols:  SymbolsMap{"email": "ada@example.COM"},
+	},
+	{input: `"Foo42" imatch "^foo[0-9]+$"`, expected: true},
+	{input: `"Foo42" match "^foo[0-9]+$"`, expected: false},
+	{
+		input:    `x imatch p`,
+		expected: true,
+		symbols:  SymbolsMap{"x": "ABC", "p": "b"},
+	},
+
+	// Exact integer comparisons beyond 2^53, where float64 coercion would
+	// collapse distinct integers. 9007199254740992 is 2^53.
+	{
+		input:    `x = 9007199254740992`,
+		expected: false,
+		symbols:  SymbolsMap{"x": 9007199254740993},
+	},
+	{
+		input:    `x != 9007199254740992`,
+		expected: true,
+		symbols:  SymbolsMap{"x": 9007199254740993},
+	},
+	{
+		input:    `x > 9007199254740992`,
+		expected: true,
+		symbols:  SymbolsMap{"x": 9007199254740993},
+	},
+	{
+		input:    `x >= 9007199254740993`,
+		expected: true,
+		symbols:  SymbolsMap{"x": 9007199254740993},
+	},
+	{
+		input:    `x < 9007199254740994`,
+		expected: true,
+		symbols:  SymbolsMap{"x": 9007199254740993},
+	},
+	// Both operands are integer symbols just past 2^53.
+	{
+		input:    `x = y`,
+		expected: false,
+		symbols:  SymbolsMap{"x": 9007199254740993, "y": 9007199254740992},
+	},
+	// []int membership must use exact integer comparison.
+	{
+		input:    `ids contains 9007199254740992`,
+		expected: false,
+		symbols:  SymbolsMap{"ids": []int{9007199254740993}},
+	},
+	{
+		input:    `ids excludes 9007199254740992`,
+		expected: true,
+		symbols:  SymbolsMap{"ids": []int{9007199254740993}},
+	},
+	{
+		input:    `ids contains 9007199254740993`,
+		expected: true,
+		symbols:  SymbolsMap{"ids": []int{9007199254740993}},
+	},
+
+	// paths into maps, slices and structs
+	{
+		input:    `items[0].sku = "A-1" and items[1].qty > 2`,
+		expected: true,
+		symbols: SymbolsMap{"items": []any{
+			map[string]any{"sku": "A-1", "qty": 1},
+			map[string]any{"sku": "B-2", "qty": 3},
+		}},
+	},
+	{
+		input:    `meta["x-key"] = "v" and meta.owner.name starts_with "jo"`,
+		expected: true,
+		symbols: SymbolsMap{"meta": map[string]any{
+			"x-key": "v",
+			"owner": map[string]any{"name": func() string { return "joanna" }},
+		}},
+	},
+	{
+		input:    `tags[1] = "go" and scores[0] < 2 and counts["b"] = 2`,
+		expected: true,
+		symbols: SymbolsMap{
+			"tags":   []string{"c", "go"},
+			"scores": []float64{1.5},
+			"counts": map[string]int32{"a": 1, "b": 2},
+		},
+	},
+	{
+		input:    `order.customer.tier = "gold" and order.lines[0].qty = 2 and order.total > 10`,
+		expected: true,
+		symbols:  SymbolsMap{"order": testOrder},
+	},
+	{
+		input:    `order.lines[1].sku in ("A", "B") and order.customer.tags contains "vip"`,
+		expected: true,
+		symbols:  SymbolsMap{"order": &testOrder},
+	},
+	{
+		input:    `x.flag`,
+		expected: true,
+		symbols:  SymbolsMap{"x": map[string]any{"flag": true}},
+	},
+
+	// arithmetic: ints stay exact, floats promote, "+" joins strings
+	{
+		input:    `price * quantity > 100 and end - start >= 3600`,
+		expected: true,
+		symbols:  SymbolsMap{"price": 12.5, "quantity": 10, "start": 100, "end": 3700},
+	},
+	{input: `1 + 2 * 3 = 7 and (1 + 2) * 3 = 9`, expected: true},
+	{input: `7 / 2 = 3 and 7.0 / 2 = 3.5 and 7 % 3 = 1 and -7 % 3 = -1`, expected: true},
+	{input: `10 - 4 - 3 = 3 and 24 / 4 / 2 = 3`, expected: true},
+	{input: `5.5 % 2 = 1.5`, expected: true},
+	{input: `-x = -3 and - -x = 3 and -(x - 5) = 2 and x -1 = 2`, expected: true, symbols: SymbolsMap{"x": 3}},
+	{input: `x + 1 = 9007199254740994`, expected: true, symbols: SymbolsMap{"x": 9007199254740993}},
+	{input: `x + 1 = 9007199254740993`, expected: false, symbols: SymbolsMap{"x": 9007199254740993}},
+	{input: `first + " " + last = "Ada Lovelace"`, expected: true, symbols: SymbolsMap{"first": "Ada", "last": "Lovelace"}},
+	{input: `x in (-1, 2)`, expected: true, symbols: SymbolsMap{"x": -1}},
+	{input: `tags contains "a" + "b"`, expected: true, symbols: SymbolsMap{"tags": []string{"ab"}}},
+	{input: `items[0].qty * items[0].price > 10`, expected: true, symbols: SymbolsMap{
+		"items": []any{map[string]any{"qty": 3, "price": 4.0}},
+	}},
+
+	// functions
+	{
+		input:    `lower(email) ends_with "@corp.com" and len(tags) > 2`,
+		expected: true,
+		symbols:  SymbolsMap{"email": "Ada@CORP.com", "tags": []string{"a", "b", "c"}},
+	},
+	{input: `len("héllo") = 5 and len("") = 0`, expected: true},
+	{input: `upper(trim("  go ")) = "GO" and lower(s + "X") = "ax"`, expected: true, symbols: SymbolsMap{"s": "A"}},
+	{
+		input:    `len(ids) = 2 and len(scores) = 1 and len(flags) = 0 and len(items) = 3 and len(counts) = 1`,
+		expected: true,
+		symbols: SymbolsMap{
+			"ids":    func() []int { return []int{1, 2} },
+			"scores": []float64{1.5},
+			"flags":  []bool{},
+			"items":  []any{1, "a", true},
+			"counts": map[string]int32{"a": 1},
+		},
+	},
+	{input: `len(order.lines) = 2`, expected: true, symbols: SymbolsMap{"order": testOrder}},
+	{input: `abs(-3) = 3 and abs(2.5) = 2.5 and abs(x - 10) < 2`, expected: true, symbols: SymbolsMap{"x": 9}},
+	{input: `round(2.5) = 3 and round(-2.5) = -3 and floor(2.7) = 2 and ceil(2.1) = 3 and floor(-2.5) = -3`, expected: true},
+	{input: `round(x) = 9007199254740993`, expected: true, symbols: SymbolsMap{"x": 9007199254740993}},
+	{input: `min(3, 1, 2) = 1 and max(3, 1, 2) = 3 and min(7) = 7`, expected: true},
+	{input: `min(1, 2.5) = 1.0 and max(1, 2.5) = 2.5`, expected: true},
+	{input: `max(x, 9007199254740992) = 9007199254740993`, expected: true, symbols: SymbolsMap{"x": 9007199254740993}},
+	{input: `max(a - b, 0) = 0 and min(abs(a), b) = 3`, expected: true, symbols: SymbolsMap{"a": 3, "b": 5}},
+	{input: `name in (lower("ADA"), "bob")`, expected: true, symbols: SymbolsMap{"name": "ada"}},
+
+	// times and durations
+	{
+		input:    `created_at > 2024-01-01T00:00:00Z and created_at < 2024-02-01`,
+		expected: true,
+		symbols:  SymbolsMap{"created_at": time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+	},
+	{
+		input:    `created_at = 2024-01-15T14:00:00+02:00 and created_at != 2024-01-15T14:00:00Z`,
+		expected: true,
+		symbols:  SymbolsMap{"created_at": func() time.Time { return time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC) }},
+	},
+	{
+		input:    `age_of_account >= 30d and age_of_account < 1000h`,
+		expected: true,
+		symbols:  SymbolsMap{"age_of_account": func() (time.Duration, error) { return 31 * 24 * time.Hour, nil }},
+	},
+	{input: `90m = 1h30m and 7d = 168h and 1.5h = 90m and -1h30m < 0s and 1d12h = 36h`, expected: true},
+	{input: `500ms < 1s and 1µs = 1000ns and 1us = 1µs`, expected: true},
+	{
+		input:    `created_at + 7d > 2024-01-20 and 2024-01-22 - created_at = 6d12h and created_at - 12h = 2024-01-15`,
+		expected: true,
+		symbols:  SymbolsMap{"created_at": time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+	},
+	{input: `2024-03-01 - 2024-02-01 = 29d and 1h + 2024-01-01 = 2024-01-01T01:00:00Z`, expected: true},
+	{
+		input:    `timeout * 2 = 1m and timeout / 3 = 10s and 2 * timeout = 60s and -timeout = -30s and timeout - 30s = 0s`,
+		expected: true,
+		symbols:  SymbolsMap{"timeout": 30 * time.Second},
+	},
+	{input: `d in (2024-01-01, 2024-06-01T02:00:00+02:00)`, expected: true, symbols: SymbolsMap{"d": time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}},
+	{input: `ttl not in (1h, 2h)`, expected: true, symbols: SymbolsMap{"ttl": 90 * time.Minute}},
+	{input: `2024-01-01 > 2023-12-31T23:59:59.999999999Z`, expected: true},
+}
+
+type pathTier string
+
+type pathCustomer struct {
+	Tier pathTier
+	Tags []string
+}
+
+type pathLine struct {
+	SKU string `boolexpr:"sku"`
+	Qty uint8
+}
+
+type pathOrder struct {
+	Customer *pathCustomer
+	Lines    []pathLine
+}
+
+func (o pathOrder) Total() float32 { return 12.5 }
+
+var testOrder = pathOrder{
+	Customer: &pathCustomer{Tier: "gold", Tags: []string{"vip"}},
+	Lines:    []pathLine{{SKU: "C", Qty: 2}, {SKU: "B", Qty: 1}},
+}
+
+func TestEval(t *testing.T) {
+	for _, tc := range evalTests {
 		tc := tc
 		t.Run(fmt.Sprintf("%s -> %t", tc.input, tc.expected), func(t *testing.T) {
 			output, err := Eval(tc.input, tc.symbols)
@@ -574,118 +839,240 @@ func TestEval(t *testing.T) {
 	}
 }
 
-func TestEvalErrors(t *testing.T) {
-	tcs := []struct {
-		input    string
-		expected error
-		symbols  SymbolsMap
-	}{
-		{
-			input: "> y",
-			symbols: map[string]any{
-				"y": func() any { return 5 },
-			},
-		},
-		{
-			input:    "x != true or y < 0",
-			expected: ErrSymbolNotFound,
-			symbols: map[string]any{
-				"x": func() any { return true },
-			},
-		},
-		{
-			input:    "x = x and ( x > y )",
-			expected: ErrSymbolNotFound,
-			symbols: map[string]any{
-				"x": func() any { return 5 },
-			},
-		},
-		{
-			input:    "x = x and ( x > y )",
-			expected: io.ErrShortBuffer,
-			symbols: map[string]any{
-				"x": func() (any, error) { return 5, io.ErrShortBuffer },
-			},
-		},
+// evalErrorTests are the failing counterpart of evalTests.
+var evalErrorTests = []struct {
+	input    string
+	expected error
+	symbols  SymbolsMap
+}{
+	{
+		input: "> y",
+		symbols: map[string]any{
+			"y": func() any { return 5 },
+		},
+	},
+	{
+		input:    "x != true or y < 0",
+		expected: ErrSymbolNotFound,
+		symbols: map[string]any{
+			"x": func() any { return true },
+		},
+	},
+	{
+		input:    "x = x and ( x > y )",
+		expected: ErrSymbolNotFound,
+		symbols: map[string]any{
+			"x": func() any { return 5 },
+		},
+	},
+	{
+		input:    "x = x and ( x > y )",
+		expected: io.ErrShortBuffer,
+		symbols: map[string]any{
+			"x": func() (any, error) { return 5, io.ErrShortBuffer },
+		},
+	},
 
-		{input: `1 = "hello"`, expected: ErrorWrongDataType},
-		{input: `1 > "hello"`, expected: ErrorWrongDataType},
-		{input: `1 >= "hello"`, expected: ErrorWrongDataType},
-		{input: `1 < "hello"`, expected: ErrorWrongDataType},
-		{input: `1 <= "hello"`, expected: ErrorWrongDataType},
-		{input: `1 != "hello"`, expected: ErrorWrongDataType},
+	{input: `1 = "hello"`, expected: ErrorWrongDataType},
+	{input: `1 > "hello"`, expected: ErrorWrongDataType},
+	{input: `1 >= "hello"`, expected: ErrorWrongDataType},
+	{input: `1 < "hello"`, expected: ErrorWrongDataType},
+	{input: `1 <= "hello"`, expected: ErrorWrongDataType},
+	{input: `1 != "hello"`, expected: ErrorWrongDataType},
 
-		{input: `1.0 = "hello"`, expected: ErrorWrongDataType},
-		{input: `1.0 > "hello"`, expected: ErrorWrongDataType},
-		{input: `1.0 >= "hello"`, expected: ErrorWrongDataType},
-		{input: `1.0 < "hello"`, expected: ErrorWrongDataType},
-		{input: `1.0 <= "hello"`, expected: ErrorWrongDataType},
-		{input: `1.0 != "hello"`, expected: ErrorWrongDataType},
+	{input: `1.0 = "hello"`, expected: ErrorWrongDataType},
+	{input: `1.0 > "hello"`, expected: ErrorWrongDataType},
+	{input: `1.0 >= "hello"`, expected: ErrorWrongDataType},
+	{input: `1.0 < "hello"`, expected: ErrorWrongDataType},
+	{input: `1.0 <= "hello"`, expected: ErrorWrongDataType},
+	{input: `1.0 != "hello"`, expected: ErrorWrongDataType},
 
-		{input: `"hello" = 1`, expected: ErrorWrongDataType},
-		{input: `"hello" > 1`, expected: ErrorWrongDataType},
-		{input: `"hello" >= 1`, expected: ErrorWrongDataType},
-		{input: `"hello" < 1`, expected: ErrorWrongDataType},
-		{input: `"hello" <= 1`, expected: ErrorWrongDataType},
-		{input: `"hello" != 1`, expected: ErrorWrongDataType},
+	{input: `"hello" = 1`, expected: ErrorWrongDataType},
+	{input: `"hello" > 1`, expected: ErrorWrongDataType},
+	{input: `"hello" >= 1`, expected: ErrorWrongDataType},
+	{input: `"hello" < 1`, expected: ErrorWrongDataType},
+	{input: `"hello" <= 1`, expected: ErrorWrongDataType},
+	{input: `"hello" != 1`, expected: ErrorWrongDataType},
 
-		{input: `true = 1`, expected: ErrorWrongDataType},
-		{input: `true != 1`, expected: ErrorWrongDataType},
+	{input: `true = 1`, expected: ErrorWrongDataType},
+	{input: `true != 1`, expected: ErrorWrongDataType},
 
-		// bare non-bool value
-		{
-			input:    `x`,
-			expected: ErrorWrongDataType,
-			symbols:  SymbolsMap{"x": 42},
-		},
+	// bare non-bool value
+	{
+		input:    `x`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"x": 42},
+	},
 
-		// excludes: type mismatch propagates from containsEval. The result must
-		// stay false on error — excludes negates containsEval, so a careless
-		// error path would flip false into true.
-		{input: `1 excludes "x"`, expected: ErrorWrongDataType},
-		{
-			input:    `tags excludes 1`,
-			expected: ErrorWrongDataType,
-			symbols:  SymbolsMap{"tags": []string{"a"}},
-		},
+	// excludes: type mismatch propagates from containsEval. The result must
+	// stay false on error — excludes negates containsEval, so a careless
+	// error path would flip false into true.
+	{input: `1 excludes "x"`, expected: ErrorWrongDataType},
+	{
+		input:    `tags excludes 1`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"tags": []string{"a"}},
+	},
 
-		// contains: type mismatches
-		{input: `1 contains "x"`, expected: ErrorWrongDataType},
-		{input: `"hello" contains 1`, expected: ErrorWrongDataType},
-		{
-			input:    `scores contains "x"`,
-			expected: ErrorWrongDataType,
-			symbols:  SymbolsMap{"scores": []float64{1.5, 3.0}},
-		},
-		{
-			input:    `tags contains 1`,
-			expected: ErrorWrongDataType,
-			symbols:  SymbolsMap{"tags": []string{"a", "b"}},
-		},
-		{
-			input:    `ids contains "x"`,
-			expected: ErrorWrongDataType,
-			symbols:  SymbolsMap{"ids": []int{1, 2}},
-		},
-		{
-			input:    `flags contains 1`,
-			expected: ErrorWrongDataType,
-			symbols:  SymbolsMap{"flags": []bool{true, false}},
-		},
+	// not: errors propagate and are never negated into true
+	{input: `not 1 = "x"`, expected: ErrorWrongDataType},
+	{input: `!x`, expected: ErrSymbolNotFound},
+	{
+		input:    `not x`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"x": "yes"},
+	},
 
-		// starts_with / ends_with type mismatches
-		{input: `1 starts_with "x"`, expected: ErrorWrongDataType},
-		{input: `"hello" starts_with 1`, expected: ErrorWrongDataType},
-		{input: `1 ends_with "x"`, expected: ErrorWrongDataType},
-		{input: `"hello" ends_with 1`, expected: ErrorWrongDataType},
+	// case-insensitive variants: type mismatches and invalid patterns
+	{input: `1 icontains "x"`, expected: ErrorWrongDataType},
+	{input: `"x" istarts_with 1`, expected: ErrorWrongDataType},
+	{input: `"x" iends_with true`, expected: ErrorWrongDataType},
+	{input: `1 equals_fold 1`, expected: ErrorWrongDataType},
+	{input: `"x" imatch "("`, expected: ErrorWrongDataType},
+	{
+		input:    `ids icontains 1`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"ids": []int{1}},
+	},
+	{
+		input:    `tags icontains 1`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"tags": []string{"a"}},
+	},
 
-		// match type mismatches and invalid pattern
-		{input: `1 match "x"`, expected: ErrorWrongDataType},
-		{input: `"hello" match 1`, expected: ErrorWrongDataType},
-		{input: `"hello" match "("`, expected: ErrorWrongDataType},
-	}
+	// contains: type mismatches
+	{input: `1 contains "x"`, expected: ErrorWrongDataType},
+	{input: `"hello" contains 1`, expected: ErrorWrongDataType},
+	{
+		input:    `scores contains "x"`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"scores": []float64{1.5, 3.0}},
+	},
+	{
+		input:    `tags contains 1`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"tags": []string{"a", "b"}},
+	},
+	{
+		input:    `ids contains "x"`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"ids": []int{1, 2}},
+	},
+	{
+		input:    `flags contains 1`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"flags": []bool{true, false}},
+	},
 
-	for _, tc := range tcs {
+	// in / not in type mismatches, for both the set and the scan
+	{input: `"a" in (1, 2)`, expected: ErrorWrongDataType},
+	{input: `1 not in ("a", "b")`, expected: ErrorWrongDataType},
+	{input: `true in (1)`, expected: ErrorWrongDataType},
+	{
+		input:    `x in (1, y)`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"x": 2, "y": "b"},
+	},
+	{
+		input:    `x not in (1, y)`,
+		expected: ErrSymbolNotFound,
+		symbols:  SymbolsMap{"x": 2},
+	},
+	{
+		input:    `tags in (1, 2)`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"tags": []string{"a"}},
+	},
+
+	// starts_with / ends_with type mismatches
+	{input: `1 starts_with "x"`, expected: ErrorWrongDataType},
+	{input: `"hello" starts_with 1`, expected: ErrorWrongDataType},
+	{input: `1 ends_with "x"`, expected: ErrorWrongDataType},
+	{input: `"hello" ends_with 1`, expected: ErrorWrongDataType},
+
+	// match type mismatches and invalid pattern
+	{input: `1 match "x"`, expected: ErrorWrongDataType},
+	{input: `"hello" match 1`, expected: ErrorWrongDataType},
+	{input: `"hello" match "("`, expected: ErrorWrongDataType},
+
+	// arithmetic errors
+	{input: `1 / 0 = 1`, expected: ErrDivisionByZero},
+	{input: `1 % 0 = 1`, expected: ErrDivisionByZero},
+	{input: `1.5 / 0 = 1`, expected: ErrDivisionByZero},
+	{input: `x / y > 1`, expected: ErrDivisionByZero, symbols: SymbolsMap{"x": 1, "y": 0.0}},
+	{input: `9223372036854775807 + 1 > 0`, expected: ErrOverflow},
+	{input: `-9223372036854775807 - 2 < 0`, expected: ErrOverflow},
+	{input: `4611686018427387904 * 2 > 0`, expected: ErrOverflow},
+	{input: `-9223372036854775808 * -1 > 0`, expected: ErrOverflow},
+	{input: `-9223372036854775808 / -1 > 0`, expected: ErrOverflow},
+	{input: `-x > 0`, expected: ErrOverflow, symbols: SymbolsMap{"x": math.MinInt}},
+	{input: `1e308 * 10 > 0`, expected: ErrOverflow},
+	{input: `"a" + 1 = "a1"`, expected: ErrorWrongDataType},
+	{input: `"a" - "b" = ""`, expected: ErrorWrongDataType},
+	{input: `-s = 1`, expected: ErrorWrongDataType, symbols: SymbolsMap{"s": "a"}},
+	{input: `true + 1 = 2`, expected: ErrorWrongDataType},
+	{input: `x + 1 = 2`, expected: ErrSymbolNotFound},
+
+	// paths that lead nowhere
+	{
+		input:    `items[2] = 1`,
+		expected: ErrSymbolNotFound,
+		symbols:  SymbolsMap{"items": []int{1, 2}},
+	},
+	{
+		input:    `meta.missing = 1`,
+		expected: ErrSymbolNotFound,
+		symbols:  SymbolsMap{"meta": map[string]any{}},
+	},
+	{
+		input:    `meta.a.b = 1`,
+		expected: ErrSymbolNotFound,
+		symbols:  SymbolsMap{"meta": map[string]any{"a": nil}},
+	},
+	{
+		input:    `order.nope = 1`,
+		expected: ErrSymbolNotFound,
+		symbols:  SymbolsMap{"order": testOrder},
+	},
+	{
+		input:    `x.y = 1`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"x": 5},
+	},
+	{
+		input:    `x[0] = 1`,
+		expected: ErrorWrongDataType,
+		symbols:  SymbolsMap{"x": map[string]any{"0": 1}},
+	},
+
+	// functions applied to values of the wrong kind
+	{input: `len(x) > 1`, expected: ErrorWrongDataType, symbols: SymbolsMap{"x": 5}},
+	{input: `lower(x) = "a"`, expected: ErrorWrongDataType, symbols: SymbolsMap{"x": 5}},
+	{input: `abs(s) = 1`, expected: ErrorWrongDataType, symbols: SymbolsMap{"s": "a"}},
+	{input: `round(b) = 1`, expected: ErrorWrongDataType, symbols: SymbolsMap{"b": true}},
+	{input: `max(1, s) = 1`, expected: ErrorWrongDataType, symbols: SymbolsMap{"s": "a"}},
+	{input: `abs(x) > 0`, expected: ErrOverflow, symbols: SymbolsMap{"x": math.MinInt}},
+	{input: `len(x) > 0`, expected: ErrSymbolNotFound},
+	{input: `min(1, 2 / x) = 1`, expected: ErrDivisionByZero, symbols: SymbolsMap{"x": 0}},
+
+	// times and durations of the wrong kind, or out of range
+	{input: `t > 1`, expected: ErrorWrongDataType, symbols: SymbolsMap{"t": time.Now()}},
+	{input: `1h > 1`, expected: ErrorWrongDataType},
+	{input: `1 < 1h`, expected: ErrorWrongDataType},
+	{input: `2024-01-01 = "2024-01-01"`, expected: ErrorWrongDataType},
+	{input: `2024-01-01 + 2024-01-01 > 2024-01-01`, expected: ErrorWrongDataType},
+	{input: `1h - 2024-01-01 > 2024-01-01`, expected: ErrorWrongDataType},
+	{input: `1h * 1h > 1h`, expected: ErrorWrongDataType},
+	{input: `1h * 1.5 > 1h`, expected: ErrorWrongDataType},
+	{input: `2024-01-01 contains 1h`, expected: ErrorWrongDataType},
+	{input: `1h / 0 > 0s`, expected: ErrDivisionByZero},
+	{input: `2262-01-01 + 1000d > 2024-01-01`, expected: ErrOverflow},
+	{input: `t - 1h < 2024-01-01`, expected: ErrOverflow, symbols: SymbolsMap{"t": time.Time{}}},
+	{input: `-d < 0s`, expected: ErrOverflow, symbols: SymbolsMap{"d": time.Duration(math.MinInt64)}},
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, tc := range evalErrorTests {
 		tc := tc
 		t.Run(fmt.Sprintf("%s -> %s", tc.input, tc.expected), func(t *testing.T) {
 			output, err := Eval(tc.input, tc.symbols)
@@ -716,6 +1103,20 @@ func TestEvalShortCircuit(t *testing.T) {
 		assert.Equal(t, expected, actual)
 	})
 
+	t.Run("short circuit through not", func(t *testing.T) {
+		symbols := map[string]any{
+			"x": func() any { return true },
+			"y": func() any {
+				t.Error("y is called while it shouldn't")
+				return true
+			},
+		}
+
+		actual, err := Eval(`not x and not y`, SymbolsMap(symbols))
+		assert.NoError(t, err)
+		assert.False(t, actual)
+	})
+
 	t.Run("short circuit or", func(t *testing.T) {
 		input := `x = 0 or y = 0`
 		expected := true
@@ -732,3 +1133,202 @@ func TestEvalShortCircuit(t *testing.T) {
 		assert.Equal(t, expected, actual)
 	})
 }
+
+func TestEvalErrorSpan(t *testing.T) {
+	tcs := []struct {
+		input      string
+		start, end Position
+		symbols    SymbolsMap
+		expected   error
+	}{
+		{
+			input:    `x = 1 and y > "a"`,
+			start:    Position{Offset: 10, Line: 1, Column: 11},
+			end:      Position{Offset: 17, Line: 1, Column: 18},
+			symbols:  SymbolsMap{"x": 1, "y": 2},
+			expected: ErrorWrongDataType,
+		},
+		{
+			input:    "x = 1 and\n  (z  = 2  ) ",
+			start:    Position{Offset: 13, Line: 2, Column: 4},
+			end:      Position{Offset: 19, Line: 2, Column: 10},
+			symbols:  SymbolsMap{"x": 1},
+			expected: ErrSymbolNotFound,
+		},
+		{
+			input:    `not (a or b)`,
+			start:    Position{Offset: 10, Line: 1, Column: 11},
+			end:      Position{Offset: 11, Line: 1, Column: 12},
+			symbols:  SymbolsMap{"a": false, "b": 3},
+			expected: ErrorWrongDataType,
+		},
+		{
+			input:    `x = 1 and items[2].sku = "a"`,
+			start:    Position{Offset: 10, Line: 1, Column: 11},
+			end:      Position{Offset: 28, Line: 1, Column: 29},
+			symbols:  SymbolsMap{"x": 1, "items": []any{}},
+			expected: ErrSymbolNotFound,
+		},
+		{
+			input:    `len(s) = 1 or upper(n) = "A"`,
+			start:    Position{Offset: 14, Line: 1, Column: 15},
+			end:      Position{Offset: 28, Line: 1, Column: 29},
+			symbols:  SymbolsMap{"s": "ab", "n": 1},
+			expected: ErrorWrongDataType,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Eval(tc.input, tc.symbols)
+			assert.ErrorIs(t, err, tc.expected)
+
+			var eerr *EvalError
+			require.True(t, errors.As(err, &eerr), "expected an *EvalError, got %T", err)
+			assert.Equal(t, tc.start, eerr.Start)
+			assert.Equal(t, tc.end, eerr.End)
+		})
+	}
+}
+
+// ctxKey keys the value contextSymbols reads from the context.
+type ctxKey struct{}
+
+// contextSymbols is a ContextSymbols whose symbols are the value under
+// ctxKey, and which counts its calls of Get.
+type contextSymbols struct {
+	gets int
+}
+
+func (s *contextSymbols) Get(key string) (any, error) {
+	s.gets++
+	return nil, fmt.Errorf("Symbol: %s, %w", key, ErrSymbolNotFound)
+}
+
+func (s *contextSymbols) GetContext(ctx context.Context, key string) (any, error) {
+	v, ok := ctx.Value(ctxKey{}).(map[string]any)[key]
+	if !ok {
+		return nil, fmt.Errorf("Symbol: %s, %w", key, ErrSymbolNotFound)
+	}
+
+	return v, nil
+}
+
+func TestEvalExpressionContext(t *testing.T) {
+	exp, err := Parse(`x = 1 and (y = 2 or z = 3)`)
+	require.NoError(t, err)
+
+	p, err := Compile(exp)
+	require.NoError(t, err)
+
+	evals := map[string]func(context.Context, Symbols) (bool, error){
+		"eval": func(ctx context.Context, syms Symbols) (bool, error) {
+			return EvalExpressionContext(ctx, exp, syms)
+		},
+		"compiled": p.EvalContext,
+	}
+
+	for name, eval := range evals {
+		t.Run(name, func(t *testing.T) {
+			t.Run("plain symbols", func(t *testing.T) {
+				res, err := eval(context.Background(), SymbolsMap{"x": 1, "y": 0, "z": 3})
+				require.NoError(t, err)
+				assert.True(t, res)
+			})
+
+			t.Run("context symbols", func(t *testing.T) {
+				var syms contextSymbols
+				ctx := context.WithValue(context.Background(), ctxKey{}, map[string]any{"x": 1, "y": 2})
+
+				res, err := eval(ctx, &syms)
+				require.NoError(t, err)
+				assert.True(t, res)
+				assert.Zero(t, syms.gets)
+			})
+
+			t.Run("context functions", func(t *testing.T) {
+				ctx := context.WithValue(context.Background(), ctxKey{}, 2)
+				syms := SymbolsMap{
+					"x": func(ctx context.Context) (int, error) { return 1, nil },
+					"y": func(ctx context.Context) (any, error) { return ctx.Value(ctxKey{}), nil },
+				}
+
+				res, err := eval(ctx, syms)
+				require.NoError(t, err)
+				assert.True(t, res)
+			})
+
+			t.Run("canceled", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := eval(ctx, SymbolsMap{"x": func() int {
+					t.Error("x is called while it shouldn't")
+					return 1
+				}})
+				assert.ErrorIs(t, err, context.Canceled)
+			})
+
+			t.Run("canceled between nodes", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				_, err := eval(ctx, SymbolsMap{
+					"x": func() int {
+						cancel()
+						return 1
+					},
+					"y": func() int {
+						t.Error("y is called while it shouldn't")
+						return 2
+					},
+				})
+				assert.ErrorIs(t, err, context.Canceled)
+			})
+
+			t.Run("deadline", func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				defer cancel()
+
+				_, err := eval(ctx, SymbolsMap{"x": func(ctx context.Context) (int, error) {
+					<-ctx.Done()
+					return 0, ctx.Err()
+				}})
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+				var eerr *EvalError
+				assert.ErrorAs(t, err, &eerr)
+			})
+		})
+	}
+
+	t.Run("paths", func(t *testing.T) {
+		exp, err := Parse(`user.age >= 18`)
+		require.NoError(t, err)
+
+		ctx := context.WithValue(context.Background(), ctxKey{}, 21)
+		res, err := EvalExpressionContext(ctx, exp, SymbolsMap{"user": map[string]any{
+			"age": func(ctx context.Context) (any, error) { return ctx.Value(ctxKey{}), nil },
+		}})
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		exp, err := Parse(`m != 1`)
+		require.NoError(t, err)
+
+		res, err := EvalExpressionContext(context.Background(), exp, SymbolsMap{}, WithMissingSymbols(MissingNull))
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		_, err := EvalExpressionContext(context.Background(), Expression{}, SymbolsMap{})
+		assert.Error(t, err)
+
+		_, err = Program{}.EvalContext(context.Background(), SymbolsMap{})
+		assert.Error(t, err)
+	})
+}
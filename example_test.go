@@ -1,7 +1,12 @@
 package boolexpr_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/netip"
+	"sort"
+	"time"
 
 	"github.com/emad-elsaid/boolexpr"
 )
@@ -97,6 +102,156 @@ func ExampleListSymbols() {
 	// Output: 3 symbols
 }
 
+// Arithmetic combines values on either side of a comparison. Ints stay exact,
+// and "+" also joins strings.
+func ExampleEval_arithmetic() {
+	symbols := boolexpr.SymbolsMap{
+		"price":    12.5,
+		"quantity": 10,
+		"first":    "Ada",
+		"last":     "Lovelace",
+	}
+
+	ok, _ := boolexpr.Eval(`price * quantity > 100 and 7 / 2 = 3 and first + " " + last = "Ada Lovelace"`, symbols)
+	fmt.Println(ok)
+
+	_, err := boolexpr.Eval(`quantity / 0 > 1`, symbols)
+	fmt.Println(errors.Is(err, boolexpr.ErrDivisionByZero))
+	// Output:
+	// true
+	// true
+}
+
+// Functions transform values before they are compared.
+func ExampleEval_functions() {
+	symbols := boolexpr.SymbolsMap{
+		"email": "Ada@CORP.com",
+		"tags":  []string{"admin", "ops", "eu"},
+		"a":     3,
+		"b":     5,
+	}
+
+	ok, _ := boolexpr.Eval(`lower(email) ends_with "@corp.com" and len(tags) > 2 and abs(a - b) <= max(a, 2)`, symbols)
+	fmt.Println(ok)
+
+	_, err := boolexpr.Parse(`size(tags) > 2`)
+	fmt.Println(err)
+	// Output:
+	// true
+	// 1:1: Function not found, size
+}
+
+// Functions registered with a Functions registry are called like the built-in
+// ones, and can be bound again for each evaluation.
+func ExampleWithFunctions() {
+	fns := boolexpr.NewFunctions()
+	_ = fns.Register("has_permission", func(user, perm string) (bool, error) {
+		return user == "ada" || perm == "read", nil
+	})
+
+	e, _ := boolexpr.Parse(`has_permission(user, "write")`, boolexpr.WithFunctions(fns))
+
+	ok, _ := boolexpr.EvalExpression(e, boolexpr.SymbolsMap{"user": "ada"})
+	fmt.Println(ok)
+
+	deny := boolexpr.NewFunctions()
+	_ = deny.Register("has_permission", func(user, perm string) bool { return false })
+
+	ok, _ = boolexpr.EvalExpression(e, boolexpr.SymbolsMap{"user": "ada"}, boolexpr.WithFunctions(deny))
+	fmt.Println(ok)
+
+	_, err := boolexpr.Parse(`has_permission(user)`, boolexpr.WithFunctions(fns))
+	fmt.Println(err)
+	// Output:
+	// true
+	// false
+	// 1:1: Wrong number of arguments, has_permission takes 2 arguments, got 1
+}
+
+// Domain comparisons can be registered as infix operators.
+func ExampleWithOperators() {
+	ops := boolexpr.NewOperators()
+	_ = ops.Register("in_cidr", func(l, r any) (bool, error) {
+		addr, err := netip.ParseAddr(l.(string))
+		if err != nil {
+			return false, err
+		}
+
+		prefix, err := netip.ParsePrefix(r.(string))
+		if err != nil {
+			return false, err
+		}
+
+		return prefix.Contains(addr), nil
+	})
+
+	ok, _ := boolexpr.Eval(`ip in_cidr "10.0.0.0/8"`, boolexpr.SymbolsMap{"ip": "10.1.2.3"}, boolexpr.WithOperators(ops))
+	fmt.Println(ok)
+
+	_, err := boolexpr.Parse(`ip in_cidr "10.0.0.0/8"`)
+	fmt.Println(err)
+	// Output:
+	// true
+	// 1:4: Operator not found, in_cidr
+}
+
+// Timestamps and durations compare with each other, and now() can be pinned.
+func ExampleWithClock() {
+	clock := func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+	e, _ := boolexpr.Parse(`created_at >= 2024-01-01 and now() - created_at < 30d`, boolexpr.WithClock(clock))
+
+	for _, created := range []time.Time{
+		time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC),
+	} {
+		ok, _ := boolexpr.EvalExpression(e, boolexpr.SymbolsMap{"created_at": created})
+		fmt.Println(ok)
+	}
+	// Output:
+	// true
+	// false
+}
+
+func ExampleWithMissingSymbols() {
+	syms := boolexpr.SymbolsMap{"country": "NL"}
+	for _, m := range []boolexpr.MissingSymbols{boolexpr.MissingError, boolexpr.MissingNull, boolexpr.MissingThreeValued} {
+		e, _ := boolexpr.Parse(`not age < 18 and country = "NL"`, boolexpr.WithMissingSymbols(m))
+		ok, err := boolexpr.EvalExpression(e, syms)
+		fmt.Println(ok, err)
+	}
+	// Output:
+	// false 1:5: Symbol: age, Symbol not found
+	// true <nil>
+	// false <nil>
+}
+
+// A path reads into the maps, slices and structs a symbol holds.
+func ExampleEval_paths() {
+	symbols := boolexpr.SymbolsMap{
+		"items": []any{map[string]any{"sku": "A-1", "qty": 2}},
+		"meta":  map[string]any{"x-key": "v"},
+	}
+
+	ok, _ := boolexpr.Eval(`items[0].sku = "A-1" and items[0].qty > 1 and meta["x-key"] = "v"`, symbols)
+	fmt.Println(ok)
+	// Output: true
+}
+
+// ListSymbolPaths reports symbols with their paths, and ListSymbols their
+// roots.
+func ExampleListSymbolPaths() {
+	ast, _ := boolexpr.Parse(`items[0].sku = "A-1" and items[1].sku = "B-2"`)
+
+	fmt.Println(boolexpr.ListSymbols(ast))
+
+	paths := boolexpr.ListSymbolPaths(ast)
+	sort.Strings(paths)
+	fmt.Println(paths)
+	// Output:
+	// [items]
+	// [items[0].sku items[1].sku]
+}
+
 // CachedMap resolves each symbol at most once and records which symbols an
 // evaluation actually touched. Short-circuiting means "y" is never looked up.
 func ExampleCachedMap() {
@@ -113,3 +268,214 @@ func ExampleCachedMap() {
 	// false
 	// map[x:false]
 }
+
+// A ParseError locates the problem in the expression and lists what would
+// have been accepted there.
+func ExampleParseError() {
+	_, err := boolexpr.Parse(`x = 1 and`)
+
+	var perr *boolexpr.ParseError
+	if errors.As(err, &perr) {
+		fmt.Println(perr.Line, perr.Column, perr.Got)
+		fmt.Println(perr.Expected)
+	}
+	// Output:
+	// 1 10 <EOF>
+	// [<symbol> <int> <float> <string> <time> <duration> true false null not ! (]
+}
+
+// Check finds type errors on every branch without evaluating the expression.
+func ExampleCheck() {
+	exp, _ := boolexpr.Parse(`age contains 3 or nickname = "x"`)
+
+	err := boolexpr.Check(exp, boolexpr.Schema{
+		"age":  boolexpr.KindInt,
+		"name": boolexpr.KindString,
+	})
+	fmt.Println(err)
+	// Output:
+	// 1:1: Wrong data type, Can't use contains on int
+	// 1:19: Symbol: nickname, Symbol not found
+}
+
+func ExampleExpression_String() {
+	exp, err := boolexpr.Parse(`((x==1)&&!(y||z))`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(exp.String())
+	// Output: x == 1 and not (y or z)
+}
+
+// EvalExpressionTrace explains a result: which comparisons decided it, with
+// the values they saw, and which were skipped.
+func ExampleEvalExpressionTrace() {
+	exp, err := boolexpr.Parse(`age >= 18 and country in ("NL", "BE") and verified`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, trace, err := boolexpr.EvalExpressionTrace(exp, boolexpr.SymbolsMap{
+		"age":      21,
+		"country":  "DE",
+		"verified": true,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(trace)
+	// Output:
+	// ✗ age >= 18 and country in ("NL", "BE") and verified
+	//   ✓ age >= 18 (21 >= 18)
+	//   ✗ country in ("NL", "BE") ("DE" in ("NL", "BE"))
+	//   - verified (skipped)
+}
+
+// PartialEval folds what is known ahead of time, leaving a smaller expression
+// for the symbols only known later.
+func ExamplePartialEval() {
+	exp, err := boolexpr.Parse(`(plan = "free" or seats > 5) and age >= min_age`)
+	if err != nil {
+		panic(err)
+	}
+
+	residual, err := boolexpr.PartialEval(exp, boolexpr.SymbolsMap{
+		"plan":    "pro",
+		"seats":   10,
+		"min_age": 18,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(residual)
+	// Output: age >= 18
+}
+
+// A Program is compiled once and evaluated many times, faster than
+// EvalExpression.
+func ExampleCompile() {
+	exp, err := boolexpr.Parse(`age >= 18 and country = "NL"`)
+	if err != nil {
+		panic(err)
+	}
+
+	p, err := boolexpr.Compile(exp)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, age := range []int{17, 30} {
+		res, err := p.Eval(boolexpr.SymbolsMap{"age": age, "country": "NL"})
+		fmt.Println(age, res, err)
+	}
+	// Output:
+	// 17 false <nil>
+	// 30 true <nil>
+}
+
+// StructSymbols evaluates an expression against the fields and methods of a
+// struct.
+func ExampleNewStructSymbols() {
+	type Status string
+
+	type User struct {
+		Name   string `boolexpr:"login"`
+		Status Status
+		Age    int
+		Tags   []string
+	}
+
+	syms, err := boolexpr.NewStructSymbols(&User{Name: "joanna", Status: "active", Age: 30, Tags: []string{"beta"}})
+	if err != nil {
+		panic(err)
+	}
+
+	res, err := boolexpr.Eval(`login = "joanna" and status = "active" and age >= 18 and tags contains "beta"`, syms)
+	fmt.Println(res, err)
+	// Output: true <nil>
+}
+
+// A symbol function taking a context.Context is called with the context of
+// the evaluation, which stops once it is done.
+func ExampleEvalExpressionContext() {
+	exp, err := boolexpr.Parse(`balance > 100 and not blocked`)
+	if err != nil {
+		panic(err)
+	}
+
+	syms := boolexpr.SymbolsMap{
+		"balance": func(ctx context.Context) (int, error) {
+			// e.g. a query with ctx
+			return 250, ctx.Err()
+		},
+		"blocked": false,
+	}
+
+	res, err := boolexpr.EvalExpressionContext(context.Background(), exp, syms)
+	fmt.Println(res, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res, err = boolexpr.EvalExpressionContext(ctx, exp, syms)
+	fmt.Println(res, err)
+	// Output:
+	// true <nil>
+	// false context canceled
+}
+
+// With PrefetchAll, the symbols are looked up concurrently before
+// evaluating, including those short-circuiting skips, which Used still leaves
+// out.
+func ExampleWithPrefetch() {
+	syms := boolexpr.NewCachedMap(map[string]any{
+		"plan":  func() string { return "pro" },
+		"seats": func() int { return 10 },
+	})
+
+	res, err := boolexpr.Eval(`plan = "pro" or seats > 5`, syms, boolexpr.WithPrefetch(boolexpr.PrefetchAll, 4))
+	fmt.Println(res, err, syms.Used())
+	// Output: true <nil> map[plan:pro]
+}
+
+// Optimize reorders operands to evaluate the cheapest first, here the bare
+// flag before the regular expression and the remote symbol.
+func ExampleOptimize() {
+	exp, err := boolexpr.Parse(`email match "^[a-z]+@corp\\.com$" and remote_score > 5 and active`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(boolexpr.Optimize(exp, boolexpr.Costs{
+		Symbols:   map[string]float64{"remote_score": 100},
+		Operators: map[string]float64{"match": 20},
+	}))
+	// Output: active and email match "^[a-z]+@corp\\.com$" and remote_score > 5
+}
+
+// Simplify drops the duplicate, absorbed and constant clauses rule builders
+// tend to generate.
+func ExampleSimplify() {
+	exp, err := boolexpr.Parse(`(a = 1 and a = 1) or (a = 1 and b = 2) or x > 1 and 2 < 1`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(boolexpr.Simplify(exp))
+	// Output: a = 1
+}
+
+// ToDNF distributes "and" over "or", within a size limit.
+func ExampleToDNF() {
+	exp, err := boolexpr.Parse(`plan = "pro" and (seats > 5 or not trial)`)
+	if err != nil {
+		panic(err)
+	}
+
+	dnf, err := boolexpr.ToDNF(exp, 100)
+	fmt.Println(dnf, err)
+	// Output: plan = "pro" and seats > 5 or plan = "pro" and not trial <nil>
+}
@@ -0,0 +1,145 @@
+package boolexpr
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The case-insensitive operators compare strings under Unicode simple case
+// folding, as [strings.EqualFold] does, so "STRASSE" equals_fold "strasse"
+// but not "straße". They fold rune by rune as they go, without lowering a
+// copy of either operand.
+
+// icontainsEval reports whether the string l contains r, or the []string l
+// holds an element equal to r, ignoring case.
+func icontainsEval(l, r evalVal) (bool, error) {
+	if ls, ok := l.toString(); ok {
+		rs, ok := r.toString()
+		if !ok {
+			return false, newErrorDataTypeMismatch("icontains", l.toAny(), r.toAny())
+		}
+
+		return containsFold(ls, rs), nil
+	}
+
+	lv, ok := l.a.([]string)
+	if !ok {
+		return false, newErrorWrongDataType("icontains", l.toAny())
+	}
+
+	rs, ok := r.toString()
+	if !ok {
+		return false, newErrorDataTypeMismatch("icontains", lv, r.toAny())
+	}
+
+	return slices.ContainsFunc(lv, func(s string) bool { return strings.EqualFold(s, rs) }), nil
+}
+
+func istartsWithEval(l, r evalVal) (bool, error) {
+	lv, rv, err := stringOperands("istarts_with", l, r)
+	if err != nil {
+		return false, err
+	}
+
+	return hasPrefixFold(lv, rv), nil
+}
+
+func iendsWithEval(l, r evalVal) (bool, error) {
+	lv, rv, err := stringOperands("iends_with", l, r)
+	if err != nil {
+		return false, err
+	}
+
+	return hasSuffixFold(lv, rv), nil
+}
+
+func equalFoldEval(l, r evalVal) (bool, error) {
+	lv, rv, err := stringOperands("equals_fold", l, r)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.EqualFold(lv, rv), nil
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	for i := 0; ; {
+		if hasPrefixFold(s[i:], substr) {
+			return true
+		}
+
+		if i == len(s) {
+			return false
+		}
+
+		_, n := utf8.DecodeRuneInString(s[i:])
+		i += n
+	}
+}
+
+// hasPrefixFold reports whether s begins with prefix, ignoring case.
+func hasPrefixFold(s, prefix string) bool {
+	for prefix != "" {
+		if s == "" {
+			return false
+		}
+
+		sr, sn := utf8.DecodeRuneInString(s)
+		pr, pn := utf8.DecodeRuneInString(prefix)
+		if !equalFoldRune(sr, pr) {
+			return false
+		}
+
+		s, prefix = s[sn:], prefix[pn:]
+	}
+
+	return true
+}
+
+// hasSuffixFold reports whether s ends with suffix, ignoring case.
+func hasSuffixFold(s, suffix string) bool {
+	for suffix != "" {
+		if s == "" {
+			return false
+		}
+
+		sr, sn := utf8.DecodeLastRuneInString(s)
+		xr, xn := utf8.DecodeLastRuneInString(suffix)
+		if !equalFoldRune(sr, xr) {
+			return false
+		}
+
+		s, suffix = s[:len(s)-sn], suffix[:len(suffix)-xn]
+	}
+
+	return true
+}
+
+// equalFoldRune reports whether a and b are equal under simple case folding.
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+
+	if a < utf8.RuneSelf && b < utf8.RuneSelf {
+		if 'A' <= a && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+
+		return a == b
+	}
+
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+
+	return false
+}
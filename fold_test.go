@@ -0,0 +1,34 @@
+package boolexpr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFold(t *testing.T) {
+	tcs := []struct {
+		s, sub                   string
+		contains, prefix, suffix bool
+	}{
+		{"Hello", "", true, true, true},
+		{"", "a", false, false, false},
+		{"Hello", "hello", true, true, true},
+		{"Hello", "LL", true, false, false},
+		{"Hello", "HE", true, true, false},
+		{"Hello", "LO", true, false, true},
+		{"Hello", "hello!", false, false, false},
+		{"ΣΊΣΥΦΟΣ", "σίσυφος", true, true, true},
+		{"ΣΊΣΥΦΟΣ", "ς", true, true, true},   // final sigma folds to Σ
+		{"Kelvin", "kel", true, true, false}, // the Kelvin sign folds to k
+		{"straße", "SS", false, false, false},
+		{"aaab", "AAB", true, false, true},
+		{"a\xffb", "\xffB", true, false, true},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.contains, containsFold(tc.s, tc.sub), "%q icontains %q", tc.s, tc.sub)
+		assert.Equal(t, tc.prefix, hasPrefixFold(tc.s, tc.sub), "%q istarts_with %q", tc.s, tc.sub)
+		assert.Equal(t, tc.suffix, hasSuffixFold(tc.s, tc.sub), "%q iends_with %q", tc.s, tc.sub)
+	}
+}
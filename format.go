@@ -0,0 +1,278 @@
+package boolexpr
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// String returns the canonical source text of the expression: operators are
+// spelled as words ("and", "or", "not"), operands are separated by single
+// spaces, and parentheses appear only where precedence requires them.
+// Parsing the result yields an equivalent expression, so String can be used to
+// store an expression that was normalized or edited in code. The zero value
+// formats as "".
+func (e Expression) String() string {
+	if e.e == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	writeBoolExpr(&sb, e.e, precOr)
+	return sb.String()
+}
+
+// prec is the binding strength of an expression, from the loosest "or" to the
+// tightest unary form. An expression is written without parentheses when its
+// precedence is at least the one its position requires.
+type prec uint8
+
+const (
+	precOr prec = iota
+	precAnd
+	precUnary
+)
+
+// boolExprPrec is the precedence of b as written without its own parentheses.
+func boolExprPrec(b *BoolExpr) prec {
+	if len(b.OrOps) > 0 {
+		return precOr
+	}
+
+	if len(b.And.AndOps) > 0 {
+		return precAnd
+	}
+
+	if sub, ok := b.And.Expr.(*SubExpr); ok {
+		return boolExprPrec(&sub.BoolExpr)
+	}
+
+	return precUnary
+}
+
+// writeBoolExpr writes b in a position requiring at least precedence p.
+func writeBoolExpr(sb *strings.Builder, b *BoolExpr, p prec) {
+	if boolExprPrec(b) < p {
+		sb.WriteByte('(')
+		writeBoolExpr(sb, b, precOr)
+		sb.WriteByte(')')
+		return
+	}
+
+	writeAndExpr(sb, &b.And, p)
+	for i := range b.OrOps {
+		sb.WriteString(" or ")
+		writeAndExpr(sb, &b.OrOps[i].And, p)
+	}
+}
+
+// writeAndExpr writes a in a position requiring at least precedence p. A lone
+// operand takes that position itself, so "a or (b or c)" is written flat;
+// operands joined by "and" must bind at least as tightly as "and".
+func writeAndExpr(sb *strings.Builder, a *AndExpr, p prec) {
+	if len(a.AndOps) == 0 {
+		writeExpr(sb, a.Expr, p)
+		return
+	}
+
+	writeExpr(sb, a.Expr, precAnd)
+	for _, op := range a.AndOps {
+		sb.WriteString(" and ")
+		writeExpr(sb, op.Expr, precAnd)
+	}
+}
+
+func writeExpr(sb *strings.Builder, x Expr, p prec) {
+	switch e := x.(type) {
+	case *Compare:
+		writeOperand(sb, &e.Left, precSum)
+		sb.WriteByte(' ')
+		sb.WriteString(opSource(e.Op))
+		sb.WriteByte(' ')
+		writeOperand(sb, &e.Right, precSum)
+	case *NullTest:
+		writeOperand(sb, &e.Operand, precSum)
+		sb.WriteByte(' ')
+		sb.WriteString(nullTestOp(e))
+	case *BoolValue:
+		writeValue(sb, &e.Value)
+	case *SubExpr:
+		writeBoolExpr(sb, &e.BoolExpr, p)
+	case *NotExpr:
+		sb.WriteString("not ")
+		writeExpr(sb, e.Expr, precUnary)
+	}
+}
+
+// The precedences of arithmetic, from "+" and "-" to a single factor. They
+// rank operands, which always bind tighter than a comparison.
+const (
+	precSum prec = iota
+	precProduct
+	precFactor
+)
+
+// operandPrec is the precedence of o as written without its own parentheses.
+func operandPrec(o *Operand) prec {
+	if len(o.Ops) > 0 {
+		return precSum
+	}
+
+	if len(o.Term.Ops) > 0 {
+		return precProduct
+	}
+
+	if o.Term.Factor.Group != nil {
+		return operandPrec(o.Term.Factor.Group)
+	}
+
+	return precFactor
+}
+
+// writeOperand writes o in a position requiring at least precedence p. The
+// operators are left-associative, so a right operand must bind tighter than
+// its operator: "a - (b - c)" keeps its parentheses.
+func writeOperand(sb *strings.Builder, o *Operand, p prec) {
+	if operandPrec(o) < p {
+		sb.WriteByte('(')
+		writeOperand(sb, o, precSum)
+		sb.WriteByte(')')
+		return
+	}
+
+	if len(o.Ops) == 0 {
+		writeTerm(sb, &o.Term, p)
+		return
+	}
+
+	writeTerm(sb, &o.Term, precSum)
+	for i := range o.Ops {
+		sb.WriteByte(' ')
+		sb.WriteString(o.Ops[i].Op)
+		sb.WriteByte(' ')
+		writeTerm(sb, &o.Ops[i].Term, precProduct)
+	}
+}
+
+func writeTerm(sb *strings.Builder, t *Term, p prec) {
+	if len(t.Ops) == 0 {
+		writeFactor(sb, &t.Factor, p)
+		return
+	}
+
+	writeFactor(sb, &t.Factor, precProduct)
+	for i := range t.Ops {
+		sb.WriteByte(' ')
+		sb.WriteString(t.Ops[i].Op)
+		sb.WriteByte(' ')
+		writeFactor(sb, &t.Ops[i].Factor, precFactor)
+	}
+}
+
+func writeFactor(sb *strings.Builder, f *Factor, p prec) {
+	switch {
+	case f.Value != nil:
+		writeValue(sb, f.Value)
+	case f.Group != nil:
+		writeOperand(sb, f.Group, p)
+	case f.Neg != nil:
+		sb.WriteByte('-')
+		writeFactor(sb, f.Neg, precFactor)
+	}
+}
+
+func writeValue(sb *strings.Builder, v *Value) {
+	switch {
+	case v.Bool != nil:
+		sb.WriteString(strconv.FormatBool(bool(*v.Bool)))
+	case v.Float != nil:
+		sb.WriteString(formatFloat(*v.Float))
+	case v.Int != nil:
+		sb.WriteString(strconv.Itoa(*v.Int))
+	case v.String != nil:
+		sb.WriteString(strconv.Quote(*v.String))
+	case v.Time != nil:
+		sb.WriteString(formatTime(v.Time.Time))
+	case v.Duration != nil:
+		sb.WriteString(formatDuration(time.Duration(*v.Duration)))
+	case v.Null:
+		sb.WriteString("null")
+	case v.Symbol != nil:
+		sb.WriteString(v.Name())
+	case v.Call != nil:
+		sb.WriteString(v.Call.Name)
+		sb.WriteByte('(')
+		for i := range v.Call.Args {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeOperand(sb, &v.Call.Args[i], precSum)
+		}
+		sb.WriteByte(')')
+	case v.List != nil:
+		sb.WriteByte('(')
+		for i := range v.List.Values {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeValue(sb, &v.List.Values[i])
+		}
+		sb.WriteByte(')')
+	}
+}
+
+// formatFloat writes f in the shortest form that parses back to the same
+// float64. A whole number keeps a ".0" so it is read back as a float, not an
+// int: 1.0 and 1 compare alike but are different literals.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+
+	return s
+}
+
+// opSource is the source spelling of o. It differs from opName only in
+// keeping "==" apart from "=", so the parsed operator is preserved.
+func opSource(o ComparisonOp) string {
+	if o.EqEq {
+		return "=="
+	}
+
+	return opName(o)
+}
+
+// nullTestOp is the source spelling of the test of t.
+func nullTestOp(t *NullTest) string {
+	switch {
+	case t.Exists:
+		return "exists"
+	case t.IsNull:
+		return "is null"
+	default:
+		return "is not null"
+	}
+}
+
+// formatTime writes t in RFC 3339 format, as a date when it is midnight UTC.
+func formatTime(t time.Time) string {
+	if t.Location() == time.UTC && t.Equal(t.Truncate(24*time.Hour)) {
+		return t.Format(time.DateOnly)
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+// formatDuration writes d as Go does, or in days when it is a whole number of
+// them.
+func formatDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d != 0 && d%day == 0 {
+		return strconv.FormatInt(int64(d/day), 10) + "d"
+	}
+
+	return d.String()
+}
@@ -0,0 +1,147 @@
+package boolexpr
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressionString(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected string
+	}{
+		{`x>1`, `x > 1`},
+		{`x == 1 && y != 2.5 || !z`, `x == 1 and y != 2.5 or not z`},
+		{`x = 1.0`, `x = 1.0`},
+		{`x = 1e21`, `x = 1e+21`},
+		{`x = 0.000001`, `x = 1e-06`},
+		{`x = "a \"quoted\"\n\tvalue"`, `x = "a \"quoted\"\n\tvalue"`},
+		{`s contains "é"`, `s contains "é"`},
+		{`x in (1,2, y)`, `x in (1, 2, y)`},
+		{`x not in ("a")`, `x not in ("a")`},
+		{`a starts_with "b" and c ends_with d or e match "f.*" and g excludes h`, `a starts_with "b" and c ends_with d or e match "f.*" and g excludes h`},
+		{`items [ 0 ] . sku = meta["x-key"]`, `items[0].sku = meta["x-key"]`},
+		{`x in (a.b, c[1])`, `x in (a.b, c[1])`},
+		{`price*quantity>100`, `price * quantity > 100`},
+		{`(a * b) + c = (a + b) * c`, `a * b + c = (a + b) * c`},
+		{`a - (b - c) = (a - b) + (d - e)`, `a - (b - c) = a - b + (d - e)`},
+		{`a / (b * c) = (a / b) * c`, `a / (b * c) = a / b * c`},
+		{`-(a + b) < -1.5`, `-(a + b) < -1.5`},
+		{`(x) = -(1)`, `x = -1`},
+		{`s + "x" = "ax"`, `s + "x" = "ax"`},
+		{`len( lower(s)+"x" )>max(1,(a+b)*2, -c)`, `len(lower(s) + "x") > max(1, (a + b) * 2, -c)`},
+		{`x in (abs(y), 2)`, `x in (abs(y), 2)`},
+		{`t>2024-01-01 and t<2024-01-01T10:30:00.5+02:00`, `t > 2024-01-01 and t < 2024-01-01T10:30:00.5+02:00`},
+		{`now() - t < 7d and d >= 90m and d < -1h30m and d != 0s`, `now() - t < 7d and d >= 1h30m0s and d < -1h30m0s and d != 0s`},
+		{`x exists and y is  null or not z is not null and w=null`, `x exists and y is null or not z is not null and w = null`},
+		{`a.b+1 is null and x in (1, null)`, `a.b + 1 is null and x in (1, null)`},
+		{`a like "b%"  or c glob  "*.go"`, `a like "b%" or c glob "*.go"`},
+		{`a icontains "b" and c istarts_with d or e iends_with "f" and g imatch "h" and i equals_fold j`, `a icontains "b" and c istarts_with d or e iends_with "f" and g imatch "h" and i equals_fold j`},
+
+		// parentheses are kept only where precedence requires them
+		{`(a or b) and c`, `(a or b) and c`},
+		{`a or (b and c)`, `a or b and c`},
+		{`a and (b and c)`, `a and b and c`},
+		{`a or (b or c)`, `a or b or c`},
+		{`((a))`, `a`},
+		{`(a = 1)`, `a = 1`},
+		{`((a or b)) and ((c))`, `(a or b) and c`},
+		{`not (a and b)`, `not (a and b)`},
+		{`not (a or b)`, `not (a or b)`},
+		{`not (a)`, `not a`},
+		{`not (x = 1)`, `not x = 1`},
+		{`!(!a)`, `not not a`},
+		{`not ((a and b)) or c`, `not (a and b) or c`},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, exp.String())
+		})
+	}
+
+	t.Run("zero value", func(t *testing.T) {
+		assert.Equal(t, "", Expression{}.String())
+	})
+
+	// Without redundant parentheses, the canonical text parses back to the
+	// very same tree.
+	t.Run("round trips to the same tree", func(t *testing.T) {
+		exp, err := Parse(`x == 1.5 and not (y in (1, 2.0, z) or s match "\\d+") or t`)
+		require.NoError(t, err)
+
+		again, err := Parse(exp.String())
+		require.NoError(t, err)
+
+		clearPositions(reflect.ValueOf(exp.e))
+		clearPositions(reflect.ValueOf(again.e))
+		assert.Equal(t, exp, again)
+	})
+}
+
+// FuzzExpressionString checks that the canonical text of any parsable input
+// parses back to an equivalent expression: it formats identically and
+// evaluates to the same result.
+func FuzzExpressionString(f *testing.F) {
+	for _, seed := range []string{
+		`x > 1`,
+		`a or b and c`,
+		`(a or b) and not (c and d)`,
+		`((a)) or ((b and (c or d)))`,
+		`x = 1.0 and y != 1e100 and z < 0.1`,
+		`s = "tab\there \"q\" \\ é \x00"`,
+		`n in (1, 2.5, x) and m not in ("a", "b")`,
+		`!a && b || c`,
+		`items[0].sku = m["k"].v`,
+		`a - (b - c) * -d = -(1 + x) % 2 or (s) + "x" > -1.5`,
+		`len(lower(s) + "x") > max(1, (a + b) * 2, -c) or abs(round(f)) in (1, ceil(g))`,
+		`t > 2024-01-01 and t <= 2024-01-01T10:30:00.5+02:00 or t = 2024-06-01T00:00:00Z`,
+		`d >= 90m and d < -1h30m or d + 1s != 0s and 7d > d - 250ms`,
+		`x = null or null != y and x in (1, null)`,
+		`x is null and y is not null or z exists and not (a.b + 1 is null)`,
+		`a same_as b or not (c same_as "x" and d + 1 same_as 2)`,
+	} {
+		f.Add(seed)
+	}
+
+	ops := NewOperators()
+	require.NoError(f, ops.Register("same_as", func(l, r any) (bool, error) {
+		return fmt.Sprint(l) == fmt.Sprint(r), nil
+	}))
+
+	f.Fuzz(func(t *testing.T, input string) {
+		exp, err := Parse(input, WithOperators(ops))
+		if err != nil {
+			return
+		}
+
+		canonical := exp.String()
+		again, err := Parse(canonical, WithOperators(ops))
+		require.NoError(t, err, "canonical form %q of %q does not parse", canonical, input)
+		require.Equal(t, canonical, again.String(), "canonical form of %q is not stable", input)
+
+		syms := fuzzSymbols(exp)
+		want, wantErr := EvalExpression(exp, syms)
+		got, gotErr := EvalExpression(again, syms)
+		require.Equal(t, wantErr == nil, gotErr == nil, "%q and %q disagree on erroring", input, canonical)
+		require.Equal(t, want, got, "%q and %q evaluate differently", input, canonical)
+	})
+}
+
+// fuzzSymbols gives every symbol of exp a bool value derived from its name, so
+// bare symbols can be evaluated.
+func fuzzSymbols(exp Expression) SymbolsMap {
+	syms := SymbolsMap{}
+	for _, s := range ListSymbols(exp) {
+		syms[s] = len(s)%2 == 0
+	}
+
+	return syms
+}
@@ -0,0 +1,588 @@
+package boolexpr
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// function is a function an expression can call as name(args...). Its
+// argument kinds are checked by kind once the expression is parsed, and its
+// argument values by call when it is evaluated.
+type function struct {
+	name string
+	// min and max bound the number of arguments; max is -1 when there is
+	// no bound.
+	min, max int
+	// kind returns the kind of the result for arguments of the given kinds,
+	// or an error when the function does not accept them. Arguments of
+	// unknown (0) or KindAny kind are only known at evaluation time, and are
+	// accepted; the result is then 0 unless it doesn't depend on them.
+	kind func(args []Kind) (Kind, error)
+	// call1 evaluates a function of one argument; it saves gathering the
+	// argument in a slice. call evaluates the others.
+	call1 func(arg evalVal) (evalVal, error)
+	call  func(args []evalVal) (evalVal, error)
+	// volatile is set for a function, such as now, whose result may change
+	// from one call to the next with the same arguments, and for every
+	// registered one, which may read state of its own, have side effects or
+	// be bound again by an evaluation. Its calls are left to evaluation by
+	// [PartialEval].
+	volatile bool
+	// nulls is set for a function that is called with null arguments, as a
+	// registered one is. A call to any other with a null argument is null,
+	// without calling it.
+	nulls bool
+}
+
+// builtins are the functions every expression can call.
+var builtins = functionMap(
+	&function{name: "len", min: 1, max: 1, kind: lenKind, call1: lenEval},
+	stringFunction("lower", strings.ToLower),
+	stringFunction("upper", strings.ToUpper),
+	stringFunction("trim", strings.TrimSpace),
+	&function{name: "abs", min: 1, max: 1, kind: numericKind("abs"), call1: absEval},
+	roundFunction("round", math.Round),
+	roundFunction("floor", math.Floor),
+	roundFunction("ceil", math.Ceil),
+	extremumFunction("min", false),
+	extremumFunction("max", true),
+	nowFunction(time.Now),
+)
+
+func functionMap(fns ...*function) map[string]*function {
+	m := make(map[string]*function, len(fns))
+	for _, f := range fns {
+		m[f.name] = f
+	}
+
+	return m
+}
+
+// check returns the kind of the result of f for arguments of the given kinds,
+// checking their number first.
+func (f *function) check(args []Kind) (Kind, error) {
+	if err := f.checkArity(len(args)); err != nil {
+		return 0, err
+	}
+
+	return f.kind(args)
+}
+
+func (f *function) checkArity(n int) error {
+	if n >= f.min && (f.max < 0 || n <= f.max) {
+		return nil
+	}
+
+	var want string
+	switch {
+	case f.min == f.max:
+		want = arguments(f.min)
+	case f.max < 0:
+		want = "at least " + arguments(f.min)
+	default:
+		want = fmt.Sprintf("%d to %s", f.min, arguments(f.max))
+	}
+
+	return fmt.Errorf("%w, %s takes %s, got %d", ErrArgumentCount, f.name, want, n)
+}
+
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// Functions is a registry of functions an expression may call besides the
+// built-in ones, given to [Parse] and [EvalExpression] with [WithFunctions].
+// Register every function before the registry is used; it may then be used
+// concurrently. The zero value is an empty registry ready to use.
+type Functions struct {
+	fns map[string]*function
+}
+
+// NewFunctions returns an empty registry.
+func NewFunctions() *Functions {
+	return &Functions{fns: map[string]*function{}}
+}
+
+// Register adds fn to the registry as name, replacing any function already
+// registered, or built in, under that name:
+//
+//	fns.Register("geo_distance", func(lat1, lon1, lat2, lon2 float64) float64 { ... })
+//	fns.Register("has_permission", func(user, perm string) (bool, error) { ... })
+//
+// fn must be a func whose parameters and result have the types a symbol value
+// may have, as listed by [resolveSymbol]: bool, int, float64, string,
+// []string, []int, []float64, []bool, any, time.Time or time.Duration. The
+// result may be followed by an error, which aborts evaluation when it is not
+// nil. A variadic func takes any number of trailing arguments. An int argument
+// is accepted for a float64 parameter. A null argument is nil for a parameter
+// of type any, and makes the result null for any other.
+//
+// fn is only called by evaluation: [PartialEval] and [Simplify] leave its
+// calls in place even when their arguments are known. A panic of fn aborts
+// evaluation with an [EvalError] located at the call.
+//
+// Register returns an error wrapping [ErrInvalidFunction] when name is not an
+// identifier, or is a reserved word, or when fn is not such a func.
+func (f *Functions) Register(name string, fn any) error {
+	if !validFunctionName(name) {
+		return fmt.Errorf("%w, %q is not a valid function name", ErrInvalidFunction, name)
+	}
+
+	g, err := reflectFunction(name, fn)
+	if err != nil {
+		return err
+	}
+
+	if f.fns == nil {
+		f.fns = map[string]*function{}
+	}
+	f.fns[name] = g
+	return nil
+}
+
+// lookup returns the function called name: the one registered in f, or else
+// the built-in one. It returns nil when there is none.
+func (f *Functions) lookup(name string) *function {
+	if f != nil {
+		if g, ok := f.fns[name]; ok {
+			return g
+		}
+	}
+
+	return builtins[name]
+}
+
+func validFunctionName(name string) bool {
+	switch name {
+	case "", "and", "or", "not", "in", "true", "false", "null":
+		return false
+	}
+
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// kindTypes are the Go types of the parameters and results of registered
+// functions, and their kinds.
+var kindTypes = map[reflect.Type]Kind{
+	reflect.TypeFor[bool]():          KindBool,
+	reflect.TypeFor[int]():           KindInt,
+	reflect.TypeFor[float64]():       KindFloat,
+	reflect.TypeFor[string]():        KindString,
+	reflect.TypeFor[[]string]():      KindStringSlice,
+	reflect.TypeFor[[]int]():         KindIntSlice,
+	reflect.TypeFor[[]float64]():     KindFloatSlice,
+	reflect.TypeFor[[]bool]():        KindBoolSlice,
+	reflect.TypeFor[any]():           KindAny,
+	reflect.TypeFor[time.Time]():     KindTime,
+	reflect.TypeFor[time.Duration](): KindDuration,
+}
+
+// reflectFunction checks the signature of the Go func fn, and returns the
+// function calling it through reflection.
+func reflectFunction(name string, fn any) (*function, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("%w, %s: %T is not a func", ErrInvalidFunction, name, fn)
+	}
+
+	t := v.Type()
+	params := make([]Kind, t.NumIn())
+	for i := range params {
+		pt := t.In(i)
+		if t.IsVariadic() && i == len(params)-1 {
+			pt = pt.Elem()
+		}
+
+		k, ok := kindTypes[pt]
+		if !ok {
+			return nil, fmt.Errorf("%w, %s: parameter %d of type %s is not supported", ErrInvalidFunction, name, i+1, pt)
+		}
+		params[i] = k
+	}
+
+	if t.NumOut() == 0 || t.NumOut() > 2 || t.NumOut() == 2 && t.Out(1) != reflect.TypeFor[error]() {
+		return nil, fmt.Errorf("%w, %s: must return a value, optionally followed by an error", ErrInvalidFunction, name)
+	}
+
+	result, ok := kindTypes[t.Out(0)]
+	if !ok {
+		return nil, fmt.Errorf("%w, %s: result of type %s is not supported", ErrInvalidFunction, name, t.Out(0))
+	}
+
+	f := &function{name: name, min: len(params), max: len(params), volatile: true, nulls: true}
+	if t.IsVariadic() {
+		f.min, f.max = len(params)-1, -1
+	}
+
+	// param returns the kind of the i-th argument, the last parameter taking
+	// all trailing arguments of a variadic func.
+	param := func(i int) Kind { return params[min(i, len(params)-1)] }
+
+	f.kind = func(args []Kind) (Kind, error) {
+		for i, a := range args {
+			if p := param(i); checked(a, a) && p != KindAny && p != a && !(p == KindFloat && a == KindInt) {
+				return 0, fmt.Errorf("%w, argument %d of %s must be %s, got %s", ErrorWrongDataType, i+1, name, p, a)
+			}
+		}
+
+		return result, nil
+	}
+
+	f.call = func(args []evalVal) (res evalVal, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				res, err = evalVal{}, fmt.Errorf("function: %s %w: %v", name, errPanicked, r)
+			}
+		}()
+
+		in := make([]reflect.Value, len(args))
+		for i, a := range args {
+			arg, ok := reflectArg(param(i), a)
+			if !ok && a.isNull() {
+				return evalVal{kind: kindAny}, nil
+			}
+			if !ok {
+				return evalVal{}, fmt.Errorf("%w, argument %d of %s must be %s, got %v of type %T",
+					ErrorWrongDataType, i+1, name, param(i), a.toAny(), a.toAny())
+			}
+			in[i] = arg
+		}
+
+		out := v.Call(in)
+		if len(out) == 2 && !out[1].IsNil() {
+			return evalVal{}, out[1].Interface().(error)
+		}
+
+		return reflectResult(result, out[0]), nil
+	}
+
+	return f, nil
+}
+
+// reflectArg converts the argument a to a parameter of kind k, reporting
+// whether it has that kind.
+func reflectArg(k Kind, a evalVal) (reflect.Value, bool) {
+	switch k {
+	case KindBool:
+		b, ok := a.toBool()
+		return reflect.ValueOf(b), ok
+	case KindInt:
+		i, ok := a.toInt()
+		return reflect.ValueOf(i), ok
+	case KindFloat:
+		f, ok := a.toFloat()
+		return reflect.ValueOf(f), ok
+	case KindString:
+		s, ok := a.toString()
+		return reflect.ValueOf(s), ok
+	case KindAny:
+		if a.toAny() == nil {
+			return reflect.Zero(reflect.TypeFor[any]()), true
+		}
+
+		return reflect.ValueOf(a.toAny()), true
+	default:
+		v := reflect.ValueOf(a.toAny())
+		return v, v.IsValid() && kindTypes[v.Type()] == k
+	}
+}
+
+func reflectResult(k Kind, v reflect.Value) evalVal {
+	switch k {
+	case KindBool:
+		return evalVal{kind: kindBool, b: v.Bool()}
+	case KindInt:
+		return evalVal{kind: kindInt, i: int(v.Int())}
+	case KindFloat:
+		return evalVal{kind: kindFloat64, f: v.Float()}
+	case KindString:
+		return evalVal{kind: kindString, s: v.String()}
+	default:
+		return evalVal{kind: kindAny, a: v.Interface()}
+	}
+}
+
+// errPanicked marks the error a registered function panicked with, which is
+// located at its call rather than at the condition holding it.
+var errPanicked = errors.New("panicked")
+
+// locatePanic locates at the call v the error its function panicked with.
+func locatePanic(v *Value, err error) error {
+	if errors.Is(err, errPanicked) {
+		return &EvalError{Start: newPosition(v.Pos), End: newPosition(v.EndPos), Err: err}
+	}
+
+	return err
+}
+
+// evalCall evaluates the call v to the function it resolves to, or to the
+// function of the same name given to the evaluation with [WithFunctions].
+func evalCall(v *Value, syms Symbols) (evalVal, error) {
+	c := v.Call
+	f, ok := c.Func.(*function)
+	if !ok {
+		return evalVal{}, fmt.Errorf("%w, %s", ErrUnknownFunction, c.Name)
+	}
+
+	if o := evalOptions(syms); o != nil && o.funcs != nil {
+		if g, ok := o.funcs.fns[c.Name]; ok {
+			f = g
+		}
+	}
+
+	if err := f.checkArity(len(c.Args)); err != nil {
+		return evalVal{}, err
+	}
+
+	if f.call1 != nil {
+		arg, err := evalOperand(&c.Args[0], syms)
+		if err != nil {
+			return evalVal{}, err
+		}
+
+		if arg.isNull() && !f.nulls {
+			return arg, nil
+		}
+
+		res, err := f.call1(arg)
+		return res, locatePanic(v, err)
+	}
+
+	args := make([]evalVal, len(c.Args))
+	for i := range c.Args {
+		var err error
+		if args[i], err = evalOperand(&c.Args[i], syms); err != nil {
+			return evalVal{}, err
+		}
+	}
+
+	res, err := f.callArgs(args)
+	return res, locatePanic(v, err)
+}
+
+// callArgs calls f with args, or returns null when one of them is null and
+// f is not called with nulls.
+func (f *function) callArgs(args []evalVal) (evalVal, error) {
+	if !f.nulls && slices.ContainsFunc(args, evalVal.isNull) {
+		return evalVal{kind: kindAny}, nil
+	}
+
+	return f.call(args)
+}
+
+// lenKind accepts a string, whose length is in characters, or a slice.
+func lenKind(args []Kind) (Kind, error) {
+	switch args[0] {
+	case 0, KindAny, KindString, KindStringSlice, KindIntSlice, KindFloatSlice, KindBoolSlice:
+		return KindInt, nil
+	default:
+		return 0, newErrorKind("len", args[0])
+	}
+}
+
+func lenEval(v evalVal) (evalVal, error) {
+	if s, ok := v.toString(); ok {
+		return evalVal{kind: kindInt, i: utf8.RuneCountInString(s)}, nil
+	}
+
+	if v.kind == kindAny {
+		switch a := v.a.(type) {
+		case []string:
+			return evalVal{kind: kindInt, i: len(a)}, nil
+		case []int:
+			return evalVal{kind: kindInt, i: len(a)}, nil
+		case []float64:
+			return evalVal{kind: kindInt, i: len(a)}, nil
+		case []bool:
+			return evalVal{kind: kindInt, i: len(a)}, nil
+		case []any:
+			return evalVal{kind: kindInt, i: len(a)}, nil
+		}
+
+		// Slices, arrays and maps of other types, such as those reached
+		// through a path.
+		if rv := reflect.ValueOf(v.a); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array || rv.Kind() == reflect.Map {
+			return evalVal{kind: kindInt, i: rv.Len()}, nil
+		}
+	}
+
+	return evalVal{}, newErrorWrongDataType("len", v.toAny())
+}
+
+// nowFunction returns now(), the current time as read from clock.
+func nowFunction(clock func() time.Time) *function {
+	return &function{
+		name: "now", volatile: true,
+		kind: func([]Kind) (Kind, error) { return KindTime, nil },
+		call: func([]evalVal) (evalVal, error) { return timeVal(clock()) },
+	}
+}
+
+// with returns a copy of f, which may be nil, with g registered.
+func (f *Functions) with(g *function) *Functions {
+	res := NewFunctions()
+	if f != nil {
+		maps.Copy(res.fns, f.fns)
+	}
+	res.fns[g.name] = g
+
+	return res
+}
+
+// stringFunction returns a function of one string to a string.
+func stringFunction(name string, fn func(string) string) *function {
+	return &function{
+		name: name, min: 1, max: 1,
+		kind: func(args []Kind) (Kind, error) {
+			if checked(args[0], args[0]) && args[0] != KindString {
+				return 0, newErrorKind(name, args[0])
+			}
+
+			return KindString, nil
+		},
+		call1: func(v evalVal) (evalVal, error) {
+			s, ok := v.toString()
+			if !ok {
+				return evalVal{}, newErrorWrongDataType(name, v.toAny())
+			}
+
+			return evalVal{kind: kindString, s: fn(s)}, nil
+		},
+	}
+}
+
+// numericKind returns the kind function of a function of one number, whose
+// result has the kind of its argument.
+func numericKind(name string) func(args []Kind) (Kind, error) {
+	return func(args []Kind) (Kind, error) {
+		if !checked(args[0], args[0]) {
+			return 0, nil
+		}
+
+		if !args[0].numeric() {
+			return 0, newErrorKind(name, args[0])
+		}
+
+		return args[0], nil
+	}
+}
+
+// absEval returns the absolute value of a number; that of math.MinInt
+// overflows.
+func absEval(v evalVal) (evalVal, error) {
+	if i, ok := v.toInt(); ok {
+		if i == math.MinInt {
+			return evalVal{}, fmt.Errorf("%w, abs(%d)", ErrOverflow, i)
+		}
+
+		if i < 0 {
+			i = -i
+		}
+
+		return evalVal{kind: kindInt, i: i}, nil
+	}
+
+	if f, ok := v.toFloat(); ok {
+		return evalVal{kind: kindFloat64, f: math.Abs(f)}, nil
+	}
+
+	return evalVal{}, newErrorWrongDataType("abs", v.toAny())
+}
+
+// roundFunction returns a function rounding a float64 with fn. An int is
+// already whole, and is returned as is.
+func roundFunction(name string, fn func(float64) float64) *function {
+	return &function{
+		name: name, min: 1, max: 1,
+		kind: numericKind(name),
+		call1: func(v evalVal) (evalVal, error) {
+			if i, ok := v.toInt(); ok {
+				return evalVal{kind: kindInt, i: i}, nil
+			}
+
+			if f, ok := v.toFloat(); ok {
+				return evalVal{kind: kindFloat64, f: fn(f)}, nil
+			}
+
+			return evalVal{}, newErrorWrongDataType(name, v.toAny())
+		},
+	}
+}
+
+// extremumFunction returns a function of one or more numbers returning the
+// least of them, or the greatest. As in arithmetic, the result is an int when
+// every argument is an int, and a float64 otherwise.
+func extremumFunction(name string, greatest bool) *function {
+	return &function{
+		name: name, min: 1, max: -1,
+		kind: func(args []Kind) (Kind, error) {
+			res := KindInt
+			for _, k := range args {
+				switch {
+				case !checked(k, k):
+					res = 0
+				case !k.numeric():
+					return 0, newErrorKind(name, k)
+				case k == KindFloat && res != 0:
+					res = KindFloat
+				}
+			}
+
+			return res, nil
+		},
+		call: func(args []evalVal) (evalVal, error) {
+			ints := true
+			for _, a := range args {
+				if _, ok := a.toInt(); ok {
+					continue
+				}
+
+				if _, ok := a.toFloat(); !ok {
+					return evalVal{}, newErrorWrongDataType(name, a.toAny())
+				}
+
+				ints = false
+			}
+
+			if ints {
+				res, _ := args[0].toInt()
+				for _, a := range args[1:] {
+					if i, _ := a.toInt(); i != res && (i > res) == greatest {
+						res = i
+					}
+				}
+
+				return evalVal{kind: kindInt, i: res}, nil
+			}
+
+			res, _ := args[0].toFloat()
+			for _, a := range args[1:] {
+				if f, _ := a.toFloat(); f != res && (f > res) == greatest {
+					res = f
+				}
+			}
+
+			return evalVal{kind: kindFloat64, f: res}, nil
+		},
+	}
+}
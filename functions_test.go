@@ -0,0 +1,388 @@
+package boolexpr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunctionArity(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected string
+	}{
+		{`len() = 0`, `1:1: Wrong number of arguments, len takes 1 argument, got 0`},
+		{`lower(a, b) = ""`, `1:1: Wrong number of arguments, lower takes 1 argument, got 2`},
+		{`x = 1 or min() = 1`, `1:10: Wrong number of arguments, min takes at least 1 argument, got 0`},
+		{`size(x) = 1`, `1:1: Function not found, size`},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestFunctionKinds(t *testing.T) {
+	tcs := []struct {
+		name     string
+		args     []Kind
+		expected Kind
+		err      bool
+	}{
+		{"len", []Kind{KindString}, KindInt, false},
+		{"len", []Kind{KindBoolSlice}, KindInt, false},
+		{"len", []Kind{KindAny}, KindInt, false},
+		{"len", []Kind{KindFloat}, 0, true},
+		{"lower", []Kind{0}, KindString, false},
+		{"trim", []Kind{KindInt}, 0, true},
+		{"abs", []Kind{KindInt}, KindInt, false},
+		{"abs", []Kind{KindAny}, 0, false},
+		{"ceil", []Kind{KindFloat}, KindFloat, false},
+		{"round", []Kind{KindString}, 0, true},
+		{"min", []Kind{KindInt, KindInt}, KindInt, false},
+		{"min", []Kind{KindInt, KindFloat, KindInt}, KindFloat, false},
+		{"max", []Kind{KindFloat, 0}, 0, false},
+		{"max", []Kind{0, KindFloat}, 0, false},
+		{"max", []Kind{KindInt, KindBool}, 0, true},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			f := builtins[tc.name]
+			require.NotNil(t, f)
+
+			k, err := f.check(tc.args)
+			assert.Equal(t, tc.expected, k)
+			if tc.err {
+				assert.ErrorIs(t, err, ErrorWrongDataType)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFunctionsRegister(t *testing.T) {
+	valid := map[string]any{
+		"nullary":  func() int { return 1 },
+		"geo":      func(lat1, lon1, lat2, lon2 float64) float64 { return 0 },
+		"allowed":  func(user, perm string) (bool, error) { return true, nil },
+		"variadic": func(sep string, parts ...string) string { return "" },
+		"slices":   func(a []int, b []float64, c []bool) []string { return nil },
+		"anything": func(v any) any { return v },
+		"_x1":      func(b bool) bool { return b },
+		"größe":    func(s string) int { return 0 },
+	}
+
+	for name, fn := range valid {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, NewFunctions().Register(name, fn))
+		})
+	}
+
+	invalid := []struct {
+		name string
+		fn   any
+	}{
+		{"f", 1},
+		{"f", (func() int)(nil)},
+		{"f", nil},
+		{"f", func(int64) int { return 0 }},
+		{"f", func(int, map[string]int) int { return 0 }},
+		{"f", func(...int32) int { return 0 }},
+		{"f", func() {}},
+		{"f", func() map[string]any { return nil }},
+		{"f", func() (int, int) { return 0, 0 }},
+		{"f", func() (int, error, error) { return 0, nil, nil }},
+		{"", func() int { return 0 }},
+		{"1f", func() int { return 0 }},
+		{"a-b", func() int { return 0 }},
+		{"and", func() int { return 0 }},
+		{"true", func() int { return 0 }},
+		{"null", func() int { return 0 }},
+	}
+
+	for _, tc := range invalid {
+		tc := tc
+		t.Run(fmt.Sprintf("%q %T", tc.name, tc.fn), func(t *testing.T) {
+			assert.ErrorIs(t, NewFunctions().Register(tc.name, tc.fn), ErrInvalidFunction)
+		})
+	}
+
+	t.Run("zero value", func(t *testing.T) {
+		var fns Functions
+		require.NoError(t, fns.Register("double", func(n int) int { return 2 * n }))
+
+		res, err := Eval(`double(x) = 4`, SymbolsMap{"x": 2}, WithFunctions(&fns))
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	fns := NewFunctions()
+	require.NoError(t, fns.Register("geo_distance", func(lat1, lon1, lat2, lon2 float64) float64 {
+		return math.Hypot(lat2-lat1, lon2-lon1)
+	}))
+	require.NoError(t, fns.Register("has_permission", func(user, perm string) (bool, error) {
+		if user == "" {
+			return false, errDenied
+		}
+
+		return user == "root" || perm == "read", nil
+	}))
+	require.NoError(t, fns.Register("join", func(sep string, parts ...string) string { return strings.Join(parts, sep) }))
+	require.NoError(t, fns.Register("answer", func() int { return 42 }))
+	require.NoError(t, fns.Register("first", func(s []string) any { return s[0] }))
+	require.NoError(t, fns.Register("evens", func(xs []int) []int {
+		var res []int
+		for _, x := range xs {
+			if x%2 == 0 {
+				res = append(res, x)
+			}
+		}
+		return res
+	}))
+	require.NoError(t, fns.Register("is_nil", func(v any) bool { return v == nil }))
+	require.NoError(t, fns.Register("len", func(s string) int { return len(s) }))
+
+	syms := SymbolsMap{
+		"lat": 52.5, "lon": 13.4,
+		"user": "ada", "root": "root", "nobody": "",
+		"tags": []string{"eu", "gdpr"}, "ids": []int{1, 2, 4},
+		"n": 3,
+	}
+
+	tcs := []struct {
+		input    string
+		expected bool
+	}{
+		{`geo_distance(lat, lon, 52.5, 13.4) < 10`, true},
+		{`geo_distance(0, 0, 3, 4) = 5`, true},
+		{`has_permission(user, "read") and not has_permission(user, "write")`, true},
+		{`has_permission(root, "write")`, true},
+		{`join("-", "a", "b", lower("C")) = "a-b-c" and join(",") = ""`, true},
+		{`answer() = 42 and answer() + n = 45`, true},
+		{`first(tags) = "eu"`, true},
+		{`evens(ids) contains 4 and not (evens(ids) contains 1)`, true},
+		{`len("héllo") = 6`, true},
+		{`is_nil(first(tags))`, false},
+		{`geo_distance(lat, lon, lat, n) > 20`, false},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input, WithFunctions(fns))
+			require.NoError(t, err)
+
+			res, err := EvalExpression(exp, syms)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+
+			p, err := Compile(exp)
+			require.NoError(t, err)
+			res, err = p.Eval(syms)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res, "compiled")
+		})
+	}
+
+	t.Run("parse errors", func(t *testing.T) {
+		for input, want := range map[string]error{
+			`geo_distance(lat, lon) < 10`:         ErrArgumentCount,
+			`has_permission(user, "r", "w")`:      ErrArgumentCount,
+			`has_permission(user, 1)`:             ErrorWrongDataType,
+			`geo_distance(lat, lon, "a", 1) > 1`:  ErrorWrongDataType,
+			`join("-", "a", 1) = ""`:              ErrorWrongDataType,
+			`answer(1) = 42`:                      ErrArgumentCount,
+			`size(tags) = 2`:                      ErrUnknownFunction,
+			`len(tags) = 2 and has_permission(x)`: ErrArgumentCount,
+		} {
+			_, err := Parse(input, WithFunctions(fns))
+			assert.ErrorIs(t, err, want, input)
+
+			var perr *ParseError
+			assert.ErrorAs(t, err, &perr, input)
+		}
+	})
+
+	t.Run("unknown without the registry", func(t *testing.T) {
+		_, err := Parse(`x = 1 or has_permission(user, "read")`)
+		assert.ErrorIs(t, err, ErrUnknownFunction)
+
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, Position{Offset: 9, Line: 1, Column: 10}, perr.Position)
+		assert.Equal(t, "has_permission", perr.Got)
+	})
+
+	t.Run("evaluation errors", func(t *testing.T) {
+		_, err := Eval(`has_permission(nobody, "read")`, syms, WithFunctions(fns))
+		assert.ErrorIs(t, err, errDenied)
+
+		var eerr *EvalError
+		require.ErrorAs(t, err, &eerr)
+		assert.Equal(t, 1, eerr.Start.Column)
+
+		_, err = Eval(`has_permission(n, "read")`, syms, WithFunctions(fns))
+		assert.ErrorIs(t, err, ErrorWrongDataType)
+		assert.ErrorContains(t, err, "argument 1 of has_permission must be string, got 3 of type int")
+
+		_, err = Eval(`evens(tags) contains 1`, syms, WithFunctions(fns))
+		assert.ErrorIs(t, err, ErrorWrongDataType)
+	})
+
+	t.Run("checked against a schema", func(t *testing.T) {
+		exp, err := Parse(`geo_distance(lat, lon, 1, 2) starts_with "a" and has_permission(user, "read")`, WithFunctions(fns))
+		require.NoError(t, err)
+
+		err = Check(exp, Schema{"lat": KindFloat, "lon": KindString, "user": KindString})
+		var errs CheckErrors
+		require.ErrorAs(t, err, &errs)
+		require.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "argument 2 of geo_distance must be float64, got string")
+	})
+
+	t.Run("bound at evaluation", func(t *testing.T) {
+		exp, err := Parse(`has_permission(user, "write")`, WithFunctions(fns))
+		require.NoError(t, err)
+
+		for _, granted := range []bool{true, false} {
+			request := NewFunctions()
+			require.NoError(t, request.Register("has_permission", func(user, perm string) bool { return granted }))
+
+			res, err := EvalExpression(exp, syms, WithFunctions(request))
+			require.NoError(t, err)
+			assert.Equal(t, granted, res)
+		}
+
+		res, err := EvalExpression(exp, syms)
+		require.NoError(t, err)
+		assert.False(t, res, "the function parsed with is used by default")
+
+		wrong := NewFunctions()
+		require.NoError(t, wrong.Register("has_permission", func(perm string) bool { return true }))
+		_, err = EvalExpression(exp, syms, WithFunctions(wrong))
+		assert.ErrorIs(t, err, ErrArgumentCount)
+	})
+}
+
+func TestFunctionsNull(t *testing.T) {
+	fns := NewFunctions()
+	require.NoError(t, fns.Register("double", func(n int) int { return n * 2 }))
+	require.NoError(t, fns.Register("is_nil", func(v any) bool { return v == nil }))
+
+	// A null argument makes a function null, unless it takes any.
+	for _, input := range []string{
+		`double(n) is null and double(gone) is null`,
+		`is_nil(n) and is_nil(gone)`,
+		`abs(n) is null and max(1, n) is null and lower(gone) = null`,
+		`len(n) + 1 is null`,
+	} {
+		exp, err := Parse(input, WithFunctions(fns), WithMissingSymbols(MissingNull))
+		require.NoError(t, err)
+
+		res, err := EvalExpression(exp, SymbolsMap{"n": nil})
+		require.NoError(t, err)
+		assert.True(t, res, input)
+
+		p, err := Compile(exp)
+		require.NoError(t, err)
+		res, err = p.Eval(SymbolsMap{"n": nil})
+		require.NoError(t, err)
+		assert.True(t, res, "compiled %s", input)
+	}
+}
+
+func TestNow(t *testing.T) {
+	clock := func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+	syms := SymbolsMap{"created": time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC)}
+	input := `now() - created <= 2d and now() > 2024-03-01 and now() < 2024-03-01T12:00:01Z`
+
+	t.Run("clock bound at parse", func(t *testing.T) {
+		exp, err := Parse(input, WithClock(clock))
+		require.NoError(t, err)
+
+		res, err := EvalExpression(exp, syms)
+		require.NoError(t, err)
+		assert.True(t, res)
+
+		p, err := Compile(exp)
+		require.NoError(t, err)
+		res, err = p.Eval(syms)
+		require.NoError(t, err)
+		assert.True(t, res, "compiled")
+	})
+
+	t.Run("clock bound at evaluation", func(t *testing.T) {
+		exp, err := Parse(input)
+		require.NoError(t, err)
+
+		res, err := EvalExpression(exp, syms, WithClock(clock))
+		require.NoError(t, err)
+		assert.True(t, res)
+
+		res, err = EvalExpression(exp, syms)
+		require.NoError(t, err)
+		assert.False(t, res, "the wall clock is used by default")
+	})
+
+	t.Run("with registered functions", func(t *testing.T) {
+		fns := NewFunctions()
+		require.NoError(t, fns.Register("days_between", func(a, b time.Time) int { return int(b.Sub(a) / (24 * time.Hour)) }))
+
+		res, err := Eval(`days_between(created, now()) = 2`, syms, WithFunctions(fns), WithClock(clock))
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, err := Eval(`now() > 2024-01-01`, syms, WithClock(func() time.Time { return time.Time{} }))
+		assert.ErrorIs(t, err, ErrOverflow)
+	})
+}
+
+func TestFunctionsPanic(t *testing.T) {
+	fns := NewFunctions()
+	require.NoError(t, fns.Register("first", func(s []string) string { return s[0] }))
+
+	exp, err := Parse(`x = 1 or lower(first(tags)) = "a"`, WithFunctions(fns))
+	require.NoError(t, err)
+	p, err := Compile(exp)
+	require.NoError(t, err)
+
+	syms := SymbolsMap{"x": 2, "tags": []string{}}
+	for name, eval := range map[string]func() (bool, error){
+		"evaluated": func() (bool, error) { return EvalExpression(exp, syms) },
+		"compiled":  func() (bool, error) { return p.Eval(syms) },
+		"traced": func() (bool, error) {
+			res, _, err := EvalExpressionTrace(exp, syms)
+			return res, err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := eval()
+			assert.ErrorContains(t, err, "function: first panicked: runtime error: index out of range")
+
+			var eerr *EvalError
+			require.ErrorAs(t, err, &eerr)
+			assert.Equal(t, 16, eerr.Start.Column, "located at the call")
+			assert.Equal(t, 27, eerr.End.Column)
+			assert.False(t, errors.As(eerr.Err, new(*EvalError)), "located once")
+		})
+	}
+}
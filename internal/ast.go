@@ -1,5 +1,16 @@
 package internal
 
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
 // BoolExpr is the grammar root. "or" (and "||") has the lowest precedence, so
 // an expression is a sequence of AND-expressions joined by "or", matching the
 // precedence used by Go and most languages where "and" binds tighter than "or".
@@ -27,28 +38,239 @@ type AndOpExpr struct {
 
 type Expr interface{}
 
+// NotExpr negates the primary expression that follows "not"/"!". It binds
+// tighter than "and", so "not a and b" reads as "(not a) and b", while a
+// comparison is negated as a whole: "not x = 1" is "not (x = 1)".
+type NotExpr struct {
+	Expr Expr `parser:"('not' | '!') @@"`
+}
+
+// SubExpr is a parenthesized expression, which the grammar reads as a
+// [Paren] standing for a whole [Compare].
 type SubExpr struct {
-	BoolExpr BoolExpr `parser:"'(' @@ ')'"`
+	BoolExpr BoolExpr
+}
+
+// NullTest tests an operand for null, "x is null" and "x is not null", or a
+// symbol for its presence, "x exists". The grammar reads the test as the tail
+// of a [Compare], whose Left becomes Operand after parsing.
+type NullTest struct {
+	Operand Operand
+	Exists  bool `parser:"  @'exists'"`
+	IsNull  bool `parser:"| 'is' ( @'null'"`
+	NotNull bool `parser:"| 'not' @'null' )"`
+
+	Pos    lexer.Position
+	EndPos lexer.Position
 }
 
 type Compare struct {
-	Left  Value        `parser:"@@"`
-	Op    ComparisonOp `parser:"@@"`
-	Right Value        `parser:"@@"`
+	Left  Operand      `parser:"@@"`
+	Op    ComparisonOp `parser:"( @@"`
+	Right Operand      `parser:"  @@"`
+	// Null is a null test following Left instead of an operator, so that
+	// an operand is parsed once whichever follows it. Such a comparison is
+	// replaced by Null after parsing, and one with neither by the
+	// [BoolValue] or [SubExpr] its Left stands for.
+	Null *NullTest `parser:"| @@ )?"`
+
+	// Pattern is the compiled pattern of a match, imatch, like or glob whose
+	// right operand is a string literal, set once after parsing.
+	Pattern *regexp.Regexp
+
+	// Pos and EndPos delimit the comparison's source text, EndPos being just
+	// past its last character.
+	Pos    lexer.Position
+	EndPos lexer.Position
+}
+
+// Operand is a side of a comparison: an arithmetic expression of terms joined
+// by "+" and "-", which bind looser than "*", "/" and "%". Most operands are a
+// single value, as returned by [Operand.Value].
+type Operand struct {
+	Term Term    `parser:"@@"`
+	Ops  []SumOp `parser:"@@*"`
+
+	Pos    lexer.Position
+	EndPos lexer.Position
+}
+
+// Value returns the value o consists of, or nil when o is an arithmetic
+// expression.
+func (o *Operand) Value() *Value {
+	if len(o.Ops) > 0 || len(o.Term.Ops) > 0 {
+		return nil
+	}
+
+	return o.Term.Factor.Value
+}
+
+// SumOp is a "+" or "-" followed by its right-hand term.
+type SumOp struct {
+	Op   string `parser:"@('+' | '-')"`
+	Term Term   `parser:"@@"`
+}
+
+// Term is a sequence of factors joined by "*", "/" and "%".
+type Term struct {
+	Factor Factor   `parser:"@@"`
+	Ops    []TermOp `parser:"@@*"`
+}
+
+// TermOp is a "*", "/" or "%" followed by its right-hand factor.
+type TermOp struct {
+	Op     string `parser:"@('*' | '/' | '%')"`
+	Factor Factor `parser:"@@"`
+}
+
+// Factor is a value, a parenthesized arithmetic expression or a negated
+// factor. A negative number literal is a value rather than a negation.
+type Factor struct {
+	Value *Value  `parser:"  @@"`
+	Paren *Paren  `parser:"| @@"`
+	Neg   *Factor `parser:"| '-' @@"`
+
+	// Group is the arithmetic expression a Paren stands for, which is
+	// replaced by Group, or by a Value holding a [List], after parsing.
+	Group *Operand
+}
+
+// Paren is anything in parentheses: a group, a list or a sub-expression.
+// Telling them apart takes the whole of its contents, and its place, so the
+// grammar reads them alike as comma-separated expressions, and each is
+// resolved after parsing. This way the parser never backtracks out of a
+// parenthesis, and takes time linear in the length of the source however
+// deeply parentheses nest.
+type Paren struct {
+	Elems []BoolExpr `parser:"'(' @@ (',' @@)* ')'"`
+
+	Pos    lexer.Position
+	EndPos lexer.Position
 }
 
+// BoolValue is a single value used as a condition, such as a boolean
+// symbol, which the grammar reads as a [Compare] with no operator.
 type BoolValue struct {
-	Value Value `parser:"@@"`
+	Value Value
 }
 
 type Value struct {
-	Float  *float64 `parser:"  @Float"`
-	Int    *int     `parser:"| @Int"`
-	String *string  `parser:"| @String"`
-	Bool   *Boolean `parser:"| @('true' | 'false')"`
-	Symbol *string  `parser:"| @Ident"`
+	Float    *float64  `parser:"  @('-'? Float)"`
+	Int      *int      `parser:"| @('-'? Int)"`
+	String   *string   `parser:"| @String"`
+	Time     *Time     `parser:"| @Time"`
+	Duration *Duration `parser:"| @('-'? Duration)"`
+	Bool     *Boolean  `parser:"| @('true' | 'false')"`
+	Null     bool      `parser:"| @'null'"`
+	Call     *Call     `parser:"| @@"`
+	Symbol   *string   `parser:"| (?! 'and' | 'or' | 'not' | 'in') @Ident"`
+	// Path follows Symbol into the value it names, such as
+	// items[0].sku; it is empty for a plain symbol.
+	Path []PathElem `parser:"@@*"`
+	// List is a list literal, which the grammar reads as a [Paren].
+	List *List
+
+	Pos    lexer.Position
+	EndPos lexer.Position
+}
+
+// Name returns the source text of a symbol operand, path included.
+func (v *Value) Name() string {
+	if len(v.Path) == 0 {
+		return *v.Symbol
+	}
+
+	var sb strings.Builder
+	sb.WriteString(*v.Symbol)
+	for _, e := range v.Path {
+		switch {
+		case e.Field != nil:
+			sb.WriteByte('.')
+			sb.WriteString(*e.Field)
+		case e.Index != nil:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(*e.Index))
+			sb.WriteByte(']')
+		case e.Key != nil:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Quote(*e.Key))
+			sb.WriteByte(']')
+		}
+	}
+
+	return sb.String()
+}
+
+// Call is a call to a function by name, such as lower(email). Its arguments
+// are operands, so they may be arithmetic expressions or calls themselves.
+type Call struct {
+	Name string    `parser:"(?! 'and' | 'or' | 'not' | 'in') @Ident '('"`
+	Args []Operand `parser:"(@@ (',' @@)*)? ')'"`
+
+	// Func is the function Name resolves to, set once after parsing. Its
+	// type belongs to the evaluator.
+	Func any
+}
+
+// PathElem is one step of a symbol path: a field or map key after a dot, or
+// an index or quoted key in brackets, for keys that are not identifiers.
+type PathElem struct {
+	Field *string `parser:"  '.' @Ident"`
+	Index *int    `parser:"| '[' @Int ']'"`
+	Key   *string `parser:"| '[' @String ']'"`
 }
 
+// List is a parenthesized, comma-separated list of values. It is only valid as
+// the right operand of "in"/"not in", and its elements may mix literals,
+// symbols and calls.
+type List struct {
+	Values []Value
+
+	// Set holds the elements of a literal-only list, built once after parsing
+	// so membership is a hash lookup instead of a scan. It is nil when any
+	// element is a symbol, a call, a time, a duration or null.
+	Set *LiteralSet
+}
+
+// LiteralSet is the hash set of a literal-only [List]. A list holds a single
+// kind of literal, so only the maps for that kind are non-nil; numeric lists
+// keep ints and floats apart so integers are matched exactly.
+type LiteralSet struct {
+	Strings map[string]struct{}
+	Ints    map[int]struct{}
+	Floats  map[float64]struct{}
+	Bools   map[bool]struct{}
+}
+
+// Add inserts the literal v into the set. Symbols are ignored: a list holding
+// a symbol has no set.
+func (s *LiteralSet) Add(v Value) {
+	switch {
+	case v.Int != nil:
+		if s.Ints == nil {
+			s.Ints = map[int]struct{}{}
+		}
+		s.Ints[*v.Int] = struct{}{}
+	case v.Float != nil:
+		if s.Floats == nil {
+			s.Floats = map[float64]struct{}{}
+		}
+		s.Floats[*v.Float] = struct{}{}
+	case v.String != nil:
+		if s.Strings == nil {
+			s.Strings = map[string]struct{}{}
+		}
+		s.Strings[*v.String] = struct{}{}
+	case v.Bool != nil:
+		if s.Bools == nil {
+			s.Bools = map[bool]struct{}{}
+		}
+		s.Bools[bool(*v.Bool)] = struct{}{}
+	}
+}
+
+// ComparisonOp is the operator of a comparison: one of the built-in ones, or
+// Custom, the name of an operator registered by the caller, such as in_cidr.
 type ComparisonOp struct {
 	Neq        bool `parser:"@'!' '='"`
 	Gte        bool `parser:"| @'>' '='"`
@@ -62,6 +284,131 @@ type ComparisonOp struct {
 	StartsWith bool `parser:"| @'starts_with'"`
 	EndsWith   bool `parser:"| @'ends_with'"`
 	Match      bool `parser:"| @'match'"`
+	// The case-insensitive variants of contains, starts_with, ends_with,
+	// match and "=".
+	IContains   bool `parser:"| @'icontains'"`
+	IStartsWith bool `parser:"| @'istarts_with'"`
+	IEndsWith   bool `parser:"| @'iends_with'"`
+	IMatch      bool `parser:"| @'imatch'"`
+	EqualFold   bool `parser:"| @'equals_fold'"`
+	// Like and Glob match SQL LIKE and shell wildcard patterns.
+	Like   bool   `parser:"| @'like'"`
+	Glob   bool   `parser:"| @'glob'"`
+	In     bool   `parser:"| @'in'"`
+	NotIn  bool   `parser:"| @('not' 'in')"`
+	Custom string `parser:"| (?! 'and' | 'or' | 'not' | 'in' | 'true' | 'false' | 'null' | 'exists' | 'is') @Ident"`
+
+	// Func is the operator Custom resolves to, set once after parsing. Its
+	// type belongs to the evaluator.
+	Func any
+
+	Pos    lexer.Position
+	EndPos lexer.Position
+}
+
+// Time is a timestamp literal in RFC 3339 format, such as
+// 2024-01-01T09:30:00+02:00, or a date, such as 2024-01-01, which is midnight
+// UTC. It must lie within the years 1678 to 2262, whose instants fit an int64
+// of nanoseconds since 1970.
+type Time struct {
+	time.Time
+}
+
+// MinTime and MaxTime bound the instants a Time can hold.
+var (
+	MinTime = time.Unix(0, math.MinInt64)
+	MaxTime = time.Unix(0, math.MaxInt64)
+)
+
+func (t *Time) Capture(values []string) error {
+	v, err := ParseTime(values[0])
+	t.Time = v
+	return err
+}
+
+// ParseTime parses a timestamp literal.
+func ParseTime(s string) (time.Time, error) {
+	layout := time.RFC3339Nano
+	if len(s) == len(time.DateOnly) {
+		layout = time.DateOnly
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if t.Before(MinTime) || t.After(MaxTime) {
+		return time.Time{}, fmt.Errorf("timestamp %q out of range", s)
+	}
+
+	return t, nil
+}
+
+// Duration is a duration literal in Go's format, such as 90m or 1h30m, where
+// d also stands for a day of 24 hours, as in 7d. A leading "-" negates it.
+type Duration time.Duration
+
+func (d *Duration) Capture(values []string) error {
+	v, err := ParseDuration(strings.Join(values, ""))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// ParseDuration parses a duration literal as [time.ParseDuration] does,
+// accepting d for days of 24 hours.
+func ParseDuration(s string) (time.Duration, error) {
+	if !strings.Contains(s, "d") {
+		return time.ParseDuration(s)
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	rest := strings.TrimPrefix(s, "-")
+
+	// Each number and its unit is parsed on its own, a day as 24 hours.
+	var total time.Duration
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		j := i + strings.IndexFunc(rest[i:], func(r rune) bool { return r >= '0' && r <= '9' })
+		if j < i {
+			j = len(rest)
+		}
+
+		num, unit := rest[:i], rest[i:j]
+		days := unit == "d"
+		if days {
+			unit = "h"
+		}
+
+		part, err := time.ParseDuration(num + unit)
+		if err != nil || days && part > math.MaxInt64/24 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		if days {
+			part *= 24
+		}
+
+		if total+part < total {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += part
+		rest = rest[j:]
+	}
+
+	if neg {
+		total = -total
+	}
+
+	return total, nil
 }
 
 type Boolean bool
@@ -0,0 +1,6 @@
+package internal
+
+// Tree returns the parsed tree of a boolexpr.Expression. It is set by package
+// boolexpr when it is initialized, so the other packages of this module can
+// walk an expression without the tree becoming part of the public API.
+var Tree func(exp any) *BoolExpr
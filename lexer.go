@@ -0,0 +1,118 @@
+package boolexpr
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"text/scanner"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/emad-elsaid/boolexpr/internal"
+)
+
+// Token types of the literals the text/scanner lexer has no tokens for,
+// numbered after its own.
+const (
+	timeToken lexer.TokenType = scanner.Comment - 1 - iota
+	durationToken
+)
+
+var (
+	timeLiteral     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(?:T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2}))?`)
+	durationLiteral = regexp.MustCompile(`^(?:\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h|d))+`)
+)
+
+// literalLexer is the text/scanner lexer, which also reads timestamp and
+// duration literals as single tokens: as text/scanner sees them, 2024-01-01
+// is a subtraction and 90m a number followed by a symbol.
+type literalLexer struct{}
+
+func (literalLexer) Symbols() map[string]lexer.TokenType {
+	symbols := lexer.TextScannerLexer.Symbols()
+	symbols["Time"] = timeToken
+	symbols["Duration"] = durationToken
+	return symbols
+}
+
+func (literalLexer) Lex(filename string, r io.Reader) (lexer.Lexer, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var s *scanner.Scanner
+	l, err := lexer.NewTextScannerLexer(func(sc *scanner.Scanner) { s = sc }).Lex(filename, strings.NewReader(string(src)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &literalScanner{Lexer: l, s: s, src: string(src), filename: filename}, nil
+}
+
+type literalScanner struct {
+	lexer.Lexer
+	s        *scanner.Scanner
+	src      string
+	filename string
+}
+
+// Next returns a timestamp or duration literal starting at the next token,
+// or else the token text/scanner reads there. A literal must not run into
+// the characters of an identifier or a number, so 1h30 is not a duration.
+func (l *literalScanner) Next() (lexer.Token, error) {
+	for ch := l.s.Peek(); ch >= 0 && ch < 64 && l.s.Whitespace&(1<<uint(ch)) != 0; ch = l.s.Peek() {
+		l.s.Next()
+	}
+
+	if ch := l.s.Peek(); ch < '0' || ch > '9' {
+		return l.Lexer.Next()
+	}
+
+	pos := l.s.Pos()
+	rest := l.src[pos.Offset:]
+	for _, lit := range []struct {
+		re    *regexp.Regexp
+		typ   lexer.TokenType
+		parse func(string) error
+	}{
+		{timeLiteral, timeToken, func(s string) error { _, err := internal.ParseTime(s); return err }},
+		{durationLiteral, durationToken, func(s string) error { _, err := internal.ParseDuration(s); return err }},
+	} {
+		text := lit.re.FindString(rest)
+		if text == "" {
+			continue
+		}
+
+		if r, _ := utf8.DecodeRuneInString(rest[len(text):]); r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+
+		tok := lexer.Token{Type: lit.typ, Value: text, Pos: lexer.Position(pos)}
+		tok.Pos.Filename = l.filename
+		if err := lit.parse(text); err != nil {
+			return lexer.Token{}, &literalError{msg: err.Error(), pos: tok.Pos, text: text}
+		}
+
+		for range utf8.RuneCountInString(text) {
+			l.s.Next()
+		}
+
+		return tok, nil
+	}
+
+	return l.Lexer.Next()
+}
+
+// literalError is a timestamp or duration literal that is well formed but
+// invalid, such as one out of range.
+type literalError struct {
+	msg  string
+	pos  lexer.Position
+	text string
+}
+
+func (e *literalError) Error() string            { return e.pos.String() + ": " + e.msg }
+func (e *literalError) Message() string          { return e.msg }
+func (e *literalError) Position() lexer.Position { return e.pos }
@@ -0,0 +1,99 @@
+package boolexpr
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/emad-elsaid/boolexpr/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexLiterals(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected []string
+	}{
+		{`90m > x`, []string{"Duration 90m", "> >", "Ident x"}},
+		{`x >= 1h30m`, []string{"Ident x", "> >", "= =", "Duration 1h30m"}},
+		{`x = -7d`, []string{"Ident x", "= =", "- -", "Duration 7d"}},
+		{`1.5h = 1µs`, []string{"Duration 1.5h", "= =", "Duration 1µs"}},
+		{`t > 2024-01-01`, []string{"Ident t", "> >", "Time 2024-01-01"}},
+		{"t >\n 2024-01-01T10:00:00.5+02:00", []string{"Ident t", "> >", "Time 2024-01-01T10:00:00.5+02:00"}},
+		{`2024-01-01T00:00:00Z=t`, []string{"Time 2024-01-01T00:00:00Z", "= =", "Ident t"}},
+		{`1h30 = 2`, []string{"Int 1", "Ident h30", "= =", "Int 2"}},
+		{`2024 - 01 - 01 = 2`, []string{"Int 2024", "- -", "Int 01", "- -", "Int 01", "= =", "Int 2"}},
+		{`2024-01-01x = 2`, []string{"Int 2024", "- -", "Int 01", "- -", "Int 01", "Ident x", "= =", "Int 2"}},
+		{`5m_ = 2`, []string{"Int 5", "Ident m_", "= =", "Int 2"}},
+		{`0x1d = 29`, []string{"Int 0x1d", "= =", "Int 29"}},
+	}
+
+	names := map[lexer.TokenType]string{}
+	for name, typ := range parser.Lexer().Symbols() {
+		names[typ] = name
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			tokens, err := parser.Lex("", strings.NewReader(tc.input))
+			require.NoError(t, err)
+
+			var got []string
+			for _, tok := range tokens[:len(tokens)-1] {
+				name, ok := names[tok.Type]
+				if !ok {
+					name = string(rune(tok.Type))
+				}
+				got = append(got, name+" "+tok.Value)
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestLexLiteralPositions(t *testing.T) {
+	tokens, err := parser.Lex("", strings.NewReader("x >\n  2024-01-01 and y < 1h"))
+	require.NoError(t, err)
+
+	assert.Equal(t, lexer.Position{Offset: 6, Line: 2, Column: 3}, tokens[2].Pos)
+	assert.Equal(t, lexer.Position{Offset: 17, Line: 2, Column: 14}, tokens[3].Pos)
+	assert.Equal(t, lexer.Position{Offset: 25, Line: 2, Column: 22}, tokens[6].Pos)
+}
+
+func TestParseDuration(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"1d12h30m", 36*time.Hour + 30*time.Minute, false},
+		{"-2d", -48 * time.Hour, false},
+		{"0s", 0, false},
+		{"106751d", 106751 * 24 * time.Hour, false},
+		{"106752d", 0, true},
+		{"106751d1000h", 0, true},
+		{"d", 0, true},
+		{"1x", 0, true},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			d, err := internal.ParseDuration(tc.input)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, d)
+		})
+	}
+}
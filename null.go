@@ -0,0 +1,192 @@
+package boolexpr
+
+import (
+	"errors"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// MissingSymbols chooses how evaluation treats a missing symbol: one [Symbols]
+// reports with [ErrSymbolNotFound], or whose path leads to no value. It is
+// given with [WithMissingSymbols].
+type MissingSymbols uint8
+
+const (
+	// MissingError fails evaluation with [ErrSymbolNotFound]. It is the
+	// default.
+	MissingError MissingSymbols = iota + 1
+	// MissingNull evaluates a missing symbol as null.
+	MissingNull
+	// MissingThreeValued evaluates a missing symbol as null, and follows
+	// SQL's three-valued logic: a comparison with null is unknown, as is a
+	// bare null, and "and", "or" and "not" follow Kleene's rules, so false
+	// and unknown is false, true or unknown is true, and not unknown is
+	// unknown. An expression that is unknown in the end evaluates to false.
+	MissingThreeValued
+)
+
+// errUnknown is returned in place of a result by a node that is unknown under
+// [MissingThreeValued]. It is never wrapped, nor returned to the caller:
+// "and" and "or" resolve it by Kleene's rules, and evaluation turns it into
+// false at the root.
+var errUnknown = errors.New("unknown")
+
+// evalOptions returns the options of the evaluation syms is given to, or nil.
+func evalOptions(syms Symbols) *options {
+	switch s := syms.(type) {
+	case optionSymbols:
+		return s.opts
+	case *tracer:
+		return evalOptions(s.syms)
+	default:
+		return nil
+	}
+}
+
+func missingMode(syms Symbols) MissingSymbols {
+	if o := evalOptions(syms); o != nil && o.missing != 0 {
+		return o.missing
+	}
+
+	return MissingError
+}
+
+// withOptions returns syms carrying the options opts of an evaluation, and m
+// when opts leave the [MissingSymbols] unset. It returns syms itself when
+// there is nothing to carry.
+func withOptions(syms Symbols, opts []Option, m MissingSymbols) Symbols {
+	if len(opts) == 0 {
+		if m == 0 || m == MissingError {
+			return syms
+		}
+
+		return optionSymbols{Symbols: syms, opts: &missingOptions[m]}
+	}
+
+	o := newOptions(opts)
+	if o.missing == 0 {
+		o.missing = m
+	}
+
+	return optionSymbols{Symbols: syms, opts: o}
+}
+
+// missingOptions are the options of an evaluation given none but the
+// [MissingSymbols] the expression was parsed with.
+var missingOptions = [...]options{
+	MissingNull:        {missing: MissingNull},
+	MissingThreeValued: {missing: MissingThreeValued},
+}
+
+// missingSymbol returns the error of a symbol that could not be resolved with
+// err: nil, for the symbol to be null, when err reports it missing and the
+// evaluation allows that, or else err.
+func missingSymbol(syms Symbols, err error) error {
+	if errors.Is(err, ErrSymbolNotFound) && missingMode(syms) != MissingError {
+		return nil
+	}
+
+	return err
+}
+
+// isNull reports whether v is null: the null literal, a missing symbol, or a
+// symbol or function whose value is nil.
+func (v evalVal) isNull() bool {
+	return v.kind == kindAny && v.a == nil
+}
+
+// nullCompare compares l and r by o when either of them is null. Under
+// [MissingThreeValued] the comparison is unknown. Otherwise null is only
+// equal to null, so "=" is true when both are null and "!=" when only one
+// is, "excludes" is always true, and every other operator false.
+func nullCompare(o ComparisonOp, l, r evalVal, syms Symbols) (bool, error) {
+	if missingMode(syms) == MissingThreeValued {
+		return false, errUnknown
+	}
+
+	switch {
+	case o.Eq || o.EqEq:
+		return l.isNull() && r.isNull(), nil
+	case o.Neq:
+		return l.isNull() != r.isNull(), nil
+	case o.Excludes:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// nullCondition is the result of a null used as a condition: unknown under
+// [MissingThreeValued], and false otherwise.
+func nullCondition(syms Symbols) (bool, error) {
+	if missingMode(syms) == MissingThreeValued {
+		return false, errUnknown
+	}
+
+	return false, nil
+}
+
+// evalNullTest evaluates "x exists", which is true when the symbol x is
+// present, even when it is nil, and "x is null" and its negation, which
+// evaluate x like any operand.
+func evalNullTest(t *NullTest, syms Symbols) (bool, error) {
+	if t.Exists {
+		_, err := lookupSymbol(t.Operand.Value(), syms)
+		if errors.Is(err, ErrSymbolNotFound) {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+
+	v, err := evalOperand(&t.Operand, syms)
+	if err != nil {
+		return false, err
+	}
+
+	return v.isNull() == t.IsNull, nil
+}
+
+// kleene tracks whether an operand of an "and" or "or" was unknown. Such an
+// operand is read as the one that doesn't decide the result, true for "and"
+// and false for "or", and the result is unknown unless another operand
+// decides it.
+type kleene struct{ unknown bool }
+
+func (k *kleene) and(res bool, err error) (bool, error) {
+	if err == errUnknown {
+		k.unknown = true
+		return true, nil
+	}
+
+	return res, err
+}
+
+func (k *kleene) or(res bool, err error) (bool, error) {
+	if err == errUnknown {
+		k.unknown = true
+		return false, nil
+	}
+
+	return res, err
+}
+
+// result is the result of an "and" or "or" whose operands evaluated to res:
+// res when an operand decided it, which is false for "and" and true for
+// "or", as given by decided, and unknown otherwise when one was unknown.
+func (k *kleene) result(res, decided bool) (bool, error) {
+	if k.unknown && res != decided {
+		return false, errUnknown
+	}
+
+	return res, nil
+}
+
+// knownResult turns the result of an expression that is unknown into false.
+func knownResult(res bool, err error) (bool, error) {
+	if err == errUnknown {
+		return false, nil
+	}
+
+	return res, err
+}
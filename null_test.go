@@ -0,0 +1,151 @@
+package boolexpr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nullTests hold the result of each input under MissingError, MissingNull and
+// MissingThreeValued, in that order: a bool, or the error it fails with. "m"
+// is missing, "n" is nil.
+var nullTests = []struct {
+	input    string
+	expected [3]any
+}{
+	{`m = 1`, [3]any{ErrSymbolNotFound, false, false}},
+	{`m != 1`, [3]any{ErrSymbolNotFound, true, false}},
+	{`not m = 1`, [3]any{ErrSymbolNotFound, true, false}},
+	{`m = null`, [3]any{ErrSymbolNotFound, true, false}},
+	{`m excludes "a"`, [3]any{ErrSymbolNotFound, true, false}},
+	{`n = null`, [3]any{true, true, false}},
+	{`n != 1`, [3]any{true, true, false}},
+	{`n > 1`, [3]any{false, false, false}},
+	{`null = null`, [3]any{true, true, false}},
+	{`null != null`, [3]any{false, false, false}},
+	{`m > 1 or x = 1`, [3]any{ErrSymbolNotFound, true, true}},
+	{`x = 1 or m > 1`, [3]any{true, true, true}},
+	{`m > 1 and x = 2`, [3]any{ErrSymbolNotFound, false, false}},
+	{`not (m > 1 and x = 2)`, [3]any{ErrSymbolNotFound, true, true}},
+	{`not (m > 1 and x = 1)`, [3]any{ErrSymbolNotFound, true, false}},
+	{`not (m > 1 or x = 2)`, [3]any{ErrSymbolNotFound, true, false}},
+	{`not (m > 1 or x = 1)`, [3]any{ErrSymbolNotFound, false, false}},
+	{`m`, [3]any{ErrSymbolNotFound, false, false}},
+	{`not m`, [3]any{ErrSymbolNotFound, true, false}},
+	{`not n`, [3]any{true, true, false}},
+	{`not (b and n)`, [3]any{true, true, false}},
+	{`not (not b and n)`, [3]any{true, true, true}},
+	{`m exists`, [3]any{false, false, false}},
+	{`n exists and x exists`, [3]any{true, true, true}},
+	{`not m exists`, [3]any{true, true, true}},
+	{`m is null`, [3]any{ErrSymbolNotFound, true, true}},
+	{`m is not null`, [3]any{ErrSymbolNotFound, false, false}},
+	{`n is null and x is not null`, [3]any{true, true, true}},
+	{`m + 1 is null`, [3]any{ErrSymbolNotFound, true, true}},
+	{`-n is null and n * 2 is null`, [3]any{true, true, true}},
+	{`lower(n) is null and len(n) is null`, [3]any{true, true, true}},
+	{`n + 1 > 0`, [3]any{false, false, false}},
+	{`m in (1, 2)`, [3]any{ErrSymbolNotFound, false, false}},
+	{`not m in (1, 2)`, [3]any{ErrSymbolNotFound, true, false}},
+	{`m not in (1, 2)`, [3]any{ErrSymbolNotFound, true, false}},
+	{`n in (1, null)`, [3]any{true, true, false}},
+	{`x in (1, null)`, [3]any{true, true, true}},
+	{`x in (2, null)`, [3]any{false, false, false}},
+	{`not x in (2, null)`, [3]any{true, true, false}},
+	{`x not in (2, null)`, [3]any{true, true, false}},
+	{`n in tags`, [3]any{false, false, false}},
+	{`tags contains n`, [3]any{false, false, false}},
+	{`s contains m`, [3]any{ErrSymbolNotFound, false, false}},
+	{`m match "a"`, [3]any{ErrSymbolNotFound, false, false}},
+	{`not m.a = 1`, [3]any{ErrSymbolNotFound, true, false}},
+	{`obj.missing = null`, [3]any{ErrSymbolNotFound, true, false}},
+	{`obj.a is not null`, [3]any{true, true, true}},
+}
+
+func TestMissingSymbols(t *testing.T) {
+	syms := SymbolsMap{
+		"x":    1,
+		"n":    nil,
+		"s":    "abc",
+		"b":    true,
+		"tags": []string{"a"},
+		"obj":  map[string]any{"a": 1},
+	}
+	modes := []MissingSymbols{MissingError, MissingNull, MissingThreeValued}
+
+	for _, tc := range nullTests {
+		tc := tc
+		for i, m := range modes {
+			m, expected := m, tc.expected[i]
+			t.Run(fmt.Sprintf("%s/%d", tc.input, m), func(t *testing.T) {
+				exp, err := Parse(tc.input, WithMissingSymbols(m))
+				require.NoError(t, err)
+
+				p, err := Compile(exp)
+				require.NoError(t, err)
+
+				results := map[string]func() (bool, error){
+					"eval": func() (bool, error) { return EvalExpression(exp, syms) },
+					"compiled": func() (bool, error) {
+						return p.Eval(syms)
+					},
+					"traced": func() (bool, error) {
+						res, _, err := EvalExpressionTrace(exp, syms)
+						return res, err
+					},
+				}
+
+				for name, eval := range results {
+					res, err := eval()
+					if want, ok := expected.(error); ok {
+						assert.ErrorIs(t, err, want, name)
+						continue
+					}
+
+					require.NoError(t, err, name)
+					assert.Equal(t, expected, res, name)
+				}
+			})
+		}
+	}
+}
+
+func TestWithMissingSymbolsAtEval(t *testing.T) {
+	exp, err := Parse(`m != 1`, WithMissingSymbols(MissingThreeValued))
+	require.NoError(t, err)
+
+	res, err := EvalExpression(exp, SymbolsMap{})
+	require.NoError(t, err)
+	assert.False(t, res)
+
+	res, err = EvalExpression(exp, SymbolsMap{}, WithMissingSymbols(MissingNull))
+	require.NoError(t, err)
+	assert.True(t, res)
+
+	_, err = EvalExpression(exp, SymbolsMap{}, WithMissingSymbols(MissingError))
+	assert.ErrorIs(t, err, ErrSymbolNotFound)
+}
+
+// failingSymbols fails every Get with ErrOpDoesnotHaveVal.
+type failingSymbols struct{}
+
+func (failingSymbols) Get(string) (any, error) { return nil, ErrOpDoesnotHaveVal }
+
+func TestNullErrors(t *testing.T) {
+	// Symbols fail with errors other than ErrSymbolNotFound in every mode.
+	var failing failingSymbols
+	for _, m := range []MissingSymbols{MissingNull, MissingThreeValued} {
+		for _, input := range []string{`x = 1`, `x exists`, `x is null`} {
+			exp, err := Parse(input, WithMissingSymbols(m))
+			require.NoError(t, err)
+
+			_, err = EvalExpression(exp, failing)
+			assert.ErrorIs(t, err, ErrOpDoesnotHaveVal, input)
+		}
+	}
+
+	_, err := Parse(`lower(x) exists`)
+	assert.ErrorIs(t, err, ErrorWrongDataType)
+}
@@ -8,10 +8,27 @@ import (
 // ListSymbols returns the unique symbol names referenced anywhere in the parsed
 // expression, in no particular order. It is useful for validating that every
 // required symbol is available before evaluation, or for building the Symbols
-// set on demand.
+// set on demand. A symbol with a path is listed by its root: items[0].sku is
+// items, the name looked up in [Symbols].
 func ListSymbols(exp Expression) []string {
+	return listSymbols(exp.e, rootName)
+}
+
+// ListSymbolPaths returns the unique symbols referenced anywhere in the parsed
+// expression with their paths, in no particular order: items[0].sku is listed
+// as is, next to any other path or plain use of items.
+func ListSymbolPaths(exp Expression) []string {
+	return listSymbols(exp.e, (*Value).Name)
+}
+
+// rootName is the name of the root symbol of v, as looked up in [Symbols].
+func rootName(v *Value) string { return *v.Symbol }
+
+// listSymbols walks node, any node of an expression, and returns the unique
+// names of its symbol operands, as given by name.
+func listSymbols(node any, name func(*Value) string) []string {
 	var stack types.Slice[any]
-	stack = stack.Push(exp.e)
+	stack = stack.Push(node)
 	syms := types.Slice[string]{}
 
 	for len(stack) > 0 {
@@ -23,17 +40,33 @@ func ListSymbols(exp Expression) []string {
 			stack = pushBoolExpr(stack, i)
 		case *BoolExpr:
 			stack = pushBoolExpr(stack, *i)
-		case Compare:
-			stack = stack.Push(i.Left)
-			stack = stack.Push(i.Right)
-		case BoolValue:
+		case *Compare:
+			push := func(v *Value) { stack = stack.Push(*v) }
+			walkOperand(&i.Left, push)
+			walkOperand(&i.Right, push)
+		case *NullTest:
+			walkOperand(&i.Operand, func(v *Value) { stack = stack.Push(*v) })
+		case *BoolValue:
 			stack = stack.Push(i.Value)
 		case Value:
 			if i.Symbol != nil {
-				syms = syms.Push(*i.Symbol)
+				syms = syms.Push(name(&i))
+			}
+			if i.Call != nil {
+				push := func(v *Value) { stack = stack.Push(*v) }
+				for j := range i.Call.Args {
+					walkOperand(&i.Call.Args[j], push)
+				}
+			}
+			if i.List != nil {
+				for _, v := range i.List.Values {
+					stack = stack.Push(v)
+				}
 			}
-		case SubExpr:
+		case *SubExpr:
 			stack = stack.Push(i.BoolExpr)
+		case *NotExpr:
+			stack = stack.Push(i.Expr)
 		}
 	}
 
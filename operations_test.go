@@ -12,11 +12,28 @@ a >= b or
 c < d or
 ( e = "hello" or f = "world" ) and
 g = h or
-a = b`,
+not (a = b) and !i or
+j in (1, k)`,
 	)
 	assert.NoError(t, err)
 
 	actual := ListSymbols(exp)
-	expected := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	expected := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}
 	assert.ElementsMatch(t, expected, actual)
 }
+
+func TestListSymbolPaths(t *testing.T) {
+	exp, err := Parse(`items[0].sku = "a" and items[1].sku = sku or meta["x-key"] in (1, items[0].sku) or meta`)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"items", "sku", "meta"}, ListSymbols(exp))
+	assert.ElementsMatch(t, []string{"items[0].sku", "items[1].sku", "sku", `meta["x-key"]`, "meta"}, ListSymbolPaths(exp))
+}
+
+func TestListSymbolsInCalls(t *testing.T) {
+	exp, err := Parse(`len(lower(a) + b) > max(c, 1 - d.e) or x in (abs(f), 2)`)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "f", "x"}, ListSymbols(exp))
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d.e", "f", "x"}, ListSymbolPaths(exp))
+}
@@ -0,0 +1,95 @@
+package boolexpr
+
+import (
+	"fmt"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// OperatorFunc compares the values of the left and right operands of a
+// registered operator. Operands are passed as evaluation found them: the
+// value of a symbol as its [Symbols] returned it, a literal as a bool, int,
+// float64 or string. A non-nil error aborts evaluation.
+type OperatorFunc func(l, r any) (bool, error)
+
+// Operators is a registry of infix operators an expression may compare with
+// besides the built-in ones, given to [Parse] and [EvalExpression] with
+// [WithOperators]:
+//
+//	ip in_cidr "10.0.0.0/8" and version semver_gte "1.4.0"
+//
+// Register every operator before the registry is used; it may then be used
+// concurrently. The zero value is an empty registry ready to use.
+type Operators struct {
+	ops map[string]OperatorFunc
+}
+
+// NewOperators returns an empty registry.
+func NewOperators() *Operators {
+	return &Operators{ops: map[string]OperatorFunc{}}
+}
+
+// Register adds fn to the registry as the operator name, replacing any
+// operator already registered under that name.
+//
+// Register returns an error wrapping [ErrInvalidOperator] when name is not an
+// identifier, is a reserved word, or names a built-in operator such as
+// contains or match, or when fn is nil.
+func (o *Operators) Register(name string, fn OperatorFunc) error {
+	if !validOperatorName(name) {
+		return fmt.Errorf("%w, %q is not a valid operator name", ErrInvalidOperator, name)
+	}
+
+	if fn == nil {
+		return fmt.Errorf("%w, %s: nil func", ErrInvalidOperator, name)
+	}
+
+	if o.ops == nil {
+		o.ops = map[string]OperatorFunc{}
+	}
+	o.ops[name] = fn
+	return nil
+}
+
+// lookup returns the operator registered in o as name, or nil when there is
+// none.
+func (o *Operators) lookup(name string) OperatorFunc {
+	if o == nil {
+		return nil
+	}
+
+	return o.ops[name]
+}
+
+func validOperatorName(name string) bool {
+	switch name {
+	case "contains", "excludes", "starts_with", "ends_with", "match", "icontains", "istarts_with",
+		"iends_with", "imatch", "equals_fold", "like", "glob", "exists", "is":
+		return false
+	}
+
+	return validFunctionName(name)
+}
+
+// operatorEval compares l and r by the registered operator of o, or the one
+// of the same name given to the evaluation with [WithOperators]. A null
+// operand is given to it as nil, but for [MissingThreeValued], under which
+// the comparison is unknown.
+func operatorEval(o *ComparisonOp, l, r evalVal, syms Symbols) (bool, error) {
+	if (l.isNull() || r.isNull()) && missingMode(syms) == MissingThreeValued {
+		return false, errUnknown
+	}
+
+	fn, ok := o.Func.(OperatorFunc)
+	if !ok {
+		return false, fmt.Errorf("%w, %s", ErrUnknownOperator, o.Custom)
+	}
+
+	if opts := evalOptions(syms); opts != nil {
+		if g := opts.ops.lookup(o.Custom); g != nil {
+			fn = g
+		}
+	}
+
+	return fn(l.toAny(), r.toAny())
+}
@@ -0,0 +1,210 @@
+package boolexpr
+
+import (
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOperators returns operators on IP addresses and versions, as a caller
+// would register them.
+func testOperators(t *testing.T) *Operators {
+	ops := NewOperators()
+	require.NoError(t, ops.Register("in_cidr", func(l, r any) (bool, error) {
+		ls, _ := l.(string)
+		rs, _ := r.(string)
+		addr, err := netip.ParseAddr(ls)
+		if err != nil {
+			return false, err
+		}
+
+		prefix, err := netip.ParsePrefix(rs)
+		if err != nil {
+			return false, err
+		}
+
+		return prefix.Contains(addr), nil
+	}))
+	require.NoError(t, ops.Register("semver_gte", func(l, r any) (bool, error) {
+		ls, _ := l.(string)
+		rs, _ := r.(string)
+		lv, rv := strings.Split(ls, "."), strings.Split(rs, ".")
+		for i := range min(len(lv), len(rv)) {
+			a, _ := strconv.Atoi(lv[i])
+			b, _ := strconv.Atoi(rv[i])
+			if a != b {
+				return a > b, nil
+			}
+		}
+
+		return len(lv) >= len(rv), nil
+	}))
+	require.NoError(t, ops.Register("divides", func(l, r any) (bool, error) {
+		li, _ := l.(int)
+		ri, _ := r.(int)
+		return li != 0 && ri%li == 0, nil
+	}))
+
+	return ops
+}
+
+func TestOperatorsRegister(t *testing.T) {
+	nop := func(l, r any) (bool, error) { return false, nil }
+
+	for _, name := range []string{"in_cidr", "semver_gte", "near", "_x1", "größer"} {
+		assert.NoError(t, NewOperators().Register(name, nop), name)
+	}
+
+	for _, name := range []string{"", "1x", "a-b", "and", "or", "not", "in", "true", "false",
+		"contains", "excludes", "starts_with", "ends_with", "match", "null", "exists", "is"} {
+		assert.ErrorIs(t, NewOperators().Register(name, nop), ErrInvalidOperator, name)
+	}
+
+	assert.ErrorIs(t, NewOperators().Register("near", nil), ErrInvalidOperator)
+
+	var ops Operators
+	require.NoError(t, ops.Register("near", func(l, r any) (bool, error) { return l == r, nil }))
+	res, err := Eval(`x near 1`, SymbolsMap{"x": 1}, WithOperators(&ops))
+	require.NoError(t, err)
+	assert.True(t, res)
+}
+
+func TestOperators(t *testing.T) {
+	ops := testOperators(t)
+	syms := SymbolsMap{
+		"ip":      "10.1.2.3",
+		"version": "1.10.0",
+		"n":       3,
+		"tags":    []string{"eu"},
+	}
+
+	tcs := []struct {
+		input    string
+		expected bool
+	}{
+		{`ip in_cidr "10.0.0.0/8"`, true},
+		{`ip in_cidr "192.168.0.0/16"`, false},
+		{`version semver_gte "1.4.0"`, true},
+		{`"1.2" semver_gte version`, false},
+		{`ip in_cidr "10.0.0.0/8" and version semver_gte "1.4.0"`, true},
+		{`not ip in_cidr "10.0.0.0/8" or n = 3`, true},
+		{`n divides n * 4 and not (n divides n + 1)`, true},
+		{`n divides 9 and tags contains "eu"`, true},
+		{`ip in_cidr ("10.0.0.0/" + "8")`, true},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input, WithOperators(ops))
+			require.NoError(t, err)
+
+			res, err := EvalExpression(exp, syms)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+
+			p, err := Compile(exp)
+			require.NoError(t, err)
+			res, err = p.Eval(syms)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res, "compiled")
+
+			res, _, err = EvalExpressionTrace(exp, syms)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res, "traced")
+		})
+	}
+
+	t.Run("null", func(t *testing.T) {
+		// divides gets nil for gone, and 0 when asserted to int; under
+		// MissingThreeValued it isn't called at all.
+		for m, expected := range map[MissingSymbols]bool{MissingNull: true, MissingThreeValued: false} {
+			exp, err := Parse(`not gone divides 4`, WithOperators(ops), WithMissingSymbols(m))
+			require.NoError(t, err)
+
+			res, err := EvalExpression(exp, syms)
+			require.NoError(t, err)
+			assert.Equal(t, expected, res, m)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := Parse(`x = 1 or ip in_cidr "10.0.0.0/8"`)
+		assert.ErrorIs(t, err, ErrUnknownOperator)
+		assert.EqualError(t, err, `1:13: Operator not found, in_cidr`)
+
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, Position{Offset: 12, Line: 1, Column: 13}, perr.Position)
+		assert.Equal(t, "in_cidr", perr.Got)
+
+		_, err = Parse(`ip in_cidrs "10.0.0.0/8"`, WithOperators(ops))
+		assert.ErrorIs(t, err, ErrUnknownOperator)
+	})
+
+	t.Run("not an operator", func(t *testing.T) {
+		for _, input := range []string{`a b`, `a and b c`, `a true 1`} {
+			_, err := Parse(input, WithOperators(ops))
+			var perr *ParseError
+			assert.ErrorAs(t, err, &perr, input)
+		}
+	})
+
+	t.Run("evaluation errors", func(t *testing.T) {
+		_, err := Eval(`n = 3 and ip in_cidr "10.0.0.0"`, syms, WithOperators(ops))
+		var eerr *EvalError
+		require.ErrorAs(t, err, &eerr)
+		assert.Equal(t, Position{Offset: 10, Line: 1, Column: 11}, eerr.Start)
+		assert.ErrorContains(t, err, "netip.ParsePrefix")
+	})
+
+	t.Run("bound at evaluation", func(t *testing.T) {
+		exp, err := Parse(`ip in_cidr "10.0.0.0/8"`, WithOperators(ops))
+		require.NoError(t, err)
+
+		errBlocked := errors.New("blocked")
+		other := NewOperators()
+		require.NoError(t, other.Register("in_cidr", func(l, r any) (bool, error) { return false, errBlocked }))
+
+		_, err = EvalExpression(exp, syms, WithOperators(other))
+		assert.ErrorIs(t, err, errBlocked)
+
+		res, err := EvalExpression(exp, syms, WithOperators(NewOperators()))
+		require.NoError(t, err)
+		assert.True(t, res, "an operator missing from the evaluation's keeps the parsed one")
+	})
+
+	t.Run("listed, formatted and checked", func(t *testing.T) {
+		input := `ip in_cidr net and version semver_gte min_version and n divides m + 1`
+		exp, err := Parse(input, WithOperators(ops))
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{"ip", "net", "version", "min_version", "n", "m"}, ListSymbols(exp))
+		assert.Equal(t, input, exp.String())
+
+		again, err := Parse(exp.String(), WithOperators(ops))
+		require.NoError(t, err)
+		assert.Equal(t, input, again.String())
+
+		assert.NoError(t, Check(exp, Schema{"ip": KindString, "net": KindInt, "version": KindBool,
+			"min_version": KindString, "n": KindInt, "m": KindInt}))
+	})
+
+	t.Run("partially evaluated", func(t *testing.T) {
+		exp, err := Parse(`ip in_cidr "10.0.0.0/8" and version semver_gte v`, WithOperators(ops))
+		require.NoError(t, err)
+
+		res, err := PartialEval(exp, SymbolsMap{"ip": "10.0.0.1"})
+		require.NoError(t, err)
+		assert.Equal(t, `version semver_gte v`, res.String())
+
+		ok, err := EvalExpression(res, SymbolsMap{"version": "2.0", "v": "1.9"})
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
@@ -0,0 +1,261 @@
+package boolexpr
+
+import (
+	"math"
+	"slices"
+	"sync"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// Costs are the estimates [Optimize] orders the operands of "and" and "or"
+// by. The cost of a comparison is the base cost of its operator plus the cost
+// of each symbol it looks up; that of a bare value or null test, the cost of
+// its symbols, plus that of "is null", "is not null" or "exists" for a null
+// test. The units are up to the caller, such as microseconds.
+type Costs struct {
+	// Symbols holds the cost of looking up each symbol, by name. Symbols
+	// absent from it cost nothing.
+	Symbols map[string]float64
+	// Operators holds the base cost of a comparison by each operator, named
+	// as in the canonical text of an expression: "=", "match", "in", "not
+	// in", a custom operator's name, or "is null", "is not null" and
+	// "exists" for null tests. Operators absent from it cost 1.
+	Operators map[string]float64
+	// Stats, when not nil, gives the observed selectivity of operands: how
+	// often each is true. Without it, each operand is assumed to be true
+	// half of the time.
+	Stats *Stats
+}
+
+// Optimize returns e with the operands of each "and" and "or" reordered to
+// evaluate first those most likely to decide it for the least cost, as
+// estimated from c: an operand of "and" by its cost over its chance of being
+// false, and one of "or" by its cost over its chance of being true. A
+// parenthesized operand is optimized in turn, and costs what evaluating it
+// is expected to, following short-circuiting. Operands of equal estimates
+// keep their order.
+//
+// As "and" and "or" are commutative, the result is that of e whenever none
+// of the operands fails; when some do, which error is returned, if any, may
+// differ, since evaluation may reach them in another order. The zero value is
+// returned as is.
+func Optimize(e Expression, c Costs) Expression {
+	if e.e == nil {
+		return e
+	}
+
+	o := optimizer{costs: c}
+	b, _ := o.boolExpr(e.e)
+	return Expression{e: b, missing: e.missing}
+}
+
+// estimate is the expected cost of evaluating a node, and the probability it
+// is true.
+type estimate struct {
+	cost, p float64
+}
+
+type optimizer struct {
+	costs Costs
+}
+
+// operand is an operand of "and" or "or" and its estimate.
+type operand[T any] struct {
+	x T
+	estimate
+}
+
+func (o *optimizer) boolExpr(b *BoolExpr) (*BoolExpr, estimate) {
+	ands := make([]operand[AndExpr], 0, len(b.OrOps)+1)
+	a, est := o.andExpr(&b.And)
+	ands = append(ands, operand[AndExpr]{a, est})
+	for i := range b.OrOps {
+		a, est := o.andExpr(&b.OrOps[i].And)
+		ands = append(ands, operand[AndExpr]{a, est})
+	}
+
+	// An operand of "or" decides it when it is true.
+	est = order(ands, func(p float64) float64 { return p })
+
+	r := &BoolExpr{And: ands[0].x}
+	for _, a := range ands[1:] {
+		r.OrOps = append(r.OrOps, OrOpExpr{And: a.x})
+	}
+
+	return r, estimate{cost: est.cost, p: 1 - est.p}
+}
+
+func (o *optimizer) andExpr(a *AndExpr) (AndExpr, estimate) {
+	xs := make([]operand[Expr], 0, len(a.AndOps)+1)
+	x, est := o.expr(a.Expr)
+	xs = append(xs, operand[Expr]{x, est})
+	for _, op := range a.AndOps {
+		x, est := o.expr(op.Expr)
+		xs = append(xs, operand[Expr]{x, est})
+	}
+
+	// An operand of "and" decides it when it is false.
+	est = order(xs, func(p float64) float64 { return 1 - p })
+
+	r := AndExpr{Expr: xs[0].x}
+	for _, x := range xs[1:] {
+		r.AndOps = append(r.AndOps, AndOpExpr{Expr: x.x})
+	}
+
+	return r, est
+}
+
+// order sorts xs by their cost over decides, their chance of deciding the
+// result, and returns the expected cost of evaluating them in that order,
+// with the probability that none decides it: that "and" is true, or that "or"
+// is false.
+func order[T any](xs []operand[T], decides func(p float64) float64) estimate {
+	rank := func(e estimate) float64 {
+		d := decides(e.p)
+		if d <= 0 {
+			return math.Inf(1)
+		}
+
+		return e.cost / d
+	}
+
+	slices.SortStableFunc(xs, func(a, b operand[T]) int {
+		ra, rb := rank(a.estimate), rank(b.estimate)
+		switch {
+		case ra < rb:
+			return -1
+		case ra > rb:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	est := estimate{p: 1}
+	for _, x := range xs {
+		est.cost += est.p * x.cost
+		est.p *= 1 - decides(x.p)
+	}
+
+	return est
+}
+
+func (o *optimizer) expr(x Expr) (Expr, estimate) {
+	switch e := x.(type) {
+	case *Compare:
+		return e, o.leaf(e, o.operatorCost(opName(e.Op)))
+	case *NullTest:
+		return e, o.leaf(e, o.operatorCost(nullTestOp(e)))
+	case *BoolValue:
+		return e, o.leaf(e, 0)
+	case *SubExpr:
+		b, est := o.boolExpr(&e.BoolExpr)
+		return &SubExpr{BoolExpr: *b}, est
+	case *NotExpr:
+		inner, est := o.expr(e.Expr)
+		r := &NotExpr{Expr: inner}
+		return r, estimate{cost: est.cost, p: o.selectivity(r, 1-est.p)}
+	default:
+		return x, estimate{p: 0.5}
+	}
+}
+
+// leaf estimates a comparison, bare value or null test x whose operator costs
+// base.
+func (o *optimizer) leaf(x Expr, base float64) estimate {
+	cost := base
+	for _, name := range listSymbols(x, rootName) {
+		cost += o.costs.Symbols[name]
+	}
+
+	return estimate{cost: cost, p: o.selectivity(x, 0.5)}
+}
+
+func (o *optimizer) operatorCost(name string) float64 {
+	if c, ok := o.costs.Operators[name]; ok {
+		return c
+	}
+
+	return 1
+}
+
+// selectivity returns the observed probability that x is true, or def when
+// nothing was observed.
+func (o *optimizer) selectivity(x Expr, def float64) float64 {
+	if o.costs.Stats == nil {
+		return def
+	}
+
+	if p, ok := o.costs.Stats.Selectivity(exprText(x)); ok {
+		return p
+	}
+
+	return def
+}
+
+// Stats records how often the nodes of evaluated expressions are true, from
+// their traces, for [Optimize] to estimate their selectivity. Nodes are told
+// apart by their canonical text, so the same comparison is counted together
+// across expressions. It is safe for concurrent use; the zero value is ready
+// to use.
+type Stats struct {
+	mu     sync.Mutex
+	counts map[string]*statsCount
+}
+
+type statsCount struct {
+	hits, total int
+}
+
+// Record counts the result of every node of t, as returned by
+// [EvalExpressionTrace], that evaluation reached without failing.
+func (s *Stats) Record(t *Trace) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts == nil {
+		s.counts = map[string]*statsCount{}
+	}
+
+	var record func(t *Trace)
+	record = func(t *Trace) {
+		if t == nil || t.Skipped {
+			return
+		}
+
+		// A failed node may still have operands that evaluated.
+		if t.Err == nil {
+			c, ok := s.counts[t.Text]
+			if !ok {
+				c = &statsCount{}
+				s.counts[t.Text] = c
+			}
+			c.total++
+			if t.Result {
+				c.hits++
+			}
+		}
+
+		for _, child := range t.Children {
+			record(child)
+		}
+	}
+	record(t)
+}
+
+// Selectivity returns the estimated probability that the node of canonical
+// text is true, and whether it was recorded at all. The estimate is smoothed
+// toward one half, as by Laplace's rule of succession, so a node seen a few
+// times is neither certainly true nor certainly false.
+func (s *Stats) Selectivity(text string) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counts[text]
+	if !ok {
+		return 0, false
+	}
+
+	return float64(c.hits+1) / float64(c.total+2), true
+}
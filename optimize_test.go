@@ -0,0 +1,135 @@
+package boolexpr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimize(t *testing.T) {
+	tcs := []struct {
+		input    string
+		costs    Costs
+		expected string
+	}{
+		{`a = 1 and b = 1`, Costs{}, `a = 1 and b = 1`},
+		{`remote = 1 and flag`, Costs{Symbols: map[string]float64{"remote": 100}}, `flag and remote = 1`},
+		{`remote = 1 or flag`, Costs{Symbols: map[string]float64{"remote": 100}}, `flag or remote = 1`},
+		{`name match "^a" and x = 1`, Costs{Operators: map[string]float64{"match": 50}}, `x = 1 and name match "^a"`},
+		{`x = 1 and name match "^a"`, Costs{Operators: map[string]float64{"=": 50}}, `name match "^a" and x = 1`},
+		{`a exists and b = 1`, Costs{Operators: map[string]float64{"exists": 0.5}}, `a exists and b = 1`},
+		{`b = 1 and a exists`, Costs{Operators: map[string]float64{"exists": 0.5}}, `a exists and b = 1`},
+		{`(a = 1 or b = 1) and c = 1`, Costs{}, `c = 1 and (a = 1 or b = 1)`},
+		{`(a = 1 or b = 1) and c = 1`, Costs{Symbols: map[string]float64{"c": 10}}, `(a = 1 or b = 1) and c = 1`},
+		{`a = 1 and b = 1 or c = 1`, Costs{}, `c = 1 or a = 1 and b = 1`},
+		{`x = 1 or y = 1 and (s = 1 or remote = 1)`, Costs{Symbols: map[string]float64{"remote": 10, "s": 5}}, `x = 1 or y = 1 and (s = 1 or remote = 1)`},
+		{`a = 1 and (remote = 1 or b = 1)`, Costs{Symbols: map[string]float64{"remote": 10}}, `a = 1 and (b = 1 or remote = 1)`},
+		{`not remote = 1 and a = 1`, Costs{Symbols: map[string]float64{"remote": 10}}, `a = 1 and not remote = 1`},
+		{`lower(remote) = "a" and a = 1`, Costs{Symbols: map[string]float64{"remote": 10}}, `a = 1 and lower(remote) = "a"`},
+		{`remote + 1 > a and a = 1`, Costs{Symbols: map[string]float64{"remote": 10}}, `a = 1 and remote + 1 > a`},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+
+			before := exp.String()
+			assert.Equal(t, tc.expected, Optimize(exp, tc.costs).String())
+			assert.Equal(t, before, exp.String(), "e is left as is")
+		})
+	}
+
+	t.Run("zero value", func(t *testing.T) {
+		assert.Equal(t, Expression{}, Optimize(Expression{}, Costs{}))
+	})
+}
+
+func TestOptimizeResults(t *testing.T) {
+	// The costs reverse the order of the operands, as far as they go.
+	costs := Costs{Symbols: map[string]float64{}}
+	for i, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u", "v", "w", "x", "y", "z"} {
+		costs.Symbols[name] = float64(26 - i)
+	}
+
+	for _, tc := range evalTests {
+		exp, err := Parse(tc.input)
+		require.NoError(t, err)
+
+		res, err := EvalExpression(Optimize(exp, costs), tc.symbols)
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, res, tc.input)
+	}
+
+	syms := SymbolsMap{"x": 1, "n": nil, "s": "abc", "b": true, "tags": []string{"a"}, "obj": map[string]any{"a": 1}}
+	for _, tc := range nullTests {
+		exp, err := Parse(tc.input, WithMissingSymbols(MissingThreeValued))
+		require.NoError(t, err)
+
+		res, err := EvalExpression(Optimize(exp, costs), syms)
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected[2], res, tc.input)
+	}
+}
+
+func TestOptimizeStats(t *testing.T) {
+	exp, err := Parse(`a = 1 and b = 1`)
+	require.NoError(t, err)
+
+	var stats Stats
+	_, ok := stats.Selectivity("b = 1")
+	assert.False(t, ok)
+
+	// b is rarely 1, so b = 1 decides the "and" most often.
+	for i := range 20 {
+		_, trace, err := EvalExpressionTrace(exp, SymbolsMap{"a": 1, "b": i % 10})
+		require.NoError(t, err)
+		stats.Record(trace)
+	}
+
+	p, ok := stats.Selectivity("a = 1")
+	assert.True(t, ok)
+	assert.InDelta(t, 21.0/22, p, 1e-9)
+
+	p, ok = stats.Selectivity("b = 1")
+	assert.True(t, ok)
+	assert.InDelta(t, 3.0/22, p, 1e-9)
+
+	assert.Equal(t, `a = 1 and b = 1`, Optimize(exp, Costs{}).String())
+	assert.Equal(t, `b = 1 and a = 1`, Optimize(exp, Costs{Stats: &stats}).String())
+
+	// The same observations order "or" the other way.
+	exp, err = Parse(`b = 1 or a = 1`)
+	require.NoError(t, err)
+	assert.Equal(t, `a = 1 or b = 1`, Optimize(exp, Costs{Stats: &stats}).String())
+
+	// Costs still weigh in.
+	exp, err = Parse(`a = 1 and b = 1`)
+	require.NoError(t, err)
+	assert.Equal(t, `a = 1 and b = 1`, Optimize(exp, Costs{Stats: &stats, Symbols: map[string]float64{"b": 100}}).String())
+
+	t.Run("not", func(t *testing.T) {
+		exp, err := Parse(`c = 1 and not a = 1`)
+		require.NoError(t, err)
+		assert.Equal(t, `not a = 1 and c = 1`, Optimize(exp, Costs{Stats: &stats}).String())
+	})
+
+	t.Run("failed traces", func(t *testing.T) {
+		var stats Stats
+		exp, err := Parse(`a = 1 and b > 1`)
+		require.NoError(t, err)
+
+		_, trace, err := EvalExpressionTrace(exp, SymbolsMap{"a": 1, "b": "x"})
+		require.Error(t, err)
+		stats.Record(trace)
+
+		_, ok := stats.Selectivity("a = 1 and b > 1")
+		assert.False(t, ok)
+		_, ok = stats.Selectivity("b > 1")
+		assert.False(t, ok)
+		p, ok := stats.Selectivity("a = 1")
+		assert.True(t, ok)
+		assert.InDelta(t, 2.0/3, p, 1e-9)
+	})
+}
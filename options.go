@@ -0,0 +1,142 @@
+package boolexpr
+
+import (
+	"context"
+	"time"
+)
+
+// Option configures [Parse], and evaluation by [Eval] and [EvalExpression].
+type Option func(*options)
+
+type options struct {
+	funcs *Functions
+	ops   *Operators
+	clock func() time.Time
+	// missing is 0 when no [MissingSymbols] is given.
+	missing MissingSymbols
+	// ctx is the context of an evaluation by [EvalExpressionContext] or
+	// [Program.EvalContext], and nil otherwise.
+	ctx context.Context
+	// prefetch and prefetchLimit are given by [WithPrefetch].
+	prefetch      Prefetch
+	prefetchLimit int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// The clock is read by now, which is bound like any function.
+	if o.clock != nil {
+		o.funcs = o.funcs.with(nowFunction(o.clock))
+	}
+
+	return o
+}
+
+// WithFunctions makes the functions registered in fns callable by an
+// expression, besides the built-in ones. Given to [Parse], calls are resolved
+// to them and their arguments checked against their signatures. Given to
+// [EvalExpression], they replace the functions of the same name the
+// expression was parsed with, for that evaluation alone: a function can so be
+// bound to the request being evaluated. When given more than once, the last
+// one is used.
+func WithFunctions(fns *Functions) Option {
+	return func(o *options) { o.funcs = fns }
+}
+
+// WithOperators makes the operators registered in ops usable by an
+// expression, besides the built-in ones. Given to [Parse], comparisons by them
+// are resolved to them; given to [EvalExpression], they replace the operators
+// of the same name the expression was parsed with, for that evaluation alone.
+// When given more than once, the last one is used.
+func WithOperators(ops *Operators) Option {
+	return func(o *options) { o.ops = ops }
+}
+
+// WithClock makes now() read the current time from clock rather than from
+// [time.Now], such as a fixed time in tests. Given to [Parse], it applies to
+// every evaluation of the expression, compiled ones included; given to
+// [EvalExpression], to that evaluation alone.
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) { o.clock = clock }
+}
+
+// WithMissingSymbols chooses how evaluation treats a missing symbol; see
+// [MissingSymbols]. Given to [Parse], it applies to every evaluation of the
+// expression, compiled and traced ones included; given to [EvalExpression],
+// to that evaluation alone.
+func WithMissingSymbols(m MissingSymbols) Option {
+	return func(o *options) { o.missing = m }
+}
+
+// optionSymbols carries the options of an evaluation along with its symbols,
+// down to the nodes that use them.
+type optionSymbols struct {
+	Symbols
+	opts *options
+}
+
+// Get looks key up under the context of the evaluation, if it has one.
+func (s optionSymbols) Get(key string) (any, error) {
+	if s.opts.ctx == nil {
+		return s.Symbols.Get(key)
+	}
+
+	return getContext(s.opts.ctx, s.Symbols, key)
+}
+
+// getContext looks key up in syms under ctx, with GetContext when syms is a
+// [ContextSymbols] and Get otherwise.
+func getContext(ctx context.Context, syms Symbols, key string) (any, error) {
+	if cs, ok := syms.(ContextSymbols); ok {
+		return cs.GetContext(ctx, key)
+	}
+
+	return syms.Get(key)
+}
+
+// getManyContext looks names up in syms under ctx, with GetManyContext when
+// syms is a [BatchContextSymbols] and GetMany otherwise.
+func getManyContext(ctx context.Context, syms BatchSymbols, names []string) (map[string]any, error) {
+	if bs, ok := syms.(BatchContextSymbols); ok {
+		return bs.GetManyContext(ctx, names)
+	}
+
+	return syms.GetMany(names)
+}
+
+// withContext returns syms, carrying the options of an evaluation or none,
+// carrying ctx as well.
+func withContext(ctx context.Context, syms Symbols) Symbols {
+	var o options
+	if s, ok := syms.(optionSymbols); ok {
+		o, syms = *s.opts, s.Symbols
+	}
+	o.ctx = ctx
+
+	return optionSymbols{Symbols: syms, opts: &o}
+}
+
+// evalContext returns the context of the evaluation syms is given to, or
+// [context.Background] when it has none.
+func evalContext(syms Symbols) context.Context {
+	if o := evalOptions(syms); o != nil && o.ctx != nil {
+		return o.ctx
+	}
+
+	return context.Background()
+}
+
+// contextErr returns the error of the context of the evaluation syms is given
+// to once it is done, and nil otherwise. It is checked between the operands
+// of "and" and "or".
+func contextErr(syms Symbols) error {
+	if o := evalOptions(syms); o != nil && o.ctx != nil {
+		return o.ctx.Err()
+	}
+
+	return nil
+}
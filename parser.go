@@ -1,30 +1,904 @@
 package boolexpr
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/emad-elsaid/boolexpr/internal"
 )
 
 // Parse compiles the expression string s into an [Expression] tree that can be
 // evaluated repeatedly with [EvalExpression]. A non-nil error is returned if s
-// is not a syntactically valid expression.
-func Parse(s string) (Expression, error) {
-	e, error := parser.ParseString("", s)
-	return Expression{e}, error
+// is not a syntactically valid expression; it is always a [*ParseError]
+// locating the problem in s. Calls are resolved to the functions of
+// [WithFunctions], then to the built-in ones, and operators that are not built
+// in to those of [WithOperators].
+func Parse(s string, opts ...Option) (Expression, error) {
+	e, err := parse(s)
+	if err != nil {
+		return Expression{e: e}, newParseError(s, err)
+	}
+
+	o := newOptions(opts)
+	p := preparer{s: s, funcs: o.funcs, ops: o.ops}
+	if err := p.boolExpr(e); err != nil {
+		return Expression{}, err
+	}
+
+	return Expression{e: e, missing: o.missing}, nil
 }
 
 // parser is built once at package initialization. The grammar is static, so a
 // build failure is a programming error; MustBuild panics immediately with a
 // clear message rather than leaving a nil parser to nil-deref on first Parse.
+//
+// The grammar needs a single token of lookahead: the parser never backs out
+// of a node more than one token into it, so a parse, failed or not, takes
+// time linear in the length of its input.
 var parser = participle.MustBuild[internal.BoolExpr](
+	participle.Lexer(literalLexer{}),
 	participle.Unquote("String"),
-	participle.Union[internal.Expr](internal.Compare{}, internal.SubExpr{}, internal.BoolValue{}),
+	participle.Union[internal.Expr](&internal.NotExpr{}, &internal.Compare{}),
 )
 
+// parse parses s into the tree evaluation uses. The grammar reads every
+// parenthesized node as an [internal.Paren], and a condition as a comparison
+// whose operator may be missing; those are resolved once the whole tree is
+// parsed, and a tree they leave invalid fails as a syntax error would.
+func parse(s string) (*internal.BoolExpr, error) {
+	e, err := parser.ParseString("", s)
+	if err != nil {
+		return e, err
+	}
+
+	return e, resolver{}.boolExpr(e)
+}
+
+func init() {
+	internal.Tree = func(exp any) *internal.BoolExpr { return exp.(Expression).e }
+}
+
 // Expression is a parsed boolean expression tree produced by [Parse]. It holds
 // no symbol values and can be evaluated repeatedly, and concurrently, against
 // different [Symbols] using [EvalExpression]. The zero value is not usable;
 // always obtain an Expression from [Parse].
 type Expression struct {
 	e *internal.BoolExpr
+	// missing is the [MissingSymbols] given to Parse, if any.
+	missing MissingSymbols
+}
+
+// Position is a location in the source text of an expression.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in characters, starting at 1
+}
+
+func newPosition(p lexer.Position) Position {
+	return Position{Offset: p.Offset, Line: p.Line, Column: p.Column}
+}
+
+// ParseError is returned by [Parse] when the expression cannot be parsed. It
+// locates the offending token so that callers can point at it, and lists the
+// tokens the grammar would have accepted there instead. Use errors.As to
+// retrieve it; errors.Is still matches the wrapped cause, such as
+// [ErrorWrongDataType] for a list literal mixing kinds of values.
+type ParseError struct {
+	Position
+	// Got is the source text of the offending token, or "<EOF>" when the
+	// expression ended too early.
+	Got string
+	// Expected lists the tokens that would have been accepted at Position.
+	// Literal classes are written as <symbol>, <int>, <float>, <string>,
+	// <time> and <duration>.
+	// It is empty when the token itself is valid but not allowed there, or
+	// when the expression is too long or too deeply nested to list them in
+	// reasonable time; Position is then where participle failed.
+	Expected []string
+
+	msg string
+	err error
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.msg)
+	if len(e.Expected) > 0 {
+		msg += fmt.Sprintf(" (expected %s)", strings.Join(e.Expected, ", "))
+	}
+
+	return msg
+}
+
+func (e *ParseError) Unwrap() error { return e.err }
+
+// newParseError converts an error from the participle parser or lexer into a
+// [*ParseError] for the source s.
+//
+// participle does not always blame the right token: a failed optional part,
+// such as a dangling "and" inside a group, is backtracked over silently and
+// the error lands on the token before it. So the offending token is located
+// independently, as the first token after which s can no longer be completed
+// into a valid expression; Got and Expected are derived from that same point.
+// Locating it re-parses prefixes of s within a [locateBudget]: past it, the
+// error is participle's own, and Expected is left empty.
+func newParseError(s string, err error) *ParseError {
+	perr := &ParseError{msg: err.Error(), err: err}
+
+	tokens, lexErr := parser.Lex("", strings.NewReader(s))
+	if lexErr != nil {
+		var located participle.Error
+		if errors.As(lexErr, &located) {
+			perr.Position = newPosition(located.Position())
+			perr.msg = located.Message()
+		}
+		perr.Got = tokenAt(s, perr.Offset)
+
+		var lit *literalError
+		if errors.As(lexErr, &lit) {
+			perr.Got = lit.text
+		}
+	} else {
+		l := newLocator()
+
+		// Prefixes that end before a token in tokens[:bad] can be completed;
+		// the one ending after tokens[bad] cannot. Completability is monotonic
+		// in the prefix length, so bad is found by binary search. The last
+		// token is EOF, which is where an incomplete expression fails.
+		bad := sort.Search(len(tokens)-1, func(i int) bool {
+			return !l.completable(s[:tokens[i+1].Pos.Offset], parenDepth(tokens[:i+1]), partialCompletions)
+		})
+
+		if l.exhausted {
+			var located participle.Error
+			if errors.As(err, &located) {
+				perr.Position = newPosition(located.Position())
+				perr.msg = located.Message()
+			}
+			bad = sort.Search(len(tokens)-1, func(i int) bool { return tokens[i].Pos.Offset >= perr.Offset })
+		}
+
+		tok := tokens[bad]
+		perr.Got = "<EOF>"
+		if !tok.EOF() {
+			perr.Got = strings.TrimRight(s[tok.Pos.Offset:tokens[bad+1].Pos.Offset], " \t\r\n")
+		}
+
+		if !l.exhausted {
+			perr.Position = newPosition(tok.Pos)
+			perr.msg = fmt.Sprintf("unexpected token %q", perr.Got)
+			perr.Expected = l.expectedAt(s[:tok.Pos.Offset], parenDepth(tokens[:bad]))
+			if l.exhausted {
+				perr.Expected = nil
+			}
+		}
+	}
+
+	// participle leaves the position of an empty input unset.
+	if perr.Line == 0 {
+		perr.Line, perr.Column = 1, perr.Offset+1
+	}
+
+	return perr
+}
+
+// newNodeError reports a problem with a node that parsed correctly but is not
+// valid, such as a list literal outside of "in". Got is the node's source text.
+func newNodeError(s string, start, end lexer.Position, err error) *ParseError {
+	return &ParseError{
+		Position: newPosition(start),
+		Got:      s[start.Offset:end.Offset],
+		msg:      err.Error(),
+		err:      err,
+	}
+}
+
+func tokenAt(s string, offset int) string {
+	if offset >= len(s) {
+		return "<EOF>"
+	}
+
+	r, _ := utf8.DecodeRuneInString(s[offset:])
+	return string(r)
+}
+
+// completions are appended to a prefix to check whether it can be completed
+// into a valid expression, before closing its open parentheses. An operand
+// completes most prefixes, a field name one ending in ".", "null" one ending
+// in "is not", and "]" or an index with "]" one inside the brackets of a
+// symbol path; a prefix that ends in a token that is only ever
+// the start of a longer operator ("!", "&", "|", "not") is completed by one of
+// partialCompletions, which are used when locating the offending token but not
+// when listing expected tokens, so "!" is not offered where only "!=" fits.
+var (
+	completions        = []string{"", " 1", " x", " null", "]", " 1]"}
+	partialCompletions = append([]string{" = 1", " & 1", " | 1", " in 1"}, completions...)
+)
+
+// locateBudget bounds the work of locating a parse error. A parse costs the
+// length of its input, plus 3 for each parenthesis, comma and minus sign, as
+// the parser takes longer over those, each unit taking up to 10µs: locating
+// an error takes a sixth of a second at most.
+const locateBudget = 1 << 14
+
+// locator re-parses the prefixes of a source, each parse spending its cost
+// from budget. Once a parse would exceed it, exhausted is set, and this and
+// all further parses fail.
+type locator struct {
+	budget    int
+	exhausted bool
+}
+
+func newLocator() *locator {
+	return &locator{budget: locateBudget}
+}
+
+// parses reports whether s is a valid expression.
+func (l *locator) parses(s string) bool {
+	cost := len(s)
+	for _, c := range s {
+		if strings.ContainsRune("(),-", c) {
+			cost += 3
+		}
+	}
+
+	if l.exhausted || cost > l.budget {
+		l.exhausted = true
+		return false
+	}
+	l.budget -= cost
+
+	_, err := parse(s)
+	return err == nil
+}
+
+// completable reports whether the prefix can be completed into a valid
+// expression, depth being the number of parentheses it leaves open.
+func (l *locator) completable(prefix string, depth int, completions []string) bool {
+	if depth < 0 {
+		return false
+	}
+
+	closers := strings.Repeat(")", depth)
+	for _, c := range completions {
+		if l.parses(prefix + c + closers) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parenDepth(tokens []lexer.Token) int {
+	depth := 0
+	for _, t := range tokens {
+		switch t.Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+	}
+
+	return depth
+}
+
+// expectedTokens are the candidates tried by expectedAt, grouped as literal
+// classes followed by punctuation and keywords.
+//
+// Operator words that are not reserved are marked as such: they are also
+// valid symbol names, so they are only reported where a symbol is not. The
+// "." and "[" that may follow any symbol to start a path, and the arithmetic
+// operators that may follow any operand, are left out, as they would be
+// listed after every one; only the closing "]" is tried. Likewise "(" is only
+// listed where it opens a group or a list, that is where a symbol may start,
+// and not after a symbol, where it would open the arguments of a call. An
+// identifier where an operator fits is listed as <operator>, the name of a
+// registered one, rather than as a symbol.
+var expectedTokens = []struct {
+	token, probe string
+	word         bool
+}{
+	{"<symbol>", "x", false},
+	{"<int>", "1", false},
+	{"<float>", "1.5", false},
+	{"<string>", `"s"`, false},
+	{"<time>", "2024-01-01", false},
+	{"<duration>", "1h", false},
+	{"true", "true", false},
+	{"false", "false", false},
+	{"null", "null", false},
+	{"not", "not", false},
+	{"!", "!", false},
+	{"(", "(", false},
+	{")", ")", false},
+	{",", ",", false},
+	{"]", "]", false},
+	{"and", "and", false},
+	{"&&", "&&", false},
+	{"or", "or", false},
+	{"||", "||", false},
+	{"=", "=", false},
+	{"==", "==", false},
+	{"!=", "!=", false},
+	{">", ">", false},
+	{">=", ">=", false},
+	{"<", "<", false},
+	{"<=", "<=", false},
+	{"contains", "contains", true},
+	{"excludes", "excludes", true},
+	{"starts_with", "starts_with", true},
+	{"ends_with", "ends_with", true},
+	{"match", "match", true},
+	{"icontains", "icontains", true},
+	{"istarts_with", "istarts_with", true},
+	{"iends_with", "iends_with", true},
+	{"imatch", "imatch", true},
+	{"equals_fold", "equals_fold", true},
+	{"like", "like", true},
+	{"glob", "glob", true},
+	{"in", "in", false},
+	{"not in", "not in", false},
+	{"exists", "exists", true},
+	{"is", "is null", true},
+	{"<operator>", "x", false},
+}
+
+// expectedAt returns the tokens the grammar accepts after prefix, which leaves
+// depth parentheses open. participle only names the grammar node it was in, so
+// each candidate is tried in turn and is expected when the prefix followed by
+// it can still be completed.
+func (l *locator) expectedAt(prefix string, depth int) []string {
+	var expected []string
+
+	if l.parses(prefix) {
+		expected = append(expected, "<EOF>")
+	}
+
+	operator := l.completable(prefix+" in", depth, completions) && l.completable(prefix+" =", depth, completions)
+	symbol := false
+	for _, c := range expectedTokens {
+		if c.word && symbol || c.token == "<symbol>" && operator || c.token == "<operator>" && !operator {
+			continue
+		}
+
+		d := depth
+		switch c.probe {
+		case "(":
+			d++
+		case ")":
+			d--
+		}
+
+		if c.probe == "(" && !symbol {
+			continue
+		}
+
+		if l.completable(prefix+" "+c.probe, d, completions) {
+			expected = append(expected, c.token)
+			symbol = symbol || c.token == "<symbol>"
+		}
+	}
+
+	return expected
+}
+
+// resolver replaces the nodes the grammar reads alike by the ones they stand
+// for. A [internal.Paren] is a list where the right operand of "in" may be one
+// and its elements are values or lists, a group in any other operand, and a
+// sub-expression where a whole condition is. A comparison without an operator
+// is a condition of a single value, or a sub-expression, and one with a null
+// test is the test.
+type resolver struct{}
+
+func (r resolver) boolExpr(b *internal.BoolExpr) error {
+	if err := r.andExpr(&b.And); err != nil {
+		return err
+	}
+
+	for i := range b.OrOps {
+		if err := r.andExpr(&b.OrOps[i].And); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r resolver) andExpr(a *internal.AndExpr) error {
+	if err := r.expr(&a.Expr); err != nil {
+		return err
+	}
+
+	for i := range a.AndOps {
+		if err := r.expr(&a.AndOps[i].Expr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expr resolves the expression x points to, replacing it when it is a
+// comparison standing for another node.
+func (r resolver) expr(x *internal.Expr) error {
+	switch e := (*x).(type) {
+	case *internal.NotExpr:
+		return r.expr(&e.Expr)
+	case *internal.Compare:
+		switch {
+		case e.Null != nil:
+			e.Null.Operand, e.Null.Pos, e.Null.EndPos = e.Left, e.Pos, e.EndPos
+			*x = e.Null
+			return r.operand(&e.Null.Operand, false)
+		case e.Right.Term.Factor != internal.Factor{}:
+			if err := r.operand(&e.Left, false); err != nil {
+				return err
+			}
+
+			return r.operand(&e.Right, e.Op.In || e.Op.NotIn)
+		}
+
+		f := single(&e.Left)
+		switch {
+		case f == nil || f.Neg != nil:
+			return participle.Errorf(e.Left.Pos, "expected a condition, got an arithmetic expression")
+		case f.Value != nil:
+			*x = &internal.BoolValue{Value: *f.Value}
+			return r.value(f.Value)
+		case len(f.Paren.Elems) == 1:
+			sub := &internal.SubExpr{BoolExpr: f.Paren.Elems[0]}
+			*x = sub
+			return r.boolExpr(&sub.BoolExpr)
+		}
+
+		v := list(f.Paren)
+		if v == nil {
+			return participle.Errorf(f.Paren.Pos, "expected a list of values")
+		}
+		*x = &internal.BoolValue{Value: *v}
+		return r.value(v)
+	default:
+		return nil
+	}
+}
+
+// operand resolves the parentheses of o, in telling whether o is the right
+// operand of "in" or "not in".
+func (r resolver) operand(o *internal.Operand, in bool) error {
+	if f := single(o); in && f != nil && f.Paren != nil {
+		if v := list(f.Paren); v != nil {
+			f.Paren, f.Value = nil, v
+			return r.value(v)
+		}
+	}
+
+	if err := r.factor(&o.Term.Factor); err != nil {
+		return err
+	}
+
+	for i := range o.Term.Ops {
+		if err := r.factor(&o.Term.Ops[i].Factor); err != nil {
+			return err
+		}
+	}
+
+	for i := range o.Ops {
+		t := &o.Ops[i].Term
+		if err := r.factor(&t.Factor); err != nil {
+			return err
+		}
+
+		for j := range t.Ops {
+			if err := r.factor(&t.Ops[j].Factor); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r resolver) factor(f *internal.Factor) error {
+	switch {
+	case f.Value != nil:
+		return r.value(f.Value)
+	case f.Neg != nil:
+		return r.factor(f.Neg)
+	case f.Paren == nil:
+		return nil
+	}
+
+	p := f.Paren
+	if len(p.Elems) > 1 {
+		v := list(p)
+		if v == nil {
+			return participle.Errorf(p.Pos, "expected a list of values")
+		}
+
+		f.Paren, f.Value = nil, v
+		return r.value(v)
+	}
+
+	o := bareOperand(&p.Elems[0])
+	if o == nil {
+		return participle.Errorf(p.Pos, "expected an operand, got a condition")
+	}
+
+	f.Paren, f.Group = nil, o
+	return r.operand(o, false)
+}
+
+// value resolves the arguments of a call, and the elements of a list.
+func (r resolver) value(v *internal.Value) error {
+	if v.List != nil {
+		for i := range v.List.Values {
+			if err := r.value(&v.List.Values[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if v.Call == nil {
+		return nil
+	}
+
+	for i := range v.Call.Args {
+		if err := r.operand(&v.Call.Args[i], false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// list returns the list literal p stands for, or nil when an element of p
+// is not a value or a list itself.
+func list(p *internal.Paren) *internal.Value {
+	l := &internal.List{Values: make([]internal.Value, 0, len(p.Elems))}
+	for i := range p.Elems {
+		var f *internal.Factor
+		if o := bareOperand(&p.Elems[i]); o != nil {
+			f = single(o)
+		}
+
+		switch {
+		case f == nil || f.Neg != nil:
+			return nil
+		case f.Value != nil:
+			l.Values = append(l.Values, *f.Value)
+		default:
+			v := list(f.Paren)
+			if v == nil {
+				return nil
+			}
+			l.Values = append(l.Values, *v)
+		}
+	}
+
+	return &internal.Value{List: l, Pos: p.Pos, EndPos: p.EndPos}
+}
+
+// bareOperand returns the operand b consists of, or nil when b is a
+// condition.
+func bareOperand(b *internal.BoolExpr) *internal.Operand {
+	c, ok := b.And.Expr.(*internal.Compare)
+	if !ok || len(b.OrOps) > 0 || len(b.And.AndOps) > 0 || c.Null != nil || c.Right.Term.Factor != (internal.Factor{}) {
+		return nil
+	}
+
+	return &c.Left
+}
+
+// single returns the factor o consists of, or nil when o is an arithmetic
+// expression.
+func single(o *internal.Operand) *internal.Factor {
+	if len(o.Ops) > 0 || len(o.Term.Ops) > 0 {
+		return nil
+	}
+
+	return &o.Term.Factor
+}
+
+// preparer runs once after parsing the source s. It rejects trees the grammar
+// accepts but evaluation cannot, resolves the functions they call, and
+// precomputes per-node data such as the hash sets of literal lists, so that
+// work is not repeated on every evaluation.
+type preparer struct {
+	s     string
+	funcs *Functions
+	ops   *Operators
+}
+
+func (p *preparer) boolExpr(b *internal.BoolExpr) error {
+	if err := p.andExpr(&b.And); err != nil {
+		return err
+	}
+
+	for i := range b.OrOps {
+		if err := p.andExpr(&b.OrOps[i].And); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *preparer) andExpr(a *internal.AndExpr) error {
+	if err := p.expr(a.Expr); err != nil {
+		return err
+	}
+
+	for _, op := range a.AndOps {
+		if err := p.expr(op.Expr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *preparer) expr(x internal.Expr) error {
+	switch e := x.(type) {
+	case *internal.Compare:
+		e.EndPos = trimEnd(p.s, e.Pos, e.EndPos)
+		if err := p.operand(&e.Left); err != nil {
+			return err
+		}
+
+		if err := p.op(&e.Op); err != nil {
+			return err
+		}
+
+		if err := p.right(&e.Right, e.Op); err != nil {
+			return err
+		}
+
+		return p.pattern(e)
+	case *internal.NullTest:
+		e.EndPos = trimEnd(p.s, e.Pos, e.EndPos)
+		if err := p.operand(&e.Operand); err != nil {
+			return err
+		}
+
+		if v := e.Operand.Value(); e.Exists && (v == nil || v.Symbol == nil) {
+			return newNodeError(p.s, e.Operand.Pos, e.Operand.EndPos,
+				fmt.Errorf("%w, exists can only test a symbol", ErrorWrongDataType))
+		}
+
+		return nil
+	case *internal.BoolValue:
+		return p.value(&e.Value)
+	case *internal.SubExpr:
+		return p.boolExpr(&e.BoolExpr)
+	case *internal.NotExpr:
+		return p.expr(e.Expr)
+	default:
+		return nil
+	}
+}
+
+// op resolves a custom operator to the one registered under its name.
+func (p *preparer) op(o *internal.ComparisonOp) error {
+	if o.Custom == "" {
+		return nil
+	}
+
+	fn := p.ops.lookup(o.Custom)
+	if fn == nil {
+		return newNodeError(p.s, o.Pos, trimEnd(p.s, o.Pos, o.EndPos), fmt.Errorf("%w, %s", ErrUnknownOperator, o.Custom))
+	}
+	o.Func = fn
+
+	return nil
+}
+
+// right prepares the right operand of a comparison, the one place
+// where a list literal is allowed.
+func (p *preparer) right(o *internal.Operand, op internal.ComparisonOp) error {
+	v := o.Value()
+	if v == nil || v.List == nil || !(op.In || op.NotIn) {
+		return p.operand(o)
+	}
+
+	o.EndPos = trimEnd(p.s, o.Pos, o.EndPos)
+	v.EndPos = trimEnd(p.s, v.Pos, v.EndPos)
+	return p.list(v.List)
+}
+
+// pattern compiles the literal pattern of a match, imatch, like or glob, so
+// that an invalid one fails to parse, and evaluation doesn't look it up.
+func (p *preparer) pattern(e *internal.Compare) error {
+	o, v := e.Op, e.Right.Value()
+	if !(o.Match || o.IMatch || o.Like || o.Glob) || v == nil || v.String == nil {
+		return nil
+	}
+
+	re, err := compileRegexp(o, *v.String)
+	if err != nil {
+		return newNodeError(p.s, e.Right.Pos, e.Right.EndPos, err)
+	}
+	e.Pattern = re
+
+	return nil
+}
+
+func (p *preparer) operand(o *internal.Operand) error {
+	o.EndPos = trimEnd(p.s, o.Pos, o.EndPos)
+	if err := p.term(&o.Term); err != nil {
+		return err
+	}
+
+	for i := range o.Ops {
+		if err := p.term(&o.Ops[i].Term); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *preparer) term(t *internal.Term) error {
+	if err := p.factor(&t.Factor); err != nil {
+		return err
+	}
+
+	for i := range t.Ops {
+		if err := p.factor(&t.Ops[i].Factor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *preparer) factor(f *internal.Factor) error {
+	switch {
+	case f.Value != nil:
+		return p.value(f.Value)
+	case f.Group != nil:
+		return p.operand(f.Group)
+	case f.Neg != nil:
+		return p.factor(f.Neg)
+	default:
+		return nil
+	}
+}
+
+func (p *preparer) value(v *internal.Value) error {
+	v.EndPos = trimEnd(p.s, v.Pos, v.EndPos)
+	if v.List != nil {
+		return newNodeError(p.s, v.Pos, v.EndPos,
+			fmt.Errorf("%w, a list can only be the right operand of in or not in", ErrorWrongDataType))
+	}
+
+	if v.Call != nil {
+		return p.call(v)
+	}
+
+	return nil
+}
+
+// call resolves the function called by v, registered or built in, and checks the number of its
+// arguments and the kinds of those known before evaluation, such as literals.
+func (p *preparer) call(v *internal.Value) error {
+	c := v.Call
+	for i := range c.Args {
+		if err := p.operand(&c.Args[i]); err != nil {
+			return err
+		}
+	}
+
+	f := p.funcs.lookup(c.Name)
+	if f == nil {
+		end := v.Pos
+		end.Offset += len(c.Name)
+		end.Column += utf8.RuneCountInString(c.Name)
+		return newNodeError(p.s, v.Pos, end, fmt.Errorf("%w, %s", ErrUnknownFunction, c.Name))
+	}
+	c.Func = f
+
+	if err := f.checkArity(len(c.Args)); err != nil {
+		return newNodeError(p.s, v.Pos, v.EndPos, err)
+	}
+
+	chk := checker{static: true}
+	chk.value(v)
+	if len(chk.errs) > 0 {
+		err := chk.errs[0]
+		return newNodeError(p.s, v.Pos, v.EndPos, err.Err)
+	}
+
+	return nil
+}
+
+// list validates the elements of a list literal and, when every element
+// is a literal, builds its [internal.LiteralSet]. A literal-only list must hold
+// a single kind of value (ints and floats count as one numeric kind) so that a
+// membership test has the same type rules as "=".
+func (p *preparer) list(l *internal.List) error {
+	var first *internal.Value
+
+	for i := range l.Values {
+		v := &l.Values[i]
+		if err := p.value(v); err != nil {
+			return err
+		}
+
+		if v.Symbol != nil || v.Call != nil || v.Null {
+			continue
+		}
+
+		if first == nil {
+			first = v
+		} else if literalKind(*first) != literalKind(*v) {
+			return newNodeError(p.s, v.Pos, v.EndPos,
+				fmt.Errorf("%w, list mixes %s and %s literals", ErrorWrongDataType, literalKind(*first), literalKind(*v)))
+		}
+	}
+
+	l.Set = literalSet(l.Values)
+	return nil
+}
+
+// literalSet returns the hash set of values when they are all literals of
+// one kind, or nil. Times are equal as instants, whatever their location,
+// and are compared one by one instead, as are durations.
+func literalSet(values []internal.Value) *internal.LiteralSet {
+	set := &internal.LiteralSet{}
+	for _, v := range values {
+		switch {
+		case v.Symbol != nil, v.Call != nil, v.Null, v.Time != nil, v.Duration != nil:
+			return nil
+		case literalKind(v) != literalKind(values[0]):
+			return nil
+		}
+
+		set.Add(v)
+	}
+
+	return set
+}
+
+// literalKind names the kind of a literal value for list type checks; ints and
+// floats share the "number" kind because they compare with each other.
+func literalKind(v internal.Value) string {
+	switch {
+	case v.Int != nil, v.Float != nil:
+		return "number"
+	case v.String != nil:
+		return "string"
+	case v.Bool != nil:
+		return "bool"
+	case v.Time != nil:
+		return "time"
+	case v.Duration != nil:
+		return "duration"
+	default:
+		return "symbol"
+	}
+}
+
+// trimEnd moves a node's end position back over the whitespace participle
+// includes before the next token, so the node spans exactly its own text.
+func trimEnd(s string, start, end lexer.Position) lexer.Position {
+	text := strings.TrimRight(s[start.Offset:end.Offset], " \t\r\n")
+
+	pos := start
+	for _, r := range text {
+		pos.Offset += utf8.RuneLen(r)
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+
+	return pos
 }
@@ -1,17 +1,63 @@
 package boolexpr
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alecthomas/participle/v2/lexer"
 	. "github.com/emad-elsaid/boolexpr/internal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// clearPositions zeroes every source position in a parsed tree, so tests can
+// compare tree shapes without spelling out where each node starts and ends.
+func clearPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			clearPositions(v.Elem())
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		// Values held in an interface are not addressable; edit a copy.
+		c := reflect.New(v.Elem().Type()).Elem()
+		c.Set(v.Elem())
+		clearPositions(c)
+		v.Set(c)
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(lexer.Position{}) {
+			v.SetZero()
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				clearPositions(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearPositions(v.Index(i))
+		}
+	}
+}
+
 func TestParse(t *testing.T) {
 	strPtr := func(s string) *string { return &s }
 	intPtr := func(i int) *int { return &i }
+	floatPtr := func(f float64) *float64 { return &f }
 	boolPtr := func(b Boolean) *Boolean { return &b }
 
+	// operand builds a comparison operand of a single value.
+	operand := func(v Value) Operand {
+		return Operand{Term: Term{Factor: Factor{Value: &v}}}
+	}
+
 	// and builds an AndExpr from a leading expression followed by AND-ed ones.
 	and := func(first Expr, rest ...Expr) AndExpr {
 		a := AndExpr{Expr: first}
@@ -38,52 +84,52 @@ func TestParse(t *testing.T) {
 		{
 			name:  "simple comparison",
 			input: "x > 1",
-			expected: expr(and(Compare{
-				Left:  Value{Symbol: strPtr("x")},
+			expected: expr(and(&Compare{
+				Left:  operand(Value{Symbol: strPtr("x")}),
 				Op:    ComparisonOp{Gt: true},
-				Right: Value{Int: intPtr(1)},
+				Right: operand(Value{Int: intPtr(1)}),
 			})),
 		},
 		{
 			name:  "simple comparison with !=",
 			input: "x != 1",
-			expected: expr(and(Compare{
-				Left:  Value{Symbol: strPtr("x")},
+			expected: expr(and(&Compare{
+				Left:  operand(Value{Symbol: strPtr("x")}),
 				Op:    ComparisonOp{Neq: true},
-				Right: Value{Int: intPtr(1)},
+				Right: operand(Value{Int: intPtr(1)}),
 			})),
 		},
 		{
 			name:  "simple comparison with >=",
 			input: "x >= 1",
-			expected: expr(and(Compare{
-				Left:  Value{Symbol: strPtr("x")},
+			expected: expr(and(&Compare{
+				Left:  operand(Value{Symbol: strPtr("x")}),
 				Op:    ComparisonOp{Gte: true},
-				Right: Value{Int: intPtr(1)},
+				Right: operand(Value{Int: intPtr(1)}),
 			})),
 		},
 		{
 			name:  "simple comparison with two variables",
 			input: "x > y",
-			expected: expr(and(Compare{
-				Left:  Value{Symbol: strPtr("x")},
+			expected: expr(and(&Compare{
+				Left:  operand(Value{Symbol: strPtr("x")}),
 				Op:    ComparisonOp{Gt: true},
-				Right: Value{Symbol: strPtr("y")},
+				Right: operand(Value{Symbol: strPtr("y")}),
 			})),
 		},
 		{
 			name:  "2 comparison with and",
 			input: "x > 1 and y = 2",
 			expected: expr(and(
-				Compare{
-					Left:  Value{Symbol: strPtr("x")},
+				&Compare{
+					Left:  operand(Value{Symbol: strPtr("x")}),
 					Op:    ComparisonOp{Gt: true},
-					Right: Value{Int: intPtr(1)},
+					Right: operand(Value{Int: intPtr(1)}),
 				},
-				Compare{
-					Left:  Value{Symbol: strPtr("y")},
+				&Compare{
+					Left:  operand(Value{Symbol: strPtr("y")}),
 					Op:    ComparisonOp{Eq: true},
-					Right: Value{Int: intPtr(2)},
+					Right: operand(Value{Int: intPtr(2)}),
 				},
 			)),
 		},
@@ -93,21 +139,21 @@ func TestParse(t *testing.T) {
 			input: "x > 1 && y = 2 || z = 3",
 			expected: expr(
 				and(
-					Compare{
-						Left:  Value{Symbol: strPtr("x")},
+					&Compare{
+						Left:  operand(Value{Symbol: strPtr("x")}),
 						Op:    ComparisonOp{Gt: true},
-						Right: Value{Int: intPtr(1)},
+						Right: operand(Value{Int: intPtr(1)}),
 					},
-					Compare{
-						Left:  Value{Symbol: strPtr("y")},
+					&Compare{
+						Left:  operand(Value{Symbol: strPtr("y")}),
 						Op:    ComparisonOp{Eq: true},
-						Right: Value{Int: intPtr(2)},
+						Right: operand(Value{Int: intPtr(2)}),
 					},
 				),
-				and(Compare{
-					Left:  Value{Symbol: strPtr("z")},
+				and(&Compare{
+					Left:  operand(Value{Symbol: strPtr("z")}),
 					Op:    ComparisonOp{Eq: true},
-					Right: Value{Int: intPtr(3)},
+					Right: operand(Value{Int: intPtr(3)}),
 				}),
 			),
 		},
@@ -118,40 +164,171 @@ func TestParse(t *testing.T) {
 			input: `x > 1 and y = 2 or ( x = "hello" or z = true ) and test = false`,
 			expected: expr(
 				and(
-					Compare{
-						Left:  Value{Symbol: strPtr("x")},
+					&Compare{
+						Left:  operand(Value{Symbol: strPtr("x")}),
 						Op:    ComparisonOp{Gt: true},
-						Right: Value{Int: intPtr(1)},
+						Right: operand(Value{Int: intPtr(1)}),
 					},
-					Compare{
-						Left:  Value{Symbol: strPtr("y")},
+					&Compare{
+						Left:  operand(Value{Symbol: strPtr("y")}),
 						Op:    ComparisonOp{Eq: true},
-						Right: Value{Int: intPtr(2)},
+						Right: operand(Value{Int: intPtr(2)}),
 					},
 				),
 				and(
-					SubExpr{
+					&SubExpr{
 						BoolExpr: *expr(
-							and(Compare{
-								Left:  Value{Symbol: strPtr("x")},
+							and(&Compare{
+								Left:  operand(Value{Symbol: strPtr("x")}),
 								Op:    ComparisonOp{Eq: true},
-								Right: Value{String: strPtr("hello")},
+								Right: operand(Value{String: strPtr("hello")}),
 							}),
-							and(Compare{
-								Left:  Value{Symbol: strPtr("z")},
+							and(&Compare{
+								Left:  operand(Value{Symbol: strPtr("z")}),
 								Op:    ComparisonOp{Eq: true},
-								Right: Value{Bool: boolPtr(true)},
+								Right: operand(Value{Bool: boolPtr(true)}),
 							}),
 						),
 					},
-					Compare{
-						Left:  Value{Symbol: strPtr("test")},
+					&Compare{
+						Left:  operand(Value{Symbol: strPtr("test")}),
 						Op:    ComparisonOp{Eq: true},
-						Right: Value{Bool: boolPtr(false)},
+						Right: operand(Value{Bool: boolPtr(false)}),
 					},
 				),
 			),
 		},
+		{
+			// "not" binds tighter than "and": (not x) and y
+			name:  "not binds tighter than and",
+			input: "not x and y",
+			expected: expr(and(
+				&NotExpr{Expr: &BoolValue{Value: Value{Symbol: strPtr("x")}}},
+				&BoolValue{Value: Value{Symbol: strPtr("y")}},
+			)),
+		},
+		{
+			name:  "! negates a group",
+			input: `!(x = 1 or y)`,
+			expected: expr(and(&NotExpr{Expr: &SubExpr{
+				BoolExpr: *expr(
+					and(&Compare{
+						Left:  operand(Value{Symbol: strPtr("x")}),
+						Op:    ComparisonOp{Eq: true},
+						Right: operand(Value{Int: intPtr(1)}),
+					}),
+					and(&BoolValue{Value: Value{Symbol: strPtr("y")}}),
+				),
+			}})),
+		},
+		{
+			name:  "not negates a whole comparison",
+			input: "not x != 1",
+			expected: expr(and(&NotExpr{Expr: &Compare{
+				Left:  operand(Value{Symbol: strPtr("x")}),
+				Op:    ComparisonOp{Neq: true},
+				Right: operand(Value{Int: intPtr(1)}),
+			}})),
+		},
+		{
+			name:  "in with a literal list",
+			input: `x in (1, 2.5)`,
+			expected: expr(and(&Compare{
+				Left: operand(Value{Symbol: strPtr("x")}),
+				Op:   ComparisonOp{In: true},
+				Right: operand(Value{List: &List{
+					Values: []Value{{Int: intPtr(1)}, {Float: floatPtr(2.5)}},
+					Set: &LiteralSet{
+						Ints:   map[int]struct{}{1: {}},
+						Floats: map[float64]struct{}{2.5: {}},
+					},
+				}}),
+			})),
+		},
+		{
+			name:  "arithmetic binds tighter than comparison, * tighter than +",
+			input: `a + b * -c > -1`,
+			expected: expr(and(&Compare{
+				Left: Operand{
+					Term: Term{Factor: Factor{Value: &Value{Symbol: strPtr("a")}}},
+					Ops: []SumOp{{Op: "+", Term: Term{
+						Factor: Factor{Value: &Value{Symbol: strPtr("b")}},
+						Ops: []TermOp{{Op: "*", Factor: Factor{
+							Neg: &Factor{Value: &Value{Symbol: strPtr("c")}},
+						}}},
+					}}},
+				},
+				Op:    ComparisonOp{Gt: true},
+				Right: operand(Value{Int: intPtr(-1)}),
+			})),
+		},
+		{
+			name:  "a parenthesized value is a group outside in",
+			input: `(a) * 2 = (1)`,
+			expected: expr(and(&Compare{
+				Left: Operand{Term: Term{
+					Factor: Factor{Group: &Operand{Term: Term{Factor: Factor{Value: &Value{Symbol: strPtr("a")}}}}},
+					Ops:    []TermOp{{Op: "*", Factor: Factor{Value: &Value{Int: intPtr(2)}}}},
+				}},
+				Op:    ComparisonOp{Eq: true},
+				Right: Operand{Term: Term{Factor: Factor{Group: &Operand{Term: Term{Factor: Factor{Value: &Value{Int: intPtr(1)}}}}}}},
+			})),
+		},
+		{
+			name:  "symbol paths",
+			input: `items[0].sku = meta["x-key"]`,
+			expected: expr(and(&Compare{
+				Left: operand(Value{Symbol: strPtr("items"), Path: []PathElem{
+					{Index: intPtr(0)}, {Field: strPtr("sku")},
+				}}),
+				Op: ComparisonOp{Eq: true},
+				Right: operand(Value{Symbol: strPtr("meta"), Path: []PathElem{
+					{Key: strPtr("x-key")},
+				}}),
+			})),
+		},
+		{
+			name:  "function calls resolve their function",
+			input: `len(lower(s)) > max(1, x + 1)`,
+			expected: expr(and(&Compare{
+				Left: operand(Value{Call: &Call{
+					Name: "len",
+					Args: []Operand{operand(Value{Call: &Call{
+						Name: "lower",
+						Args: []Operand{operand(Value{Symbol: strPtr("s")})},
+						Func: builtins["lower"],
+					}})},
+					Func: builtins["len"],
+				}}),
+				Op: ComparisonOp{Gt: true},
+				Right: operand(Value{Call: &Call{
+					Name: "max",
+					Args: []Operand{
+						operand(Value{Int: intPtr(1)}),
+						{Term: Term{Factor: Factor{Value: &Value{Symbol: strPtr("x")}}}, Ops: []SumOp{
+							{Op: "+", Term: Term{Factor: Factor{Value: &Value{Int: intPtr(1)}}}},
+						}},
+					},
+					Func: builtins["max"],
+				}}),
+			})),
+		},
+		{
+			name:     "a reserved word followed by a parenthesis is not a call",
+			input:    `not (a)`,
+			expected: expr(and(&NotExpr{Expr: &SubExpr{BoolExpr: *expr(and(&BoolValue{Value: Value{Symbol: strPtr("a")}}))}})),
+		},
+		{
+			name:  "not in with symbols in the list has no set",
+			input: `x not in ("a", y)`,
+			expected: expr(and(&Compare{
+				Left: operand(Value{Symbol: strPtr("x")}),
+				Op:   ComparisonOp{NotIn: true},
+				Right: operand(Value{List: &List{
+					Values: []Value{{String: strPtr("a")}, {Symbol: strPtr("y")}},
+				}}),
+			})),
+		},
 	}
 
 	for _, tc := range tcs {
@@ -159,7 +336,262 @@ func TestParse(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			output, err := Parse(tc.input)
 			assert.NoError(t, err)
-			assert.Equal(t, Expression{tc.expected}, output)
+			clearPositions(reflect.ValueOf(output.e))
+			assert.Equal(t, Expression{e: tc.expected}, output)
+		})
+	}
+}
+
+func TestParseDeepNesting(t *testing.T) {
+	const depth = 100
+	nest := func(open, inner, close string) string {
+		return strings.Repeat(open, depth) + inner + strings.Repeat(close, depth)
+	}
+
+	tcs := []struct {
+		name     string
+		input    string
+		expected bool
+		err      error
+	}{
+		{name: "sub-expressions", input: nest("(", "x = 1", ")"), expected: true},
+		{name: "conditions", input: nest("(x = 1 and ", "x = 1", ")"), expected: true},
+		{name: "negations", input: nest("not (", "x != 1", ")"), expected: false},
+		{name: "groups", input: "x = " + nest("(", "1", ")"), expected: true},
+		{name: "arithmetic", input: "x < " + nest("(1 + ", "1", ")"), expected: true},
+		{name: "nested lists", input: "x in " + nest("(1, ", "1", ")"), err: ErrorWrongDataType},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			exp, err := Parse(tc.input)
+			assert.Less(t, time.Since(start), 250*time.Millisecond, "parsing is linear in the nesting depth")
+
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			res, err := EvalExpression(exp, SymbolsMap{"x": 1})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tcs := []struct {
+		name     string
+		input    string
+		expected error
+	}{
+		{name: "list mixes kinds", input: `x in (1, "a")`, expected: ErrorWrongDataType},
+		{name: "list outside in", input: `x = (1, 2)`, expected: ErrorWrongDataType},
+		{name: "list on the left", input: `(1, 2) in x`, expected: ErrorWrongDataType},
+		{name: "nested list", input: `x in ((1, 2), 3)`, expected: ErrorWrongDataType},
+		{name: "empty list", input: `x in ()`},
+		{name: "unknown function", input: `size(x) > 1`, expected: ErrUnknownFunction},
+		{name: "too few arguments", input: `len() > 1`, expected: ErrArgumentCount},
+		{name: "too many arguments", input: `lower(a, b) = "a"`, expected: ErrArgumentCount},
+		{name: "no arguments to a variadic function", input: `max() = 1`, expected: ErrArgumentCount},
+		{name: "literal of the wrong kind", input: `len(1) > 1`, expected: ErrorWrongDataType},
+		{name: "result of the wrong kind", input: `abs(lower(s)) > 1`, expected: ErrorWrongDataType},
+		{name: "variadic argument of the wrong kind", input: `min(x, 2, "a") > 1`, expected: ErrorWrongDataType},
+		{name: "arithmetic argument of the wrong kind", input: `upper(1 + 2) = "3"`, expected: ErrorWrongDataType},
+		{name: "list argument", input: `len((1, 2)) = 2`, expected: ErrorWrongDataType},
+		{name: "call in a list", input: `x in (1, size(y))`, expected: ErrUnknownFunction},
+		{name: "invalid date", input: `t > 2024-13-01`},
+		{name: "invalid time", input: `t > 2024-01-01T25:00:00Z`},
+		{name: "time out of range", input: `t > 1600-01-01`},
+		{name: "duration out of range", input: `d > 3000000h`},
+		{name: "duration without a unit", input: `d > 1h30`},
+		{name: "list mixes times and durations", input: `t in (2024-01-01, 1h)`, expected: ErrorWrongDataType},
+		{name: "list mixes times and strings", input: `t in (2024-01-01, "2024-01-02")`, expected: ErrorWrongDataType},
+		{name: "time argument", input: `lower(2024-01-01) = "a"`, expected: ErrorWrongDataType},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			if tc.expected == nil {
+				assert.Error(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tcs := []struct {
+		name     string
+		input    string
+		offset   int
+		line     int
+		column   int
+		got      string
+		expected []string
+	}{
+		{
+			name:   "dangling comparison",
+			input:  `x >`,
+			offset: 3, line: 1, column: 4,
+			got:      "<EOF>",
+			expected: []string{"<symbol>", "<int>", "<float>", "<string>", "<time>", "<duration>", "true", "false", "null", "(", "="},
+		},
+		{
+			name:   "dangling and",
+			input:  `x = 1 and`,
+			offset: 9, line: 1, column: 10,
+			got:      "<EOF>",
+			expected: []string{"<symbol>", "<int>", "<float>", "<string>", "<time>", "<duration>", "true", "false", "null", "not", "!", "("},
+		},
+		{
+			name:   "missing operator",
+			input:  `x = 1 y`,
+			offset: 6, line: 1, column: 7,
+			got:      "y",
+			expected: []string{"<EOF>", "and", "&&", "or", "||"},
+		},
+		{
+			name:   "on a later line",
+			input:  "x = 1 and\n  y ? 2",
+			offset: 14, line: 2, column: 5,
+			got: "?",
+			expected: []string{"<EOF>", "and", "&&", "or", "||", "=", "==", "!=", ">", ">=", "<", "<=",
+				"contains", "excludes", "starts_with", "ends_with", "match",
+				"icontains", "istarts_with", "iends_with", "imatch", "equals_fold", "like", "glob", "in", "not in",
+				"exists", "is", "<operator>"},
+		},
+		{
+			name:   "unclosed group",
+			input:  `(x = 1`,
+			offset: 6, line: 1, column: 7,
+			got:      "<EOF>",
+			expected: []string{")", "and", "&&", "or", "||"},
+		},
+		{
+			name:   "dangling and inside a group",
+			input:  `(x = 1 and`,
+			offset: 10, line: 1, column: 11,
+			got:      "<EOF>",
+			expected: []string{"<symbol>", "<int>", "<float>", "<string>", "<time>", "<duration>", "true", "false", "null", "not", "!", "("},
+		},
+		{
+			name:   "half an operator",
+			input:  `x ! 1`,
+			offset: 4, line: 1, column: 5,
+			got:      "1",
+			expected: []string{"="},
+		},
+		{
+			name:   "empty input",
+			input:  ``,
+			offset: 0, line: 1, column: 1,
+			got:      "<EOF>",
+			expected: []string{"<symbol>", "<int>", "<float>", "<string>", "<time>", "<duration>", "true", "false", "null", "not", "!", "("},
+		},
+		{
+			name:   "dangling dot",
+			input:  `x. = 1`,
+			offset: 3, line: 1, column: 4,
+			got: "=",
+			// any identifier names a field, reserved words included
+			expected: []string{"<symbol>", "true", "false", "null", "not", "and", "or", "in", "not in"},
+		},
+		{
+			name:   "empty brackets",
+			input:  `x[] = 1`,
+			offset: 2, line: 1, column: 3,
+			got:      "]",
+			expected: []string{"<int>", "<string>"},
+		},
+		{
+			name:   "unclosed brackets",
+			input:  `x[1 = 1`,
+			offset: 4, line: 1, column: 5,
+			got:      "=",
+			expected: []string{"]"},
+		},
+		{
+			name:   "unterminated string",
+			input:  `x = "abc`,
+			offset: 8, line: 1, column: 9,
+			got: "<EOF>",
+		},
+		{
+			name:   "list mixing kinds points at the element",
+			input:  `x in (1, "a")`,
+			offset: 9, line: 1, column: 10,
+			got: `"a"`,
+		},
+		{
+			name:   "unknown function points at its name",
+			input:  `x = 1 and sizeof(tags) > 2`,
+			offset: 10, line: 1, column: 11,
+			got: "sizeof",
+		},
+		{
+			name:   "wrong arguments point at the call",
+			input:  `x = 1 and lower(1) = "1"`,
+			offset: 10, line: 1, column: 11,
+			got: "lower(1)",
+		},
+		{
+			name:   "unclosed call",
+			input:  `len(x > 1`,
+			offset: 6, line: 1, column: 7,
+			got:      ">",
+			expected: []string{")", ","},
+		},
+		{
+			name:   "invalid time points at the literal",
+			input:  `x = 1 and t > 2024-13-01`,
+			offset: 14, line: 1, column: 15,
+			got: "2024-13-01",
+		},
+		{
+			name:   "duration out of range points at the literal",
+			input:  `d < -3000000h`,
+			offset: 5, line: 1, column: 6,
+			got: "3000000h",
+		},
+		{
+			name:   "list outside in points at the list",
+			input:  `x = 1 or y = (1, 2)`,
+			offset: 13, line: 1, column: 14,
+			got: `(1, 2)`,
+		},
+		{
+			name:   "too deep to locate falls back to the parser's error",
+			input:  strings.Repeat("(a = 1 and ", 50) + "x = 1" + strings.Repeat(")", 49),
+			offset: 604, line: 1, column: 605,
+			got: "<EOF>",
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.input)
+
+			var perr *ParseError
+			require.True(t, errors.As(err, &perr), "expected a *ParseError, got %T", err)
+			assert.Equal(t, Position{Offset: tc.offset, Line: tc.line, Column: tc.column}, perr.Position)
+			assert.Equal(t, tc.got, perr.Got)
+			assert.ElementsMatch(t, tc.expected, perr.Expected)
 		})
 	}
 }
+
+func TestParseErrorMessage(t *testing.T) {
+	_, err := Parse(`x = 1 y`)
+	assert.EqualError(t, err, `1:7: unexpected token "y" (expected <EOF>, and, &&, or, ||)`)
+
+	_, err = Parse(`t > 2024-13-01`)
+	assert.EqualError(t, err, `1:5: parsing time "2024-13-01": month out of range`)
+}
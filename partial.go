@@ -0,0 +1,458 @@
+package boolexpr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// PartialEval evaluates what it can of e with the symbols known ahead of time,
+// and returns the residual expression that is left to evaluate once the other
+// symbols are known. A symbol is unknown when known reports it with
+// [ErrSymbolNotFound]; any other error from known is returned.
+//
+// Every comparison whose operands are all known is folded into its result,
+// and "and", "or" and "not" are simplified around the results: a false
+// operand of "and" is dropped or decides it, and likewise for "or". When the
+// outcome is already decided, the residual is the constant "true" or "false";
+// check it with [Expression.String] or evaluate it against empty Symbols.
+//
+// In the comparisons that remain, known symbols holding a bool, int, float64,
+// string, time or duration are replaced by their value, and nil ones by null,
+// so the residual doesn't need them. Other known values, such as slices, keep
+// their symbol.
+//
+// A comparison that fails to evaluate is kept, so that the residual reports
+// the error if evaluation reaches it. Folding may however decide the
+// result without it: "x > 1 or true" is "true" even though x > 1 would have
+// failed first. Positions in errors from the residual still refer to e.
+func PartialEval(e Expression, known Symbols) (Expression, error) {
+	if e.e == nil {
+		return Expression{}, errors.New("PartialEval called on zero-value Expression; use Parse to obtain a valid Expression")
+	}
+
+	p := partial{known: known, values: map[string]any{}, missing: e.missing}
+	r, err := p.boolExpr(e.e)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	return Expression{e: r.boolExpr(), missing: e.missing}, nil
+}
+
+// residual is the result of partially evaluating a node: either the constant
+// it evaluated to, or the expression left.
+type residual struct {
+	expr  Expr // nil for a constant
+	value bool
+}
+
+func constant(b bool) residual { return residual{value: b} }
+
+func (r residual) boolExpr() *BoolExpr {
+	x := r.expr
+	if x == nil {
+		b := Boolean(r.value)
+		x = &BoolValue{Value: Value{Bool: &b}}
+	}
+
+	if sub, ok := x.(*SubExpr); ok {
+		return &sub.BoolExpr
+	}
+
+	return &BoolExpr{And: AndExpr{Expr: x}}
+}
+
+type partial struct {
+	known Symbols
+	// values caches the known symbols resolved so far, so each is resolved
+	// once; unknown symbols are absent.
+	values  map[string]any
+	unknown map[string]struct{}
+	// missing is the MissingSymbols the expression was parsed with, which
+	// folding follows.
+	missing MissingSymbols
+}
+
+// syms returns the known symbols resolved so far, to evaluate a node whose
+// symbols are all known.
+func (p *partial) syms() Symbols {
+	return withOptions(SymbolsMap(p.values), nil, p.missing)
+}
+
+func (p *partial) boolExpr(b *BoolExpr) (residual, error) {
+	var left []Expr
+	ands := make([]*AndExpr, 0, len(b.OrOps)+1)
+	ands = append(ands, &b.And)
+	for i := range b.OrOps {
+		ands = append(ands, &b.OrOps[i].And)
+	}
+
+	for _, a := range ands {
+		r, err := p.andExpr(a)
+		if err != nil {
+			return residual{}, err
+		}
+
+		if r.expr == nil {
+			if r.value {
+				return constant(true), nil
+			}
+
+			continue
+		}
+
+		left = append(left, r.expr)
+	}
+
+	if len(left) == 0 {
+		return constant(false), nil
+	}
+
+	return residual{expr: join(left, false)}, nil
+}
+
+func (p *partial) andExpr(a *AndExpr) (residual, error) {
+	var left []Expr
+	exprs := make([]Expr, 0, len(a.AndOps)+1)
+	exprs = append(exprs, a.Expr)
+	for _, op := range a.AndOps {
+		exprs = append(exprs, op.Expr)
+	}
+
+	for _, x := range exprs {
+		r, err := p.expr(x)
+		if err != nil {
+			return residual{}, err
+		}
+
+		if r.expr == nil {
+			if !r.value {
+				return constant(false), nil
+			}
+
+			continue
+		}
+
+		left = append(left, r.expr)
+	}
+
+	if len(left) == 0 {
+		return constant(true), nil
+	}
+
+	return residual{expr: join(left, true)}, nil
+}
+
+// join joins xs with "and", or "or", in a group when there is more than one.
+func join(xs []Expr, and bool) Expr {
+	if len(xs) == 1 {
+		return xs[0]
+	}
+
+	sub := &SubExpr{}
+	if and {
+		sub.BoolExpr.And.Expr = xs[0]
+		for _, x := range xs[1:] {
+			sub.BoolExpr.And.AndOps = append(sub.BoolExpr.And.AndOps, AndOpExpr{Expr: x})
+		}
+
+		return sub
+	}
+
+	sub.BoolExpr.And = andOperand(xs[0])
+	for _, x := range xs[1:] {
+		sub.BoolExpr.OrOps = append(sub.BoolExpr.OrOps, OrOpExpr{And: andOperand(x)})
+	}
+
+	return sub
+}
+
+// andOperand returns x as an operand of "or", unwrapping a group holding only
+// an "and" chain, which needs no parentheses there.
+func andOperand(x Expr) AndExpr {
+	if sub, ok := x.(*SubExpr); ok && len(sub.BoolExpr.OrOps) == 0 {
+		return sub.BoolExpr.And
+	}
+
+	return AndExpr{Expr: x}
+}
+
+func (p *partial) expr(x Expr) (residual, error) {
+	switch e := x.(type) {
+	case *Compare:
+		return p.compare(e)
+	case *BoolValue:
+		return p.boolValue(e)
+	case *NullTest:
+		return p.nullTest(e)
+	case *SubExpr:
+		return p.boolExpr(&e.BoolExpr)
+	case *NotExpr:
+		r, err := p.expr(e.Expr)
+		if err != nil {
+			return residual{}, err
+		}
+
+		if r.expr == nil {
+			return constant(!r.value), nil
+		}
+
+		return residual{expr: &NotExpr{Expr: r.expr}}, nil
+	default:
+		return residual{}, fmt.Errorf("Expr type is unhandled %T", x)
+	}
+}
+
+func (p *partial) compare(e *Compare) (residual, error) {
+	var vals []*Value
+	collect := func(v *Value) { vals = append(vals, v) }
+	walkOperand(&e.Left, collect)
+	walkOperand(&e.Right, collect)
+
+	known, err := p.allKnown(vals...)
+	if err != nil {
+		return residual{}, newEvalError(e.Pos, e.EndPos, err)
+	}
+
+	if known {
+		if res, err := evalCompare(e, p.syms()); err == nil {
+			return constant(res), nil
+		}
+	}
+
+	c := *e
+	c.Left, c.Right = p.substituteOperand(e.Left), p.substituteOperand(e.Right)
+	return residual{expr: &c}, nil
+}
+
+func (p *partial) boolValue(e *BoolValue) (residual, error) {
+	known, err := p.allKnown(&e.Value)
+	if err != nil {
+		return residual{}, newEvalError(e.Value.Pos, e.Value.EndPos, err)
+	}
+
+	if known {
+		if res, err := evalBoolValue(e, p.syms()); err == nil {
+			return constant(res), nil
+		}
+	}
+
+	return residual{expr: &BoolValue{Value: p.substitute(e.Value)}}, nil
+}
+
+// nullTest folds "x exists" once x is known, and "x is null" once all its
+// symbols are. An unknown symbol may still turn out to be present, so "x
+// exists" is kept, and keeps its symbol.
+func (p *partial) nullTest(e *NullTest) (residual, error) {
+	var vals []*Value
+	walkOperand(&e.Operand, func(v *Value) { vals = append(vals, v) })
+
+	known, err := p.allKnown(vals...)
+	if err != nil {
+		return residual{}, newEvalError(e.Pos, e.EndPos, err)
+	}
+
+	if known {
+		if res, err := evalNullTest(e, p.syms()); err == nil {
+			return constant(res), nil
+		}
+	}
+
+	if e.Exists {
+		return residual{expr: e}, nil
+	}
+
+	t := *e
+	t.Operand = p.substituteOperand(e.Operand)
+	return residual{expr: &t}, nil
+}
+
+// allKnown reports whether every symbol of vs is known, resolving each one.
+func (p *partial) allKnown(vs ...*Value) (bool, error) {
+	known := true
+	for _, v := range vs {
+		switch {
+		case v.Symbol != nil:
+			ok, err := p.resolve(*v.Symbol)
+			if err != nil {
+				return false, err
+			}
+			known = known && ok
+		case v.Call != nil:
+			if f, ok := v.Call.Func.(*function); ok && f.volatile {
+				known = false
+			}
+
+			var args []*Value
+			collect := func(v *Value) { args = append(args, v) }
+			for i := range v.Call.Args {
+				walkOperand(&v.Call.Args[i], collect)
+			}
+
+			ok, err := p.allKnown(args...)
+			if err != nil {
+				return false, err
+			}
+			known = known && ok
+		case v.List != nil:
+			for i := range v.List.Values {
+				ok, err := p.allKnown(&v.List.Values[i])
+				if err != nil {
+					return false, err
+				}
+				known = known && ok
+			}
+		}
+	}
+
+	return known, nil
+}
+
+// resolve looks symbol up in the known symbols once, and reports whether it is
+// known.
+func (p *partial) resolve(symbol string) (bool, error) {
+	if _, ok := p.values[symbol]; ok {
+		return true, nil
+	}
+
+	if _, ok := p.unknown[symbol]; ok {
+		return false, nil
+	}
+
+	v, err := p.known.Get(symbol)
+	if errors.Is(err, ErrSymbolNotFound) {
+		if p.unknown == nil {
+			p.unknown = map[string]struct{}{}
+		}
+		p.unknown[symbol] = struct{}{}
+
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	p.values[symbol] = v
+	return true, nil
+}
+
+// substituteOperand returns a copy of o with its known symbols replaced by
+// literals, leaving o intact.
+func (p *partial) substituteOperand(o Operand) Operand {
+	o.Term = p.substituteTerm(o.Term)
+	o.Ops = slices.Clone(o.Ops)
+	for i := range o.Ops {
+		o.Ops[i].Term = p.substituteTerm(o.Ops[i].Term)
+	}
+
+	return o
+}
+
+func (p *partial) substituteTerm(t Term) Term {
+	t.Factor = p.substituteFactor(t.Factor)
+	t.Ops = slices.Clone(t.Ops)
+	for i := range t.Ops {
+		t.Ops[i].Factor = p.substituteFactor(t.Ops[i].Factor)
+	}
+
+	return t
+}
+
+func (p *partial) substituteFactor(f Factor) Factor {
+	switch {
+	case f.Value != nil:
+		v := p.substitute(*f.Value)
+		f.Value = &v
+	case f.Group != nil:
+		g := p.substituteOperand(*f.Group)
+		f.Group = &g
+	case f.Neg != nil:
+		n := p.substituteFactor(*f.Neg)
+		f.Neg = &n
+	}
+
+	return f
+}
+
+// substitute returns v with its known symbols replaced by literals of their
+// values, when they can be written as one.
+func (p *partial) substitute(v Value) Value {
+	switch {
+	case v.Symbol != nil:
+		val, ok := p.values[*v.Symbol]
+		if !ok {
+			return v
+		}
+
+		if len(v.Path) > 0 {
+			var err error
+			if val, err = walkPath(context.Background(), &v, val); err != nil {
+				return v
+			}
+		}
+
+		lit := Value{Pos: v.Pos, EndPos: v.EndPos}
+		switch val := val.(type) {
+		case nil:
+			lit.Null = true
+		case bool:
+			b := Boolean(val)
+			lit.Bool = &b
+		case int:
+			lit.Int = &val
+		case float64:
+			if math.IsNaN(val) || math.IsInf(val, 0) {
+				return v
+			}
+			lit.Float = &val
+		case string:
+			lit.String = &val
+		case time.Time:
+			if val.Before(MinTime) || val.After(MaxTime) {
+				return v
+			}
+			lit.Time = &Time{Time: val}
+		case time.Duration:
+			d := Duration(val)
+			lit.Duration = &d
+		default:
+			return v
+		}
+
+		return lit
+	case v.Call != nil:
+		call := *v.Call
+		call.Args = make([]Operand, len(v.Call.Args))
+		for i := range v.Call.Args {
+			call.Args[i] = p.substituteOperand(v.Call.Args[i])
+		}
+		v.Call = &call
+
+		return v
+	case v.List != nil:
+		// A list of literals, which has its set, has nothing to substitute.
+		// Others are copied so the original stays intact, and get a set
+		// once their symbols are all replaced by literals of one kind.
+		if v.List.Set != nil {
+			return v
+		}
+
+		list := &List{Values: make([]Value, len(v.List.Values))}
+		for i := range v.List.Values {
+			list.Values[i] = p.substitute(v.List.Values[i])
+		}
+		list.Set = literalSet(list.Values)
+		v.List = list
+
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,227 @@
+package boolexpr
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialEval(t *testing.T) {
+	known := SymbolsMap{
+		"plan":   "pro",
+		"seats":  10,
+		"ratio":  0.5,
+		"beta":   true,
+		"tags":   []string{"eu", "gdpr"},
+		"region": func() string { return "eu-west" },
+		"org":    map[string]any{"tier": "gold", "ids": []int{7}},
+		"since":  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"ttl":    90 * time.Minute,
+		"gone":   nil,
+		"inf":    math.Inf(1),
+		"nan":    math.NaN(),
+	}
+
+	tcs := []struct {
+		input    string
+		residual string
+	}{
+		{`plan = "pro"`, `true`},
+		{`plan = "free"`, `false`},
+		{`plan = "pro" and age > 18`, `age > 18`},
+		{`plan = "free" and age > 18`, `false`},
+		{`plan = "free" or age > 18`, `age > 18`},
+		{`plan = "pro" or age > 18`, `true`},
+		{`age > 18 and plan = "pro" and name = "x"`, `age > 18 and name = "x"`},
+		{`age > 18 or plan = "free" or name = "x"`, `age > 18 or name = "x"`},
+		{`age > seats`, `age > 10`},
+		{`ratio < score and beta`, `0.5 < score`},
+		{`region starts_with prefix`, `"eu-west" starts_with prefix`},
+		{`country in (plan, "nl", other)`, `country in ("pro", "nl", other)`},
+		{`tags contains tag`, `tags contains tag`},
+		{`tags contains "eu" and x`, `x`},
+		{`not (plan = "pro") or x`, `x`},
+		{`not (plan = "pro" and x)`, `not x`},
+		{`not (x or y)`, `not (x or y)`},
+		{`org.tier = "gold" and org.ids[0] = id`, `7 = id`},
+		{`org.tier = tier or items[0] > 1`, `"gold" = tier or items[0] > 1`},
+		{`seats * price > 100`, `10 * price > 100`},
+		{`seats * 2 - 1 = 19 and x`, `x`},
+		{`(a or plan = "free") and (b or c) or d`, `a and (b or c) or d`},
+		{`(a and seats = 10) or (b and beta)`, `a or b`},
+		{`beta`, `true`},
+		{`not beta and x`, `false`},
+		{`x`, `x`},
+		{`seats in (1, 2, 10)`, `true`},
+		{`seats > "a" and x`, `10 > "a" and x`},
+		{`len(tags) = 2 and upper(plan) = "PRO" and x`, `x`},
+		{`lower(plan) = name and max(seats, n) > 5`, `lower("pro") = name and max(10, n) > 5`},
+		{`since < 2024-06-01 and at - since > ttl`, `at - 2024-01-01 > 1h30m0s`},
+		{`since < now() and x`, `2024-01-01 < now() and x`},
+		{`gone is null and x`, `x`},
+		{`gone = null or x`, `true`},
+		{`x exists and plan exists`, `x exists`},
+		{`gone != y and y is not null`, `null != y and y is not null`},
+		{`score < inf and ratio < score`, `score < inf and 0.5 < score`},
+		{`nan != score or inf > 1`, `true`},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+			source := exp.String()
+
+			r, err := PartialEval(exp, known)
+			require.NoError(t, err)
+			assert.Equal(t, tc.residual, r.String())
+			assert.Equal(t, source, exp.String(), "the original expression is left intact")
+
+			_, err = Parse(r.String())
+			assert.NoError(t, err, "the residual parses")
+		})
+	}
+}
+
+func TestPartialEvalResidual(t *testing.T) {
+	known := SymbolsMap{"plan": "pro", "seats": 10, "beta": false, "tags": []string{"eu"}}
+	later := SymbolsMap{"age": 30, "name": "x", "country": "nl", "a": true, "b": false}
+
+	all := SymbolsMap{}
+	for k, v := range known {
+		all[k] = v
+	}
+	for k, v := range later {
+		all[k] = v
+	}
+
+	for _, input := range []string{
+		`plan = "pro" and age > seats`,
+		`not beta and (country in ("nl", plan) or b)`,
+		`a and tags contains "eu" or name = plan`,
+		`(b or seats < 5) and age >= 18 or not (a and beta)`,
+		`len(tags) = 1 and upper(name) = "X" and min(age, seats) = seats`,
+	} {
+		exp, err := Parse(input)
+		require.NoError(t, err)
+
+		want, err := EvalExpression(exp, all)
+		require.NoError(t, err)
+
+		r, err := PartialEval(exp, known)
+		require.NoError(t, err)
+
+		// Of the known symbols, only tags can't be written as a literal, so it
+		// is the only one still needed.
+		rest := SymbolsMap{"tags": known["tags"]}
+		for k, v := range later {
+			rest[k] = v
+		}
+
+		got, err := EvalExpression(r, rest)
+		require.NoError(t, err, "%s => %s", input, r)
+		assert.Equal(t, want, got, "%s => %s", input, r)
+	}
+}
+
+func TestPartialEvalListSet(t *testing.T) {
+	tcs := []struct {
+		input string
+		set   bool
+	}{
+		{`age > seats and country in ("DE", "FR")`, true},
+		{`age > seats and country in ("DE", plan)`, true},
+		{`age > seats and country in ("DE", name)`, false},
+		{`age > seats and country in (seats, "FR")`, false},
+	}
+
+	for _, tc := range tcs {
+		exp, err := Parse(tc.input)
+		require.NoError(t, err)
+
+		r, err := PartialEval(exp, SymbolsMap{"plan": "pro", "seats": 10})
+		require.NoError(t, err)
+
+		list := r.e.And.AndOps[0].Expr.(*Compare).Right.Value().List
+		assert.Equal(t, tc.set, list.Set != nil, "%s => %s", tc.input, r)
+	}
+}
+
+func TestPartialEvalRegisteredFunctions(t *testing.T) {
+	calls := 0
+	fns := NewFunctions()
+	require.NoError(t, fns.Register("quota", func(plan string) int {
+		calls++
+		return 10
+	}))
+
+	exp, err := Parse(`quota(plan) > 5 and quota("pro") > seats`, WithFunctions(fns))
+	require.NoError(t, err)
+
+	r, err := PartialEval(exp, SymbolsMap{"plan": "pro"})
+	require.NoError(t, err)
+	assert.Equal(t, `quota("pro") > 5 and quota("pro") > seats`, r.String())
+	assert.Equal(t, `quota(plan) > 5 and quota("pro") > seats`, Simplify(exp).String())
+	assert.Zero(t, calls, "a registered function may not be pure, so it is not called ahead of time")
+
+	other := NewFunctions()
+	require.NoError(t, other.Register("quota", func(plan string) int { return 1 }))
+	res, err := EvalExpression(r, SymbolsMap{"seats": 0}, WithFunctions(other))
+	require.NoError(t, err)
+	assert.False(t, res, "the functions given to the evaluation are called")
+}
+
+func TestPartialEvalThreeValued(t *testing.T) {
+	exp, err := Parse(`gone = 1 or x or seats > 1`, WithMissingSymbols(MissingThreeValued))
+	require.NoError(t, err)
+
+	// gone = 1 is unknown whatever x turns out to be, so it stays.
+	r, err := PartialEval(exp, SymbolsMap{"gone": nil, "seats": 0})
+	require.NoError(t, err)
+	assert.Equal(t, `null = 1 or x`, r.String())
+
+	res, err := EvalExpression(r, SymbolsMap{"x": false})
+	require.NoError(t, err)
+	assert.False(t, res)
+}
+
+func TestPartialEvalErrors(t *testing.T) {
+	t.Run("symbol error", func(t *testing.T) {
+		boom := errors.New("boom")
+		exp, err := Parse(`x and plan = "pro"`)
+		require.NoError(t, err)
+
+		_, err = PartialEval(exp, SymbolsMap{"plan": func() (string, error) { return "", boom }})
+		require.ErrorIs(t, err, boom)
+
+		var evalErr *EvalError
+		require.ErrorAs(t, err, &evalErr)
+		assert.Equal(t, 7, evalErr.Start.Column)
+	})
+
+	t.Run("failing comparison is kept", func(t *testing.T) {
+		exp, err := Parse(`x or seats contains 1`)
+		require.NoError(t, err)
+
+		r, err := PartialEval(exp, SymbolsMap{"seats": 10})
+		require.NoError(t, err)
+
+		_, err = EvalExpression(r, SymbolsMap{"x": false})
+		require.ErrorIs(t, err, ErrorWrongDataType)
+
+		var evalErr *EvalError
+		require.ErrorAs(t, err, &evalErr)
+		assert.Equal(t, 6, evalErr.Start.Column, "positions refer to the original source")
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		_, err := PartialEval(Expression{}, SymbolsMap{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,162 @@
+package boolexpr
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// getSymbol returns the value of the symbol operand v: its root symbol from
+// syms, followed along its path when it has one. A missing symbol is nil when
+// the evaluation's [MissingSymbols] allows it.
+func getSymbol(v *Value, syms Symbols) (any, error) {
+	val, err := lookupSymbol(v, syms)
+	if err != nil {
+		return nil, missingSymbol(syms, err)
+	}
+
+	return val, nil
+}
+
+// lookupSymbol returns the value of the symbol operand v, or an error
+// wrapping [ErrSymbolNotFound] when it is missing.
+func lookupSymbol(v *Value, syms Symbols) (any, error) {
+	val, err := syms.Get(*v.Symbol)
+	if err != nil || len(v.Path) == 0 {
+		return val, err
+	}
+
+	return walkPath(evalContext(syms), v, val)
+}
+
+// walkPath follows the path of the symbol operand v from root, the value of
+// its root symbol. Each step reads a key of a map[string]any, an element of a
+// slice or array, or, through reflection, a key of any map with string keys
+// or a field or method of a struct, named as by [StructSymbols]. Functions
+// met on the way are resolved like symbol values, under ctx.
+func walkPath(ctx context.Context, v *Value, root any) (any, error) {
+	cur := root
+	for i := range v.Path {
+		next, err := pathStep(cur, &v.Path[i])
+		if err != nil {
+			return nil, fmt.Errorf("Symbol: %s, %w", v.Name(), err)
+		}
+
+		if cur, err = resolveSymbol(ctx, next); err != nil {
+			return nil, fmt.Errorf("Symbol: %s, %w", v.Name(), err)
+		}
+	}
+
+	return cur, nil
+}
+
+func pathStep(cur any, e *PathElem) (any, error) {
+	switch c := cur.(type) {
+	case map[string]any:
+		if key, ok := pathKey(e); ok {
+			val, ok := c[key]
+			if !ok {
+				return nil, fmt.Errorf("%w, no key %q", ErrSymbolNotFound, key)
+			}
+
+			return val, nil
+		}
+	case []any:
+		if e.Index != nil {
+			if *e.Index >= len(c) {
+				return nil, indexError(*e.Index, len(c))
+			}
+
+			return c[*e.Index], nil
+		}
+	case nil:
+		return nil, fmt.Errorf("%w, value is nil", ErrSymbolNotFound)
+	}
+
+	rv := reflect.ValueOf(cur)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%w, value is nil", ErrSymbolNotFound)
+		}
+
+		if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Struct {
+			return structStep(rv, e)
+		}
+
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		key, ok := pathKey(e)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		val := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !val.IsValid() {
+			return nil, fmt.Errorf("%w, no key %q", ErrSymbolNotFound, key)
+		}
+
+		return structValue(val)
+	case reflect.Slice, reflect.Array:
+		if e.Index == nil {
+			break
+		}
+
+		if *e.Index >= rv.Len() {
+			return nil, indexError(*e.Index, rv.Len())
+		}
+
+		return structValue(rv.Index(*e.Index))
+	case reflect.Struct:
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return structStep(ptr, e)
+	}
+
+	if e.Index != nil {
+		return nil, fmt.Errorf("%w, can't index %T", ErrorWrongDataType, cur)
+	}
+
+	return nil, fmt.Errorf("%w, %T has no keys or fields", ErrorWrongDataType, cur)
+}
+
+// structStep reads the field or method named by e from ptr, a pointer to a
+// struct.
+func structStep(ptr reflect.Value, e *PathElem) (any, error) {
+	key, ok := pathKey(e)
+	if !ok {
+		return nil, fmt.Errorf("%w, can't index %s", ErrorWrongDataType, ptr.Type())
+	}
+
+	f, ok := structTypeOf(ptr.Type()).symbols[key]
+	if !ok {
+		return nil, fmt.Errorf("%w, %s has no field %q", ErrSymbolNotFound, ptr.Type(), key)
+	}
+
+	val, err := f.get(ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	return structValue(val)
+}
+
+// pathKey returns the key e names, and false when e is an index.
+func pathKey(e *PathElem) (string, bool) {
+	switch {
+	case e.Field != nil:
+		return *e.Field, true
+	case e.Key != nil:
+		return *e.Key, true
+	default:
+		return "", false
+	}
+}
+
+func indexError(i, n int) error {
+	return fmt.Errorf("%w, index %d out of range with length %d", ErrSymbolNotFound, i, n)
+}
@@ -0,0 +1,266 @@
+package boolexpr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// patternCache memoizes the regular expressions compiled from patterns, up to
+// patternCacheMax of them, so a pattern held in a symbol is compiled once and
+// patterns from high-cardinality values don't grow it without bound.
+type patternCache struct {
+	m   sync.Map // map[string]*regexp.Regexp
+	len atomic.Int64
+}
+
+const patternCacheMax = 1024
+
+// get returns the regular expression of pattern, compiling it with compile
+// when it is not cached yet. Errors are not cached.
+func (c *patternCache) get(pattern string, compile func(string) (*regexp.Regexp, error)) (*regexp.Regexp, error) {
+	if re, ok := c.m.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.len.Load() < patternCacheMax {
+		if _, loaded := c.m.LoadOrStore(pattern, re); !loaded {
+			c.len.Add(1)
+		}
+	}
+	return re, nil
+}
+
+// The caches of the patterns held in symbols, one per operator, since each
+// reads a pattern its own way. Literal patterns are compiled once when
+// parsing, and don't go through them.
+var (
+	matchCache  patternCache
+	imatchCache patternCache
+	likeCache   patternCache
+	globCache   patternCache
+)
+
+// matchEval reports whether the left string matches the regular expression in
+// the right operand. Both operands must be strings; the pattern uses Go's
+// regexp (RE2) syntax. The match is unanchored, like [regexp.Regexp.MatchString].
+func matchEval(l, r evalVal) (bool, error) {
+	return patternEval(ComparisonOp{Match: true}, l, r)
+}
+
+// imatchEval is matchEval with the pattern matched case-insensitively, as
+// with the (?i) flag.
+func imatchEval(l, r evalVal) (bool, error) {
+	return patternEval(ComparisonOp{IMatch: true}, l, r)
+}
+
+// likeEval reports whether the left string matches the SQL LIKE pattern in
+// the right operand, as a whole: "%" matches any run of characters, "_" a
+// single one, and "\" makes the character after it literal.
+func likeEval(l, r evalVal) (bool, error) {
+	return patternEval(ComparisonOp{Like: true}, l, r)
+}
+
+// globEval reports whether the left string matches the shell glob in the
+// right operand, as a whole: "*" matches any run of characters, "?" a single
+// one, "[a-z]" one in the set and "[!a-z]" or "[^a-z]" one outside it, and
+// "\" makes the character after it literal.
+func globEval(l, r evalVal) (bool, error) {
+	return patternEval(ComparisonOp{Glob: true}, l, r)
+}
+
+// patternEval matches l against the pattern r of o, which is compiled once
+// per distinct pattern and cached.
+func patternEval(o ComparisonOp, l, r evalVal) (bool, error) {
+	lv, rv, err := stringOperands(opName(o), l, r)
+	if err != nil {
+		return false, err
+	}
+
+	re, err := cachedRegexp(o, rv)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(lv), nil
+}
+
+// literalPatternEval matches l against re, the literal pattern of o compiled
+// when parsing.
+func literalPatternEval(o ComparisonOp, re *regexp.Regexp, l evalVal) (bool, error) {
+	s, ok := l.toString()
+	if !ok {
+		return false, newErrorWrongDataType(opName(o), l.toAny())
+	}
+
+	return re.MatchString(s), nil
+}
+
+// cachedRegexp returns the regular expression of the pattern of o, one of
+// match, imatch, like and glob, from the cache of o.
+func cachedRegexp(o ComparisonOp, pattern string) (*regexp.Regexp, error) {
+	c := &matchCache
+	switch {
+	case o.IMatch:
+		c = &imatchCache
+	case o.Like:
+		c = &likeCache
+	case o.Glob:
+		c = &globCache
+	}
+
+	return c.get(pattern, func(pattern string) (*regexp.Regexp, error) {
+		return compileRegexp(o, pattern)
+	})
+}
+
+// compileRegexp compiles the pattern of o into a regular expression.
+func compileRegexp(o ComparisonOp, pattern string) (*regexp.Regexp, error) {
+	var (
+		src = pattern
+		err error
+	)
+	switch {
+	case o.IMatch:
+		src = "(?i)" + pattern
+	case o.Like:
+		src, err = wildcardSource(pattern, '%', '_', false)
+	case o.Glob:
+		src, err = wildcardSource(pattern, '*', '?', true)
+	}
+
+	var re *regexp.Regexp
+	if err == nil {
+		re, err = regexp.Compile(src)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w, invalid %s pattern %q: %v", ErrorWrongDataType, opName(o), pattern, err)
+	}
+
+	return re, nil
+}
+
+var (
+	errTrailingEscape = errors.New(`trailing \`)
+	errUnclosedClass  = errors.New("missing closing ]")
+)
+
+// wildcardSource translates a pattern with the wildcards many, matching any
+// run of characters, and one, matching a single character, into an anchored
+// regular expression. Character classes in brackets are read when classes is
+// set.
+func wildcardSource(pattern string, many, one rune, classes bool) (string, error) {
+	var sb strings.Builder
+	sb.WriteString(`(?s)\A`)
+	for i := 0; i < len(pattern); {
+		c, n := utf8.DecodeRuneInString(pattern[i:])
+		i += n
+		switch {
+		case c == '\\':
+			if i == len(pattern) {
+				return "", errTrailingEscape
+			}
+
+			c, n = utf8.DecodeRuneInString(pattern[i:])
+			i += n
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		case c == many:
+			sb.WriteString(".*")
+		case c == one:
+			sb.WriteByte('.')
+		case c == '[' && classes:
+			n, err := writeClass(&sb, pattern[i:])
+			if err != nil {
+				return "", err
+			}
+			i += n
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString(`\z`)
+
+	return sb.String(), nil
+}
+
+// writeClass writes the character class of a glob whose opening "[" precedes
+// s, and returns the length of the rest of it in s, up to and including its
+// "]". A "]" right after the opening "[", or "[!", is a member.
+func writeClass(sb *strings.Builder, s string) (int, error) {
+	i := 0
+	sb.WriteByte('[')
+	if strings.HasPrefix(s, "!") || strings.HasPrefix(s, "^") {
+		sb.WriteByte('^')
+		i++
+	}
+
+	// next reads the member at i, unescaping it.
+	next := func() (rune, error) {
+		c, n := utf8.DecodeRuneInString(s[i:])
+		i += n
+		if c != '\\' {
+			return c, nil
+		}
+
+		if i == len(s) {
+			return 0, errTrailingEscape
+		}
+
+		c, n = utf8.DecodeRuneInString(s[i:])
+		i += n
+		return c, nil
+	}
+
+	for first := true; ; first = false {
+		if i == len(s) {
+			return 0, errUnclosedClass
+		}
+
+		if s[i] == ']' && !first {
+			sb.WriteByte(']')
+			return i + 1, nil
+		}
+
+		lo, err := next()
+		if err != nil {
+			return 0, err
+		}
+
+		hi := lo
+		if strings.HasPrefix(s[i:], "-") && i+1 < len(s) && s[i+1] != ']' {
+			i++
+			if hi, err = next(); err != nil {
+				return 0, err
+			}
+
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %c-%c", lo, hi)
+			}
+		}
+
+		writeClassRune(sb, lo)
+		if hi != lo {
+			sb.WriteByte('-')
+			writeClassRune(sb, hi)
+		}
+	}
+}
+
+func writeClassRune(sb *strings.Builder, c rune) {
+	if strings.ContainsRune(`\]^-[`, c) {
+		sb.WriteByte('\\')
+	}
+	sb.WriteRune(c)
+}
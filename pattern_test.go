@@ -0,0 +1,182 @@
+package boolexpr
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLikeGlob(t *testing.T) {
+	tcs := []struct {
+		s, op, pattern string
+		expected       bool
+	}{
+		{"hello", "like", "hello", true},
+		{"hello", "like", "hell", false},
+		{"hello", "like", "h%", true},
+		{"hello", "like", "%LL%", false},
+		{"hello", "like", "%ll%", true},
+		{"hello", "like", "h_llo", true},
+		{"hello", "like", "h_lo", false},
+		{"héllo", "like", "h_llo", true},
+		{"a\nb", "like", "a%b", true},
+		{"50%", "like", `50\%`, true},
+		{"500", "like", `50\%`, false},
+		{"a_b", "like", `a\_b`, true},
+		{"axb", "like", `a\_b`, false},
+		{"a.b", "like", "a.b", true},
+		{"axb", "like", "a.b", false},
+		{"(x)*", "like", "(x)*", true},
+		{"", "like", "%", true},
+		{"", "like", "_", false},
+
+		{"report.pdf", "glob", "*.pdf", true},
+		{"report.pdf", "glob", "*.PDF", false},
+		{"a/b.pdf", "glob", "*.pdf", true},
+		{"file1.txt", "glob", "file?.txt", true},
+		{"file10.txt", "glob", "file?.txt", false},
+		{"file1.txt", "glob", "file[0-9].txt", true},
+		{"filex.txt", "glob", "file[0-9].txt", false},
+		{"filex.txt", "glob", "file[!0-9].txt", true},
+		{"filex.txt", "glob", "file[^0-9].txt", true},
+		{"file1.txt", "glob", "file[!0-9].txt", false},
+		{"b", "glob", "[abc]", true},
+		{"]", "glob", "[]a]", true},
+		{"-", "glob", "[a-]", true},
+		{"^", "glob", `[\^]`, true},
+		{"*", "glob", `\*`, true},
+		{"x", "glob", `\*`, false},
+		{"%_", "glob", "%_", true},
+		{"a+b", "glob", "a+b", true},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		input := fmt.Sprintf("s %s %q", tc.op, tc.pattern)
+		t.Run(input+" "+tc.s, func(t *testing.T) {
+			syms := SymbolsMap{"s": tc.s, "p": tc.pattern}
+			exp, err := Parse(input)
+			require.NoError(t, err)
+
+			res, err := EvalExpression(exp, syms)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+
+			// A pattern held in a symbol matches the same.
+			exp, err = Parse("s " + tc.op + " p")
+			require.NoError(t, err)
+
+			res, err = EvalExpression(exp, syms)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res, "symbol pattern")
+		})
+	}
+}
+
+func TestLikeGlobErrors(t *testing.T) {
+	tcs := []struct {
+		input string
+		msg   string
+	}{
+		{`s like "50\\"`, `1:8: Wrong data type, invalid like pattern "50\\": trailing \`},
+		{`s glob "[a-"`, `1:8: Wrong data type, invalid glob pattern "[a-": missing closing ]`},
+		{`s glob "[z-a]"`, `1:8: Wrong data type, invalid glob pattern "[z-a]": invalid range z-a`},
+		{`x = 1 or s glob "file[0-9"`, `1:17: Wrong data type, invalid glob pattern "file[0-9": missing closing ]`},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			assert.ErrorIs(t, err, ErrorWrongDataType)
+			assert.EqualError(t, err, tc.msg)
+		})
+	}
+
+	// A pattern held in a symbol fails once evaluated.
+	exp, err := Parse(`s glob p`)
+	require.NoError(t, err)
+
+	_, err = EvalExpression(exp, SymbolsMap{"s": "a", "p": "[a"})
+	assert.ErrorIs(t, err, ErrorWrongDataType)
+
+	_, err = EvalExpression(exp, SymbolsMap{"s": 1, "p": "a"})
+	assert.ErrorIs(t, err, ErrorWrongDataType)
+}
+
+func TestPatternCache(t *testing.T) {
+	var c patternCache
+	for i := range patternCacheMax + 10 {
+		_, err := c.get(fmt.Sprint(i), regexp.Compile)
+		require.NoError(t, err)
+	}
+
+	assert.EqualValues(t, patternCacheMax, c.len.Load())
+
+	a, err := c.get("0", regexp.Compile)
+	require.NoError(t, err)
+	b, err := c.get("0", regexp.Compile)
+	require.NoError(t, err)
+	assert.Same(t, a, b)
+}
+
+func TestLiteralPatterns(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Parse(`x = 1 or s match "a(b"`)
+		assert.ErrorIs(t, err, ErrorWrongDataType)
+		assert.EqualError(t, err, "1:18: Wrong data type, invalid match pattern \"a(b\": error parsing regexp: missing closing ): `a(b`")
+
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, `"a(b"`, perr.Got)
+
+		_, err = Parse(`s imatch "["`)
+		assert.ErrorIs(t, err, ErrorWrongDataType)
+	})
+
+	t.Run("compiled when parsing", func(t *testing.T) {
+		for _, input := range []string{`s match "^lit-[0-9]+$"`, `s imatch "^LIT-"`, `s like "lit-%"`, `s glob "lit-*"`} {
+			exp, err := Parse(input)
+			require.NoError(t, err)
+			assert.NotNil(t, exp.e.And.Expr.(*Compare).Pattern, input)
+
+			p, err := Compile(exp)
+			require.NoError(t, err)
+
+			caches := []*patternCache{&matchCache, &imatchCache, &likeCache, &globCache}
+			var before []int64
+			for _, c := range caches {
+				before = append(before, c.len.Load())
+			}
+
+			res, err := EvalExpression(exp, SymbolsMap{"s": "lit-42"})
+			require.NoError(t, err)
+			assert.True(t, res, input)
+
+			res, err = p.Eval(SymbolsMap{"s": "lit-42"})
+			require.NoError(t, err)
+			assert.True(t, res, input)
+
+			for i, c := range caches {
+				assert.Equal(t, before[i], c.len.Load(), "%s doesn't use the cache", input)
+			}
+		}
+	})
+
+	t.Run("from symbols", func(t *testing.T) {
+		exp, err := Parse(`s match p`)
+		require.NoError(t, err)
+		assert.Nil(t, exp.e.And.Expr.(*Compare).Pattern)
+
+		res, err := EvalExpression(exp, SymbolsMap{"s": "abc", "p": "^a"})
+		require.NoError(t, err)
+		assert.True(t, res)
+
+		_, err = EvalExpression(exp, SymbolsMap{"s": "abc", "p": "a(b"})
+		assert.ErrorIs(t, err, ErrorWrongDataType)
+	})
+}
@@ -0,0 +1,199 @@
+package boolexpr
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// Prefetch chooses which symbols an evaluation looks up ahead of evaluating
+// them, together. It is given with [WithPrefetch].
+type Prefetch uint8
+
+const (
+	// PrefetchNone looks each symbol up when evaluation reaches it, so
+	// short-circuiting skips the lookups it doesn't need. It is the default.
+	PrefetchNone Prefetch = iota
+	// PrefetchAll looks up every symbol the expression references, as listed
+	// by [ListSymbols], including those short-circuiting would skip.
+	PrefetchAll
+	// PrefetchFirstBranch looks up the symbols of the first operand of each
+	// "or", the branch evaluated whatever the others hold, speculating that
+	// it decides the result. The symbols of the other branches are looked up
+	// when evaluation reaches them.
+	PrefetchFirstBranch
+	// PrefetchAndLevel looks up the symbols of the operands of each "and"
+	// as evaluation reaches it, short of those in parentheses, which are
+	// looked up as evaluation reaches their own "and"s. The branches of an
+	// "or" short-circuiting skips are never looked up.
+	PrefetchAndLevel
+)
+
+// WithPrefetch makes [EvalExpression] and [EvalExpressionContext] look the
+// symbols chosen by mode up concurrently, at most limit at a time, or all at
+// once when limit is less than 1, before evaluating. A slow source, such as a
+// remote one, so costs one round-trip rather than one per symbol. The symbols
+// of a [BatchSymbols] are looked up in a single call to GetMany instead, or
+// GetManyContext for a [BatchContextSymbols].
+//
+// The values are cached for the evaluation in the [CachedMap] or
+// [CachedSymbols] evaluated against, or in a CachedSymbols wrapping the
+// Symbols otherwise, and each symbol is looked up once. The result and errors
+// are those of the lazy evaluation: the error of a lookup is only returned
+// once evaluation reaches its symbol, and only the symbols it reaches are
+// reported by Used. Parse ignores it.
+func WithPrefetch(mode Prefetch, limit int) Option {
+	return func(o *options) {
+		o.prefetch = mode
+		o.prefetchLimit = limit
+	}
+}
+
+// prefetch looks up the symbols of b chosen by the options syms carries under
+// ctx, and returns syms with them cached. It returns syms itself when they
+// choose none.
+func prefetch(ctx context.Context, b *BoolExpr, syms Symbols) Symbols {
+	s, ok := syms.(optionSymbols)
+	if !ok || s.opts.prefetch == PrefetchNone {
+		return syms
+	}
+
+	switch c := s.Symbols.(type) {
+	case *CachedMap, *CachedSymbols:
+	default:
+		s.Symbols = NewCachedSymbols(c)
+	}
+
+	switch s.opts.prefetch {
+	case PrefetchAll:
+		fetchSymbols(ctx, s, listSymbols(b, rootName))
+	case PrefetchFirstBranch:
+		fetchSymbols(ctx, s, firstBranchSymbols(b))
+	}
+
+	// Under PrefetchAndLevel, each "and" is looked up as evaluation reaches
+	// it, by prefetchLevel.
+	return s
+}
+
+// prefetchLevel looks up the symbols of the operands of a, short of those of
+// its parenthesized expressions, when syms carries [PrefetchAndLevel].
+func prefetchLevel(a *AndExpr, syms Symbols) {
+	s, ok := syms.(optionSymbols)
+	if !ok || s.opts.prefetch != PrefetchAndLevel {
+		return
+	}
+
+	var (
+		names []string
+		seen  = map[string]bool{}
+	)
+	add := func(x Expr) {
+		for {
+			n, ok := x.(*NotExpr)
+			if !ok {
+				break
+			}
+			x = n.Expr
+		}
+
+		if _, ok := x.(*SubExpr); ok {
+			return
+		}
+
+		for _, name := range listSymbols(x, rootName) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	add(a.Expr)
+	for _, op := range a.AndOps {
+		add(op.Expr)
+	}
+
+	fetchSymbols(evalContext(syms), s, names)
+}
+
+// symbolCache is a [CachedMap] or [CachedSymbols], which symbols are looked
+// up into ahead of evaluation without being marked as used.
+type symbolCache interface {
+	fetch(ctx context.Context, key string)
+}
+
+// fetchSymbols looks names up under ctx in the cache s holds: in a single
+// call to GetMany when it is a [CachedSymbols] of a [BatchSymbols], and
+// concurrently, as many at a time as the options of s allow, otherwise. The
+// values and errors are cached, and returned once evaluation reaches their
+// symbols.
+func fetchSymbols(ctx context.Context, s optionSymbols, names []string) {
+	if c, ok := s.Symbols.(*CachedSymbols); ok {
+		if _, ok := c.underlying.(BatchSymbols); ok {
+			_, _ = c.getMany(ctx, names, false)
+			return
+		}
+	}
+
+	cache := s.Symbols.(symbolCache)
+	limit := s.opts.prefetchLimit
+	if limit < 1 || limit > len(names) {
+		limit = len(names)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			cache.fetch(ctx, name)
+		}()
+	}
+	wg.Wait()
+}
+
+// firstBranchSymbols returns the unique names of the root symbols of b on the
+// first operand of each "or" reached from its root, as by [ListSymbols].
+func firstBranchSymbols(b *BoolExpr) []string {
+	var (
+		names []string
+		seen  = map[string]bool{}
+		walk  func(x Expr)
+	)
+
+	walk = func(x Expr) {
+		switch e := x.(type) {
+		case *SubExpr:
+			walk(&e.BoolExpr)
+		case *BoolExpr:
+			walk(e.And.Expr)
+			for _, op := range e.And.AndOps {
+				walk(op.Expr)
+			}
+		case *NotExpr:
+			walk(e.Expr)
+		default:
+			for _, name := range listSymbols(e, rootName) {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	walk(b)
+
+	return names
+}
@@ -0,0 +1,219 @@
+package boolexpr
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetch(t *testing.T) {
+	modes := []Prefetch{PrefetchNone, PrefetchAll, PrefetchFirstBranch, PrefetchAndLevel}
+
+	t.Run("results", func(t *testing.T) {
+		for _, tc := range evalTests {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err, tc.input)
+
+			for _, m := range modes {
+				res, err := EvalExpression(exp, tc.symbols, WithPrefetch(m, 2))
+				require.NoError(t, err, "%s/%d", tc.input, m)
+				assert.Equal(t, tc.expected, res, "%s/%d", tc.input, m)
+			}
+		}
+	})
+
+	t.Run("symbols looked up", func(t *testing.T) {
+		tcs := []struct {
+			input    string
+			expected [4][]string
+		}{
+			{`a = 0 and b = 1`, [4][]string{{"a"}, {"a", "b"}, {"a", "b"}, {"a", "b"}}},
+			{`a = 0 or b = 1`, [4][]string{{"a", "b"}, {"a", "b"}, {"a", "b"}, {"a", "b"}}},
+			{`a = 1 or b = 1`, [4][]string{{"a"}, {"a", "b"}, {"a"}, {"a"}}},
+			{`a = 0 and (b = 1 or c = 1) or d = 1`, [4][]string{{"a", "d"}, {"a", "b", "c", "d"}, {"a", "b", "d"}, {"a", "d"}}},
+			{`a = 1 and (b = 1 or c = 1) or d = 1`, [4][]string{{"a", "b"}, {"a", "b", "c", "d"}, {"a", "b"}, {"a", "b"}}},
+			{`not (b = 1 or c = 1) or d = 1`, [4][]string{{"b", "d"}, {"b", "c", "d"}, {"b", "d"}, {"b", "d"}}},
+			{`a + b = 2 or d = 1`, [4][]string{{"a", "b"}, {"a", "b", "d"}, {"a", "b"}, {"a", "b"}}},
+		}
+
+		for _, tc := range tcs {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+
+			for i, m := range modes {
+				var (
+					mu     sync.Mutex
+					called []string
+				)
+				value := func(name string) func() int {
+					return func() int {
+						mu.Lock()
+						defer mu.Unlock()
+						called = append(called, name)
+						return 1
+					}
+				}
+				syms := SymbolsMap{"a": value("a"), "b": value("b"), "c": value("c"), "d": value("d")}
+
+				_, err := EvalExpression(exp, syms, WithPrefetch(m, 0))
+				require.NoError(t, err)
+
+				sort.Strings(called)
+				assert.Equal(t, tc.expected[i], called, "%s/%d", tc.input, m)
+			}
+		}
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		exp, err := Parse(`a = 1 and b = 1 and c = 1 and d = 1 and e = 1`)
+		require.NoError(t, err)
+
+		var inFlight, most atomic.Int32
+		value := func() int {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			return 1
+		}
+		syms := SymbolsMap{"a": value, "b": value, "c": value, "d": value, "e": value}
+
+		res, err := EvalExpression(exp, syms, WithPrefetch(PrefetchAll, 2))
+		require.NoError(t, err)
+		assert.True(t, res)
+		assert.EqualValues(t, 2, most.Load())
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		exp, err := Parse(`a = 1 and b = 1 and c = 1`)
+		require.NoError(t, err)
+
+		// Each lookup waits for all three to start.
+		var wg sync.WaitGroup
+		wg.Add(3)
+		value := func(ctx context.Context) (int, error) {
+			wg.Done()
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+				return 1, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+		syms := SymbolsMap{"a": value, "b": value, "c": value}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		res, err := EvalExpressionContext(ctx, exp, syms, WithPrefetch(PrefetchAll, 0))
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+
+	t.Run("errors once reached", func(t *testing.T) {
+		fail := errors.New("fail")
+		syms := SymbolsMap{
+			"a": 1,
+			"b": func() (int, error) { return 0, fail },
+		}
+
+		res, err := Eval(`a = 1 or b = 1`, syms, WithPrefetch(PrefetchAll, 0))
+		require.NoError(t, err)
+		assert.True(t, res)
+
+		_, err = Eval(`a = 0 or b = 1`, syms, WithPrefetch(PrefetchAll, 0))
+		assert.ErrorIs(t, err, fail)
+
+		_, err = Eval(`a = 1 and c = 1`, syms, WithPrefetch(PrefetchAll, 0))
+		assert.ErrorIs(t, err, ErrSymbolNotFound)
+
+		res, err = Eval(`c = 1`, syms, WithPrefetch(PrefetchAll, 0), WithMissingSymbols(MissingNull))
+		require.NoError(t, err)
+		assert.False(t, res)
+	})
+
+	t.Run("cached symbols", func(t *testing.T) {
+		calls := 0
+		s := NewCachedMap(map[string]any{
+			"a": 1,
+			"b": func() int {
+				calls++
+				return 1
+			},
+		})
+
+		res, err := Eval(`a = 1 or b = 1`, s, WithPrefetch(PrefetchAll, 0))
+		require.NoError(t, err)
+		assert.True(t, res)
+		assert.Equal(t, map[string]any{"a": 1}, s.Used())
+
+		res, err = Eval(`b = 1`, s, WithPrefetch(PrefetchAll, 0))
+		require.NoError(t, err)
+		assert.True(t, res)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, map[string]any{"a": 1, "b": 1}, s.Used())
+	})
+
+	t.Run("used symbols of batch symbols", func(t *testing.T) {
+		s := NewCachedSymbols(&batchSymbols{data: map[string]any{"a": 1, "b": 1}})
+
+		res, err := Eval(`a = 1 or b = 1`, s, WithPrefetch(PrefetchAll, 0))
+		require.NoError(t, err)
+		assert.True(t, res)
+		assert.Equal(t, map[string]any{"a": 1}, s.Used())
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		exp, err := Parse(`a = 1`)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err = EvalExpressionContext(ctx, exp, SymbolsMap{"a": func() int {
+			cancel()
+			return 1
+		}}, WithPrefetch(PrefetchAll, 0))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("batch symbols", func(t *testing.T) {
+		exp, err := Parse(`a = 1 and not b = 0 and (c = 1 or d = 1) or e = 1`)
+		require.NoError(t, err)
+
+		tcs := []struct {
+			mode     Prefetch
+			expected [][]string
+		}{
+			{PrefetchAll, [][]string{{"a", "b", "c", "d", "e"}}},
+			{PrefetchFirstBranch, [][]string{{"a", "b", "c"}}},
+			{PrefetchAndLevel, [][]string{{"a", "b"}, {"c"}}},
+		}
+
+		for _, tc := range tcs {
+			syms := &batchSymbols{data: map[string]any{"a": 1, "b": 1, "c": 1, "d": 1, "e": 1}}
+
+			res, err := EvalExpression(exp, syms, WithPrefetch(tc.mode, 0))
+			require.NoError(t, err)
+			assert.True(t, res)
+
+			for _, batch := range syms.batches {
+				sort.Strings(batch)
+			}
+			assert.Equal(t, tc.expected, syms.batches, "%d", tc.mode)
+		}
+	})
+}
@@ -0,0 +1,413 @@
+package boolexpr
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// Simplify returns e simplified:
+//
+//   - comparisons, bare values and null tests of literals alone are folded
+//     into their result, and "and", "or" and "not" around it, as by
+//     [PartialEval] with no symbol known: "x = 1 or 2 > 1" is "true";
+//   - nested parentheses and chains are flattened: "a and (b and (c))" is
+//     "a and b and c", and "not not a" is "a";
+//   - duplicate operands of "and" and "or" are dropped: "a = 1 and a = 1" is
+//     "a = 1", as is "(a or b) and (b or a)" "a or b";
+//   - absorbed operands are dropped: "a or (a and b)" is "a", and
+//     "a and (a or b)" is "a".
+//
+// Operands are otherwise kept in their order. Each rule holds under
+// [MissingThreeValued] as well, so the result is that of e whenever none of
+// the operands fails; when some do, dropping or folding them may decide the
+// result without them, or return another error. The zero value is returned as
+// is.
+func Simplify(e Expression) Expression {
+	if e.e == nil {
+		return e
+	}
+
+	t, err := simplified(e)
+	if err != nil {
+		return e
+	}
+
+	return Expression{e: t.boolExpr(), missing: e.missing}
+}
+
+// ToDNF returns e in disjunctive normal form, simplified as by [Simplify]: an
+// "or" of "and"s of comparisons, bare values, null tests and their negations,
+// such as "a and b or a and not c". It fails with [ErrTooLarge] when the
+// result would hold more than limit of them, as it can grow exponentially
+// with e; a limit less than 1 sets no limit.
+func ToDNF(e Expression, limit int) (Expression, error) {
+	return normalForm(e, termOr, limit)
+}
+
+// ToCNF returns e in conjunctive normal form, simplified as by [Simplify]: an
+// "and" of "or"s of comparisons, bare values, null tests and their
+// negations, such as "(a or b) and (a or not c)". It fails with
+// [ErrTooLarge] when the result would hold more than limit of them, as it can
+// grow exponentially with e; a limit less than 1 sets no limit.
+func ToCNF(e Expression, limit int) (Expression, error) {
+	return normalForm(e, termAnd, limit)
+}
+
+// simplified returns the term of e, its constants folded.
+func simplified(e Expression) (term, error) {
+	p := partial{known: SymbolsMap{}, values: map[string]any{}, missing: e.missing}
+	r, err := p.boolExpr(e.e)
+	if err != nil {
+		return term{}, err
+	}
+
+	return boolExprTerm(r.boolExpr()), nil
+}
+
+func normalForm(e Expression, outer termKind, limit int) (Expression, error) {
+	name := "DNF"
+	if outer == termAnd {
+		name = "CNF"
+	}
+
+	if e.e == nil {
+		return Expression{}, fmt.Errorf("To%s called on zero-value Expression; use Parse to obtain a valid Expression", name)
+	}
+
+	t, err := simplified(e)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	clauses, err := t.negationNormal(false).clauses(outer, limit)
+	if err != nil {
+		return Expression{}, fmt.Errorf("%w, %s of more than %d operands", err, name, limit)
+	}
+
+	inner := termAnd
+	if outer == termAnd {
+		inner = termOr
+	}
+
+	ts := make([]term, len(clauses))
+	for i, c := range clauses {
+		ts[i] = newTerm(inner, c)
+	}
+
+	return Expression{e: newTerm(outer, ts).boolExpr(), missing: e.missing}, nil
+}
+
+type termKind uint8
+
+const (
+	termLeaf termKind = iota
+	termNot
+	termAnd
+	termOr
+)
+
+// term is an expression as a tree of "not", and of "and" and "or" of any
+// number of operands, which simplification and normal forms work on.
+type term struct {
+	kind termKind
+	// leaf is the comparison, bare value or null test of a termLeaf.
+	leaf Expr
+	// args are the operand of a termNot, or those of a termAnd or termOr.
+	args []term
+	// key is the same for equal terms, the operands of "and" and "or" taken
+	// in any order.
+	key string
+}
+
+// leafTerm returns the term of a comparison, bare value or null test x. "=="
+// is keyed as "=", which it is the same as.
+func leafTerm(x Expr) term {
+	key := x
+	if c, ok := x.(*Compare); ok && c.Op.EqEq {
+		eq := *c
+		eq.Op.EqEq, eq.Op.Eq = false, true
+		key = &eq
+	}
+
+	return term{kind: termLeaf, leaf: x, key: exprText(key)}
+}
+
+// notTerm returns the negation of t, dropping a double one.
+func notTerm(t term) term {
+	if t.kind == termNot {
+		return t.args[0]
+	}
+
+	return term{kind: termNot, args: []term{t}, key: "not " + strconv.Quote(t.key)}
+}
+
+// newTerm returns the "and" or "or", as kind tells, of args: operands of the
+// same kind are flattened into it, and duplicate and absorbed ones dropped. A
+// single operand is returned as is.
+func newTerm(kind termKind, args []term) term {
+	var flat []term
+	seen := map[string]bool{}
+	for _, a := range args {
+		ops := []term{a}
+		if a.kind == kind {
+			ops = a.args
+		}
+
+		for _, op := range ops {
+			if !seen[op.key] {
+				seen[op.key] = true
+				flat = append(flat, op)
+			}
+		}
+	}
+
+	flat = absorb(kind, flat)
+	if len(flat) == 1 {
+		return flat[0]
+	}
+
+	keys := make([]string, len(flat))
+	for i, a := range flat {
+		keys[i] = strconv.Quote(a.key)
+	}
+	slices.Sort(keys)
+
+	prefix := "and "
+	if kind == termOr {
+		prefix = "or "
+	}
+
+	return term{kind: kind, args: flat, key: prefix + strings.Join(keys, " ")}
+}
+
+// absorb drops the operands of an "and" or "or" of kind absorbed by another:
+// in "a or (a and b)", "a and b" is, as "a" implies it, and in "a and (a or
+// b)", "a or b" is, as it is implied by "a". args hold no duplicates.
+func absorb(kind termKind, args []term) []term {
+	// parts returns the keys of the operands of t when it is an operand of
+	// the other kind, or that of t itself otherwise.
+	parts := func(t term) map[string]bool {
+		if t.kind != kind && (t.kind == termAnd || t.kind == termOr) {
+			m := make(map[string]bool, len(t.args))
+			for _, a := range t.args {
+				m[a.key] = true
+			}
+			return m
+		}
+
+		return map[string]bool{t.key: true}
+	}
+
+	sets := make([]map[string]bool, len(args))
+	for i, a := range args {
+		sets[i] = parts(a)
+	}
+
+	subset := func(a, b map[string]bool) bool {
+		for k := range a {
+			if !b[k] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var kept []term
+	for i, a := range args {
+		absorbed := false
+		for j := range args {
+			if i != j && len(sets[j]) < len(sets[i]) && subset(sets[j], sets[i]) {
+				absorbed = true
+				break
+			}
+		}
+
+		if !absorbed {
+			kept = append(kept, a)
+		}
+	}
+
+	return kept
+}
+
+func boolExprTerm(b *BoolExpr) term {
+	if len(b.OrOps) == 0 {
+		return andExprTerm(&b.And)
+	}
+
+	args := []term{andExprTerm(&b.And)}
+	for i := range b.OrOps {
+		args = append(args, andExprTerm(&b.OrOps[i].And))
+	}
+
+	return newTerm(termOr, args)
+}
+
+func andExprTerm(a *AndExpr) term {
+	if len(a.AndOps) == 0 {
+		return exprTerm(a.Expr)
+	}
+
+	args := []term{exprTerm(a.Expr)}
+	for _, op := range a.AndOps {
+		args = append(args, exprTerm(op.Expr))
+	}
+
+	return newTerm(termAnd, args)
+}
+
+func exprTerm(x Expr) term {
+	switch e := x.(type) {
+	case *SubExpr:
+		return boolExprTerm(&e.BoolExpr)
+	case *NotExpr:
+		return notTerm(exprTerm(e.Expr))
+	default:
+		return leafTerm(x)
+	}
+}
+
+// boolExpr returns the expression of t.
+func (t term) boolExpr() *BoolExpr {
+	if t.kind != termOr {
+		return &BoolExpr{And: t.andExpr()}
+	}
+
+	b := &BoolExpr{And: t.args[0].andExpr()}
+	for _, a := range t.args[1:] {
+		b.OrOps = append(b.OrOps, OrOpExpr{And: a.andExpr()})
+	}
+
+	return b
+}
+
+func (t term) andExpr() AndExpr {
+	if t.kind != termAnd {
+		return AndExpr{Expr: t.expr()}
+	}
+
+	a := AndExpr{Expr: t.args[0].expr()}
+	for _, op := range t.args[1:] {
+		a.AndOps = append(a.AndOps, AndOpExpr{Expr: op.expr()})
+	}
+
+	return a
+}
+
+func (t term) expr() Expr {
+	switch t.kind {
+	case termLeaf:
+		return t.leaf
+	case termNot:
+		return &NotExpr{Expr: t.args[0].expr()}
+	default:
+		return &SubExpr{BoolExpr: *t.boolExpr()}
+	}
+}
+
+// negationNormal returns t, negated when neg is set, with "not" pushed down
+// to the comparisons, bare values and null tests by De Morgan's laws, which
+// hold under [MissingThreeValued] too.
+func (t term) negationNormal(neg bool) term {
+	switch t.kind {
+	case termNot:
+		return t.args[0].negationNormal(!neg)
+	case termAnd, termOr:
+		kind := t.kind
+		if neg {
+			kind = termAnd + termOr - kind
+		}
+
+		args := make([]term, len(t.args))
+		for i, a := range t.args {
+			args[i] = a.negationNormal(neg)
+		}
+
+		return newTerm(kind, args)
+	default:
+		if neg {
+			return notTerm(t)
+		}
+
+		return t
+	}
+}
+
+// clauses returns the clauses of t, in negation normal form, whose "or",
+// when outer is termOr, or "and" otherwise, is its normal form; a clause
+// holds the operands of an "and", or "or". It fails with [ErrTooLarge] once
+// they hold more than limit operands, unless limit is less than 1.
+func (t term) clauses(outer termKind, limit int) ([][]term, error) {
+	switch t.kind {
+	case termAnd, termOr:
+	default:
+		return [][]term{{t}}, nil
+	}
+
+	var cs [][]term
+	if t.kind == outer {
+		for _, a := range t.args {
+			acs, err := a.clauses(outer, limit)
+			if err != nil {
+				return nil, err
+			}
+			cs = append(cs, acs...)
+		}
+	} else {
+		// Distribute: each clause of the result takes one of each operand.
+		cs = [][]term{nil}
+		for _, a := range t.args {
+			acs, err := a.clauses(outer, limit)
+			if err != nil {
+				return nil, err
+			}
+
+			product := make([][]term, 0, len(cs)*len(acs))
+			for _, c := range cs {
+				for _, ac := range acs {
+					product = append(product, unionTerms(c, ac))
+				}
+			}
+			cs = product
+
+			if err := checkSize(cs, limit); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return cs, checkSize(cs, limit)
+}
+
+// unionTerms returns the terms of a followed by those of b not in a.
+func unionTerms(a, b []term) []term {
+	r := slices.Clip(a)
+	for _, t := range b {
+		if !slices.ContainsFunc(r, func(x term) bool { return x.key == t.key }) {
+			r = append(r, t)
+		}
+	}
+
+	return r
+}
+
+func checkSize(cs [][]term, limit int) error {
+	if limit < 1 {
+		return nil
+	}
+
+	n := 0
+	for _, c := range cs {
+		n += len(c)
+	}
+
+	if n > limit {
+		return ErrTooLarge
+	}
+
+	return nil
+}
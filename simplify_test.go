@@ -0,0 +1,170 @@
+package boolexpr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimplify(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected string
+	}{
+		{`a = 1`, `a = 1`},
+		{`a = 1 and a = 1`, `a = 1`},
+		{`a = 1 and b = 1 and a == 1`, `a = 1 and b = 1`},
+		{`x = 1 or true`, `true`},
+		{`x = 1 and false`, `false`},
+		{`x = 1 and 2 > 1`, `x = 1`},
+		{`lower("A") = "a" and x`, `x`},
+		{`now() > 2020-01-01 and x`, `now() > 2020-01-01 and x`},
+		{`1 > "a" or x`, `1 > "a" or x`},
+		{`((a = 1))`, `a = 1`},
+		{`a = 1 and (b = 1 and (c = 1))`, `a = 1 and b = 1 and c = 1`},
+		{`(a or (b or c)) and d`, `(a or b or c) and d`},
+		{`not not a`, `a`},
+		{`not (not (a and b))`, `a and b`},
+		{`not (a and b)`, `not (a and b)`},
+		{`a or (a and b)`, `a`},
+		{`(a and b) or a`, `a`},
+		{`a and (a or b)`, `a`},
+		{`(a and b) or (b and c and a)`, `a and b`},
+		{`(a or b) and (b or a)`, `a or b`},
+		{`a and (b or c) and (c or b)`, `a and (b or c)`},
+		{`a or b and c or c and b`, `a or b and c`},
+		{`x = 1 and x = 1 or y`, `x = 1 or y`},
+		{`not a or not a`, `not a`},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+
+			before := exp.String()
+			assert.Equal(t, tc.expected, Simplify(exp).String())
+			assert.Equal(t, before, exp.String(), "e is left as is")
+		})
+	}
+
+	t.Run("missing symbols", func(t *testing.T) {
+		exp, err := Parse(`null = null or x`, WithMissingSymbols(MissingThreeValued))
+		require.NoError(t, err)
+		assert.Equal(t, `null = null or x`, Simplify(exp).String())
+
+		exp, err = Parse(`null = null or x`)
+		require.NoError(t, err)
+		assert.Equal(t, `true`, Simplify(exp).String())
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		assert.Equal(t, Expression{}, Simplify(Expression{}))
+	})
+}
+
+func TestNormalForms(t *testing.T) {
+	tcs := []struct {
+		input    string
+		dnf, cnf string
+	}{
+		{`a`, `a`, `a`},
+		{`a and b`, `a and b`, `a and b`},
+		{`a or b`, `a or b`, `a or b`},
+		{`a and (b or c)`, `a and b or a and c`, `a and (b or c)`},
+		{`a or b and c`, `a or b and c`, `(a or b) and (a or c)`},
+		{`(a or b) and (c or d)`, `a and c or a and d or b and c or b and d`, `(a or b) and (c or d)`},
+		{`a and b or c and d`, `a and b or c and d`, `(a or c) and (a or d) and (b or c) and (b or d)`},
+		{`not (a or b)`, `not a and not b`, `not a and not b`},
+		{`not (a and b)`, `not a or not b`, `not a or not b`},
+		{`not (a and (b or c))`, `not a or not b and not c`, `(not a or not b) and (not a or not c)`},
+		{`not not (a = 1 or b > 2)`, `a = 1 or b > 2`, `a = 1 or b > 2`},
+		{`a and (a or b)`, `a`, `a`},
+		{`(a or b) and (a or c)`, `a or b and c`, `(a or b) and (a or c)`},
+		{`x and (1 = 1 or y)`, `x`, `x`},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+
+			dnf, err := ToDNF(exp, 0)
+			require.NoError(t, err)
+			assert.Equal(t, tc.dnf, dnf.String(), "DNF")
+
+			cnf, err := ToCNF(exp, 0)
+			require.NoError(t, err)
+			assert.Equal(t, tc.cnf, cnf.String(), "CNF")
+		})
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		var clauses []string
+		for i := range 10 {
+			clauses = append(clauses, fmt.Sprintf("(a%d or b%d)", i, i))
+		}
+
+		exp, err := Parse(strings.Join(clauses, " and "))
+		require.NoError(t, err)
+
+		_, err = ToDNF(exp, 1000)
+		assert.ErrorIs(t, err, ErrTooLarge)
+		assert.EqualError(t, err, "Expression too large, DNF of more than 1000 operands")
+
+		cnf, err := ToCNF(exp, 20)
+		require.NoError(t, err)
+		assert.Equal(t, exp.String(), cnf.String())
+
+		_, err = ToCNF(exp, 19)
+		assert.ErrorIs(t, err, ErrTooLarge)
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		_, err := ToDNF(Expression{}, 0)
+		assert.Error(t, err)
+
+		_, err = ToCNF(Expression{}, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestSimplifyResults(t *testing.T) {
+	transforms := map[string]func(Expression) (Expression, error){
+		"simplify": func(e Expression) (Expression, error) { return Simplify(e), nil },
+		"dnf":      func(e Expression) (Expression, error) { return ToDNF(e, 0) },
+		"cnf":      func(e Expression) (Expression, error) { return ToCNF(e, 0) },
+	}
+
+	for name, transform := range transforms {
+		for _, tc := range evalTests {
+			exp, err := Parse(tc.input)
+			require.NoError(t, err)
+
+			r, err := transform(exp)
+			require.NoError(t, err)
+
+			res, err := EvalExpression(r, tc.symbols)
+			require.NoError(t, err, "%s: %s is %s", name, tc.input, r)
+			assert.Equal(t, tc.expected, res, "%s: %s is %s", name, tc.input, r)
+		}
+
+		syms := SymbolsMap{"x": 1, "n": nil, "s": "abc", "b": true, "tags": []string{"a"}, "obj": map[string]any{"a": 1}}
+		for _, tc := range nullTests {
+			for i, m := range []MissingSymbols{MissingNull, MissingThreeValued} {
+				exp, err := Parse(tc.input, WithMissingSymbols(m))
+				require.NoError(t, err)
+
+				r, err := transform(exp)
+				require.NoError(t, err)
+
+				res, err := EvalExpression(r, syms)
+				require.NoError(t, err, "%s: %s is %s", name, tc.input, r)
+				assert.Equal(t, tc.expected[i+1], res, "%s/%d: %s is %s", name, m, tc.input, r)
+			}
+		}
+	}
+}
@@ -0,0 +1,704 @@
+// Package sql translates a boolexpr [boolexpr.Expression] into a
+// parameterised SQL WHERE clause, so the rules evaluated in memory with
+// [boolexpr.EvalExpression] can also select rows from a database table.
+//
+//	exp, _ := boolexpr.Parse(`age >= 18 and name starts_with "Jo"`)
+//	where, args, err := sql.Where(exp, sql.Postgres, nil)
+//	// where: "age" >= $1 AND "name" LIKE $2 ESCAPE '\'
+//	// args:  18, "Jo%"
+//	rows, err := db.Query("SELECT * FROM users WHERE "+where, args...)
+//
+// Literals are always passed as bind arguments, never spliced into the SQL.
+// Symbols become columns through a [Columns] mapper.
+//
+// SQL compares NULL to nothing: a row whose column is NULL is selected by
+// neither a comparison nor its negation, as evaluation in memory does with
+// [boolexpr.MissingThreeValued], where by default it would report the symbol
+// as missing. Like that evaluation, "x = null" matches nothing, where "x is
+// null" becomes "x IS NULL"; "x exists" is unsupported.
+package sql
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/emad-elsaid/boolexpr"
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// ErrUnknownColumn is returned by a [ColumnMap] for a symbol it has no column
+// for.
+var ErrUnknownColumn = errors.New("Column not found")
+
+// Error is returned by [Where] for a node of the expression that can't be
+// translated, located by its source span. The cause is wrapped: an
+// [*UnsupportedError], or the error returned by the [Columns] mapper.
+type Error struct {
+	Start boolexpr.Position
+	End   boolexpr.Position
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %v", e.Start.Line, e.Start.Column, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// UnsupportedError reports an operator or function the [Dialect] can't
+// express. Use errors.As to tell it apart from a mapping error.
+type UnsupportedError struct {
+	Dialect string
+	// Op is the operator or function name, followed by why it can't be
+	// expressed when that is not a limitation of the dialect itself.
+	Op string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s can't be expressed in %s", e.Op, e.Dialect)
+}
+
+// Placeholder renders the bind parameter of the n-th argument of a clause,
+// counting from 1, and returns the value to pass for it.
+type Placeholder func(n int, arg any) (string, any)
+
+var (
+	// Question renders every parameter as "?", as SQLite and MySQL do.
+	Question Placeholder = func(_ int, arg any) (string, any) {
+		return "?", arg
+	}
+
+	// Dollar renders numbered parameters "$1", "$2"..., as Postgres does.
+	Dollar Placeholder = func(n int, arg any) (string, any) {
+		return "$" + strconv.Itoa(n), arg
+	}
+
+	// Named renders named parameters ":p1", ":p2"... and passes each argument
+	// as a [database/sql.NamedArg].
+	Named Placeholder = func(n int, arg any) (string, any) {
+		name := "p" + strconv.Itoa(n)
+		return ":" + name, dbsql.Named(name, arg)
+	}
+)
+
+// Dialect holds what differs between databases. Copy one of the predefined
+// dialects to change its placeholder style:
+//
+//	d := sql.SQLite
+//	d.Placeholder = sql.Named
+type Dialect struct {
+	// Name identifies the dialect in an [UnsupportedError].
+	Name        string
+	Placeholder Placeholder
+	// Match renders the regular expression match of the rendered operands of
+	// "match". It is nil when the dialect has no regular expressions, which
+	// makes "match" unsupported.
+	Match func(left, right string) string
+	// Functions maps the functions an expression may call, such as lower, to
+	// the SQL functions computing them. A call to a function missing from
+	// it is unsupported.
+	Functions map[string]string
+	// Operators renders the operators registered with
+	// [boolexpr.WithOperators], by name, from their rendered operands:
+	//
+	//	d.Operators = map[string]func(l, r string) string{
+	//		"in_cidr": func(l, r string) string { return l + "::inet << " + r + "::inet" },
+	//	}
+	//
+	// A comparison by an operator missing from it is unsupported.
+	Operators map[string]func(left, right string) string
+}
+
+var (
+	// SQLite renders "?" placeholders, and "match" as the REGEXP operator,
+	// which requires the application to register a regexp() function.
+	//
+	// SQLite's LIKE ignores ASCII case by default, where contains, starts_with
+	// and ends_with don't; enable PRAGMA case_sensitive_like for identical
+	// results. floor and ceil need SQLite 3.35 or later built with its math
+	// functions.
+	SQLite = Dialect{
+		Name:        "sqlite",
+		Placeholder: Question,
+		Match:       func(l, r string) string { return l + " REGEXP " + r },
+		Functions: map[string]string{
+			"len": "LENGTH", "lower": "LOWER", "upper": "UPPER", "trim": "TRIM",
+			"abs": "ABS", "round": "ROUND", "floor": "FLOOR", "ceil": "CEIL",
+			"min": "MIN", "max": "MAX",
+		},
+	}
+
+	// Postgres renders "$1" placeholders, and "match" as the "~" operator.
+	// Its regular expressions are POSIX, not RE2: patterns using only the
+	// common syntax behave the same.
+	Postgres = Dialect{
+		Name:        "postgres",
+		Placeholder: Dollar,
+		Match:       func(l, r string) string { return l + " ~ " + r },
+		Functions: map[string]string{
+			"len": "LENGTH", "lower": "LOWER", "upper": "UPPER", "trim": "TRIM",
+			"abs": "ABS", "round": "ROUND", "floor": "FLOOR", "ceil": "CEIL",
+			"min": "LEAST", "max": "GREATEST", "now": "NOW",
+		},
+	}
+)
+
+// Columns maps a symbol, with its path when it has one such as
+// meta.owner, to the SQL expression selecting its value, usually a quoted
+// column name. An error aborts the translation.
+type Columns func(symbol string) (string, error)
+
+// ColumnMap returns a [Columns] mapper looking symbols up in m. Symbols not in
+// m are reported with [ErrUnknownColumn], so m also restricts the columns an
+// expression may reference.
+func ColumnMap(m map[string]string) Columns {
+	return func(symbol string) (string, error) {
+		c, ok := m[symbol]
+		if !ok {
+			return "", fmt.Errorf("Symbol: %s, %w", symbol, ErrUnknownColumn)
+		}
+
+		return c, nil
+	}
+}
+
+// Where translates exp into a WHERE clause for dialect d, without the WHERE
+// keyword, and the arguments to bind to its placeholders. Symbols are mapped
+// to columns by columns; when it is nil each symbol is used as the column of
+// the same name, double-quoted with any double quote in it doubled, so a path
+// key such as meta["a\"b"] can't end the identifier.
+//
+// Comparisons, arithmetic and "in" lists translate directly; "+" with a
+// string literal operand is concatenation, "||". SQL's own rules then apply
+// to types and division by zero. contains, starts_with and
+// ends_with on a string literal become LIKE, with the literal's "%", "_" and
+// "\" escaped, and excludes becomes NOT LIKE. Their operand must be a literal:
+// a pattern held in a column, or containment in a slice, is reported as an
+// [*UnsupportedError], as is "match" in a dialect without it. Their
+// case-insensitive variants, and equals_fold, compare both sides lowered with
+// LOWER, which folds fewer letters than evaluation does: only ASCII ones in
+// SQLite. imatch needs a literal pattern, made case-insensitive with "(?i)".
+// like becomes LIKE, and glob too when its pattern is a literal without
+// character classes. Function calls
+// become the dialect's [Dialect.Functions], which count len in characters,
+// but trim only spaces, and may round halves of floating point numbers to
+// even.
+func Where(exp boolexpr.Expression, d Dialect, columns Columns) (string, []any, error) {
+	t := Tree(exp)
+	if t == nil {
+		return "", nil, errors.New("Where called on zero-value Expression; use Parse to obtain a valid Expression")
+	}
+
+	if columns == nil {
+		columns = quoted
+	}
+
+	w := writer{dialect: d, columns: columns}
+	if err := w.boolExpr(t); err != nil {
+		return "", nil, err
+	}
+
+	return w.sb.String(), w.args, nil
+}
+
+func quoted(symbol string) (string, error) {
+	return `"` + strings.ReplaceAll(symbol, `"`, `""`) + `"`, nil
+}
+
+type writer struct {
+	sb      strings.Builder
+	args    []any
+	dialect Dialect
+	columns Columns
+}
+
+func (w *writer) fail(start, end lexer.Position, err error) error {
+	return &Error{Start: position(start), End: position(end), Err: err}
+}
+
+func (w *writer) unsupported(e *Compare, op string) error {
+	return w.fail(e.Pos, e.EndPos, &UnsupportedError{Dialect: w.dialect.Name, Op: op})
+}
+
+func position(p lexer.Position) boolexpr.Position {
+	return boolexpr.Position{Offset: p.Offset, Line: p.Line, Column: p.Column}
+}
+
+func (w *writer) bind(arg any) {
+	p, arg := w.dialect.Placeholder(len(w.args)+1, arg)
+	w.args = append(w.args, arg)
+	w.sb.WriteString(p)
+}
+
+func (w *writer) boolExpr(b *BoolExpr) error {
+	if err := w.andExpr(&b.And); err != nil {
+		return err
+	}
+
+	for i := range b.OrOps {
+		w.sb.WriteString(" OR ")
+		if err := w.andExpr(&b.OrOps[i].And); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *writer) andExpr(a *AndExpr) error {
+	if err := w.expr(a.Expr); err != nil {
+		return err
+	}
+
+	for _, op := range a.AndOps {
+		w.sb.WriteString(" AND ")
+		if err := w.expr(op.Expr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *writer) expr(x Expr) error {
+	switch e := x.(type) {
+	case *Compare:
+		return w.compare(e)
+	case *BoolValue:
+		return w.value(&e.Value)
+	case *NullTest:
+		// A column is always there, NULL or not, so SQL can't tell a missing
+		// symbol from a null one.
+		if e.Exists {
+			return w.fail(e.Pos, e.EndPos, &UnsupportedError{Dialect: w.dialect.Name, Op: "exists"})
+		}
+
+		if err := w.operand(&e.Operand); err != nil {
+			return err
+		}
+
+		if e.IsNull {
+			w.sb.WriteString(" IS NULL")
+		} else {
+			w.sb.WriteString(" IS NOT NULL")
+		}
+	case *SubExpr:
+		w.sb.WriteByte('(')
+		if err := w.boolExpr(&e.BoolExpr); err != nil {
+			return err
+		}
+		w.sb.WriteByte(')')
+	case *NotExpr:
+		w.sb.WriteString("NOT ")
+		if _, ok := e.Expr.(*SubExpr); ok {
+			return w.expr(e.Expr)
+		}
+
+		// SQL already reads NOT a = b as NOT (a = b); the parentheses are
+		// only there for the reader.
+		w.sb.WriteByte('(')
+		if err := w.expr(e.Expr); err != nil {
+			return err
+		}
+		w.sb.WriteByte(')')
+	}
+
+	return nil
+}
+
+func (w *writer) value(v *Value) error {
+	switch {
+	case v.Null:
+		w.sb.WriteString("NULL")
+	case v.Bool != nil:
+		w.bind(bool(*v.Bool))
+	case v.Float != nil:
+		w.bind(*v.Float)
+	case v.Int != nil:
+		w.bind(int64(*v.Int))
+	case v.String != nil:
+		w.bind(*v.String)
+	case v.Time != nil:
+		w.bind(v.Time.Time)
+	case v.Duration != nil:
+		// Drivers have no common encoding of an interval.
+		return w.fail(v.Pos, v.EndPos, &UnsupportedError{Dialect: w.dialect.Name, Op: "duration"})
+	case v.Symbol != nil:
+		c, err := w.columns(v.Name())
+		if err != nil {
+			return w.fail(v.Pos, v.EndPos, err)
+		}
+		w.sb.WriteString(c)
+	case v.Call != nil:
+		return w.call(v)
+	case v.List != nil:
+		w.sb.WriteByte('(')
+		for i := range v.List.Values {
+			if i > 0 {
+				w.sb.WriteString(", ")
+			}
+			if err := w.value(&v.List.Values[i]); err != nil {
+				return err
+			}
+		}
+		w.sb.WriteByte(')')
+	}
+
+	return nil
+}
+
+// call writes the call of v as the dialect's function. min and max of a
+// single argument are that argument: MIN and MAX of one argument are
+// aggregates in SQLite.
+func (w *writer) call(v *Value) error {
+	c := v.Call
+	if (c.Name == "min" || c.Name == "max") && len(c.Args) == 1 {
+		return w.operand(&c.Args[0])
+	}
+
+	fn, ok := w.dialect.Functions[c.Name]
+	if !ok {
+		return w.fail(v.Pos, v.EndPos, &UnsupportedError{Dialect: w.dialect.Name, Op: c.Name})
+	}
+
+	w.sb.WriteString(fn)
+	w.sb.WriteByte('(')
+	for i := range c.Args {
+		if i > 0 {
+			w.sb.WriteString(", ")
+		}
+		if err := w.operand(&c.Args[i]); err != nil {
+			return err
+		}
+	}
+	w.sb.WriteByte(')')
+
+	return nil
+}
+
+func (w *writer) compare(e *Compare) error {
+	o := e.Op
+	switch {
+	case o.Contains:
+		return w.like(e, "contains", &e.Left, &e.Right, " LIKE ", "%", "%")
+	case o.Excludes:
+		return w.like(e, "excludes", &e.Left, &e.Right, " NOT LIKE ", "%", "%")
+	case o.StartsWith:
+		return w.like(e, "starts_with", &e.Left, &e.Right, " LIKE ", "", "%")
+	case o.EndsWith:
+		return w.like(e, "ends_with", &e.Left, &e.Right, " LIKE ", "%", "")
+	case o.IContains:
+		return w.like(e, "icontains", &e.Left, &e.Right, " LIKE ", "%", "%")
+	case o.IStartsWith:
+		return w.like(e, "istarts_with", &e.Left, &e.Right, " LIKE ", "", "%")
+	case o.IEndsWith:
+		return w.like(e, "iends_with", &e.Left, &e.Right, " LIKE ", "%", "")
+	case o.Like:
+		// A like pattern escapes with "\", as the LIKE it becomes does.
+		if err := w.operand(&e.Left); err != nil {
+			return err
+		}
+		w.sb.WriteString(" LIKE ")
+		if err := w.operand(&e.Right); err != nil {
+			return err
+		}
+		w.sb.WriteString(` ESCAPE '\'`)
+
+		return nil
+	case o.Glob:
+		lit := e.Right.Value()
+		if lit == nil || lit.String == nil {
+			return w.unsupported(e, "glob with a non-string-literal operand")
+		}
+
+		pattern, ok := globLike(*lit.String)
+		if !ok {
+			return w.unsupported(e, "glob with a character class")
+		}
+
+		if err := w.operand(&e.Left); err != nil {
+			return err
+		}
+		w.sb.WriteString(" LIKE ")
+		w.bind(pattern)
+		w.sb.WriteString(` ESCAPE '\'`)
+
+		return nil
+	case o.EqualFold:
+		w.sb.WriteString("LOWER(")
+		if err := w.operand(&e.Left); err != nil {
+			return err
+		}
+		w.sb.WriteString(") = LOWER(")
+		if err := w.operand(&e.Right); err != nil {
+			return err
+		}
+		w.sb.WriteByte(')')
+
+		return nil
+	case (o.In || o.NotIn) && (e.Right.Value() == nil || e.Right.Value().List == nil):
+		// "x in s" is "s contains x".
+		if o.In {
+			return w.like(e, "in", &e.Right, &e.Left, " LIKE ", "%", "%")
+		}
+
+		return w.like(e, "not in", &e.Right, &e.Left, " NOT LIKE ", "%", "%")
+	case o.Match || o.IMatch:
+		op := "match"
+		if o.IMatch {
+			op = "imatch"
+		}
+
+		if w.dialect.Match == nil {
+			return w.unsupported(e, op)
+		}
+
+		lit := e.Right.Value()
+		if o.IMatch && (lit == nil || lit.String == nil) {
+			return w.unsupported(e, op+" with a non-string-literal operand")
+		}
+
+		l, err := w.render(&e.Left)
+		if err != nil {
+			return err
+		}
+
+		var r string
+		if o.IMatch {
+			// The pattern is made case-insensitive with the (?i) flag, which
+			// RE2, Postgres and MySQL all read.
+			var arg any
+			r, arg = w.dialect.Placeholder(len(w.args)+1, "(?i)"+*lit.String)
+			w.args = append(w.args, arg)
+		} else if r, err = w.render(&e.Right); err != nil {
+			return err
+		}
+		w.sb.WriteString(w.dialect.Match(l, r))
+
+		return nil
+	case o.Custom != "":
+		render, ok := w.dialect.Operators[o.Custom]
+		if !ok {
+			return w.unsupported(e, o.Custom)
+		}
+
+		l, err := w.render(&e.Left)
+		if err != nil {
+			return err
+		}
+
+		r, err := w.render(&e.Right)
+		if err != nil {
+			return err
+		}
+		w.sb.WriteString(render(l, r))
+
+		return nil
+	}
+
+	var op string
+	switch {
+	case o.Eq || o.EqEq:
+		op = " = "
+	case o.Neq:
+		op = " <> "
+	case o.Gt:
+		op = " > "
+	case o.Gte:
+		op = " >= "
+	case o.Lt:
+		op = " < "
+	case o.Lte:
+		op = " <= "
+	case o.In:
+		op = " IN "
+	case o.NotIn:
+		op = " NOT IN "
+	default:
+		return w.fail(e.Pos, e.EndPos, boolexpr.ErrOpDoesnotHaveVal)
+	}
+
+	if err := w.operand(&e.Left); err != nil {
+		return err
+	}
+	w.sb.WriteString(op)
+
+	return w.operand(&e.Right)
+}
+
+// operand writes an arithmetic operand. SQL shares the precedence of "+",
+// "-", "*", "/" and "%", so groups are written as they were parsed. "+"
+// concatenates with "||" when a string literal takes part, the one case where
+// its kind is known without the column types, or a call to a function
+// returning a string.
+func (w *writer) operand(o *Operand) error {
+	if v := o.Value(); v != nil {
+		return w.value(v)
+	}
+
+	concat := stringTerm(&o.Term)
+	if err := w.term(&o.Term, concat); err != nil {
+		return err
+	}
+
+	for i := range o.Ops {
+		op := o.Ops[i]
+		if op.Op == "+" && (concat || stringTerm(&op.Term)) {
+			concat = true
+			w.sb.WriteString(" || ")
+		} else {
+			concat = false
+			w.sb.WriteString(" " + op.Op + " ")
+		}
+
+		if err := w.term(&op.Term, concat); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stringTerm reports whether t is a string literal, or a call to lower, upper
+// or trim.
+func stringTerm(t *Term) bool {
+	if len(t.Ops) > 0 || t.Factor.Value == nil {
+		return false
+	}
+
+	v := t.Factor.Value
+	if v.Call != nil {
+		switch v.Call.Name {
+		case "lower", "upper", "trim":
+			return true
+		}
+	}
+
+	return v.String != nil
+}
+
+// term writes t, in parentheses next to "||", which binds tighter than the
+// other operators in SQLite.
+func (w *writer) term(t *Term, concat bool) error {
+	group := concat && len(t.Ops) > 0
+	if group {
+		w.sb.WriteByte('(')
+	}
+
+	if err := w.factor(&t.Factor); err != nil {
+		return err
+	}
+
+	for i := range t.Ops {
+		w.sb.WriteString(" " + t.Ops[i].Op + " ")
+		if err := w.factor(&t.Ops[i].Factor); err != nil {
+			return err
+		}
+	}
+
+	if group {
+		w.sb.WriteByte(')')
+	}
+
+	return nil
+}
+
+func (w *writer) factor(f *Factor) error {
+	switch {
+	case f.Value != nil:
+		return w.value(f.Value)
+	case f.Group != nil:
+		w.sb.WriteByte('(')
+		if err := w.operand(f.Group); err != nil {
+			return err
+		}
+		w.sb.WriteByte(')')
+	case f.Neg != nil:
+		// "--" starts a comment, so a negated negation is parenthesized.
+		w.sb.WriteByte('-')
+		if f.Neg.Neg != nil {
+			w.sb.WriteByte('(')
+			defer w.sb.WriteByte(')')
+		}
+
+		return w.factor(f.Neg)
+	}
+
+	return nil
+}
+
+// render renders o apart, for a dialect to combine, binding its arguments
+// after those of w.
+func (w *writer) render(o *Operand) (string, error) {
+	sub := writer{args: w.args, dialect: w.dialect, columns: w.columns}
+	err := sub.operand(o)
+	w.args = sub.args
+
+	return sub.sb.String(), err
+}
+
+// like writes the LIKE comparison of s against the string literal sub, which
+// is escaped and wrapped between prefix and suffix wildcards. The
+// case-insensitive operators compare LOWER(s) with the lowered literal.
+func (w *writer) like(e *Compare, op string, s, sub *Operand, like, prefix, suffix string) error {
+	lit := sub.Value()
+	if lit == nil || lit.String == nil {
+		return w.unsupported(e, op+" with a non-string-literal operand")
+	}
+
+	fold := e.Op.IContains || e.Op.IStartsWith || e.Op.IEndsWith
+	pattern := *lit.String
+	if fold {
+		pattern = strings.ToLower(pattern)
+		w.sb.WriteString("LOWER(")
+	}
+
+	if err := w.operand(s); err != nil {
+		return err
+	}
+
+	if fold {
+		w.sb.WriteByte(')')
+	}
+	w.sb.WriteString(like)
+	w.bind(prefix + escapeLike(pattern) + suffix)
+	w.sb.WriteString(` ESCAPE '\'`)
+
+	return nil
+}
+
+// globLike returns the LIKE pattern of a glob, reporting false when it has a
+// character class, which LIKE can't express.
+func globLike(glob string) (string, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			sb.WriteByte('%')
+		case '?':
+			sb.WriteByte('_')
+		case '[':
+			return "", false
+		case '\\':
+			i++
+			if i < len(glob) {
+				sb.WriteString(escapeLike(glob[i : i+1]))
+			}
+		default:
+			sb.WriteString(escapeLike(glob[i : i+1]))
+		}
+	}
+
+	return sb.String(), true
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes the LIKE wildcards of s, so that it matches literally.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,466 @@
+package sql
+
+import (
+	dbsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/emad-elsaid/boolexpr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"modernc.org/sqlite"
+)
+
+func TestWhere(t *testing.T) {
+	tcs := []struct {
+		input string
+		where string
+		args  []any
+	}{
+		{`x = 1`, `"x" = ?`, []any{int64(1)}},
+		{`x == 1.5 and y != "a"`, `"x" = ? AND "y" <> ?`, []any{1.5, "a"}},
+		{`x > 1 or x >= 2 and x < 3 or x <= 4`, `"x" > ? OR "x" >= ? AND "x" < ? OR "x" <= ?`, []any{int64(1), int64(2), int64(3), int64(4)}},
+		{`(a or b) and c`, `("a" OR "b") AND "c"`, nil},
+		{`not a`, `NOT ("a")`, nil},
+		{`!(a and b)`, `NOT ("a" AND "b")`, nil},
+		{`not x = 1`, `NOT ("x" = ?)`, []any{int64(1)}},
+		{`true`, `?`, []any{true}},
+		{`x = y`, `"x" = "y"`, nil},
+		{`1 < x`, `? < "x"`, []any{int64(1)}},
+		{`x in (1, 2, y)`, `"x" IN (?, ?, "y")`, []any{int64(1), int64(2)}},
+		{`x not in ("a")`, `"x" NOT IN (?)`, []any{"a"}},
+		{`s contains "b"`, `"s" LIKE ? ESCAPE '\'`, []any{"%b%"}},
+		{`s excludes "b"`, `"s" NOT LIKE ? ESCAPE '\'`, []any{"%b%"}},
+		{`s starts_with "b"`, `"s" LIKE ? ESCAPE '\'`, []any{"b%"}},
+		{`s ends_with "b"`, `"s" LIKE ? ESCAPE '\'`, []any{"%b"}},
+		{`s contains "50%_off\\"`, `"s" LIKE ? ESCAPE '\'`, []any{`%50\%\_off\\%`}},
+		{`"b" in s`, `"s" LIKE ? ESCAPE '\'`, []any{"%b%"}},
+		{`"b" not in s`, `"s" NOT LIKE ? ESCAPE '\'`, []any{"%b%"}},
+		{`s match "^a+$"`, `"s" REGEXP ?`, []any{"^a+$"}},
+		{`a * (b + 1) - -c >= d / 2 % 3`, `"a" * ("b" + ?) - -"c" >= "d" / ? % ?`, []any{int64(1), int64(2), int64(3)}},
+		{`- -a = -1`, `-(-"a") = ?`, []any{int64(-1)}},
+		{`s + "x" + t = u + v`, `"s" || ? || "t" = "u" + "v"`, []any{"x"}},
+		{`"x" + a * b = s`, `? || ("a" * "b") = "s"`, []any{"x"}},
+		{`lower(s) ends_with "@corp.com" and len(tags) > 2`, `LOWER("s") LIKE ? ESCAPE '\' AND LENGTH("tags") > ?`, []any{"%@corp.com", int64(2)}},
+		{`abs(a - 1) <= floor(b)`, `ABS("a" - ?) <= FLOOR("b")`, []any{int64(1)}},
+		{`upper(s) + "!" = t`, `UPPER("s") || ? = "t"`, []any{"!"}},
+		{`min(a) < max(a, b, 2)`, `"a" < MAX("a", "b", ?)`, []any{int64(2)}},
+		{`t >= 2024-01-01 and t < 2024-01-01T10:00:00+02:00`, `"t" >= ? AND "t" < ?`, []any{
+			time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 1, 10, 0, 0, 0, time.FixedZone("", 2*60*60)),
+		}},
+		{`x is null or y is not null`, `"x" IS NULL OR "y" IS NOT NULL`, nil},
+		{`s icontains "B%" and s istarts_with "A"`, `LOWER("s") LIKE ? ESCAPE '\' AND LOWER("s") LIKE ? ESCAPE '\'`, []any{`%b\%%`, "a%"}},
+		{`s iends_with "Z" or s equals_fold t`, `LOWER("s") LIKE ? ESCAPE '\' OR LOWER("s") = LOWER("t")`, []any{"%z"}},
+		{`s imatch "^a+$"`, `"s" REGEXP ?`, []any{"(?i)^a+$"}},
+		{`s like "a\\%_%" or s like t`, `"s" LIKE ? ESCAPE '\' OR "s" LIKE "t" ESCAPE '\'`, []any{`a\%_%`}},
+		{`s glob "*.p?f" and s glob "50%_\\*"`, `"s" LIKE ? ESCAPE '\' AND "s" LIKE ? ESCAPE '\'`, []any{"%.p_f", `50\%\_*`}},
+		{`lower(s) is not null and x != null`, `LOWER("s") IS NOT NULL AND "x" <> NULL`, nil},
+		{`meta["owner"] = 1`, `"meta[""owner""]" = ?`, []any{int64(1)}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := boolexpr.Parse(tc.input)
+			require.NoError(t, err)
+
+			where, args, err := Where(exp, SQLite, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.where, where)
+			assert.Equal(t, tc.args, args)
+		})
+	}
+}
+
+func TestWherePlaceholders(t *testing.T) {
+	exp, err := boolexpr.Parse(`x = 1 and s match "a" and y in (2, 3)`)
+	require.NoError(t, err)
+
+	where, args, err := Where(exp, Postgres, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `"x" = $1 AND "s" ~ $2 AND "y" IN ($3, $4)`, where)
+	assert.Equal(t, []any{int64(1), "a", int64(2), int64(3)}, args)
+
+	d := Postgres
+	d.Placeholder = Named
+	where, args, err = Where(exp, d, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `"x" = :p1 AND "s" ~ :p2 AND "y" IN (:p3, :p4)`, where)
+	assert.Equal(t, []any{
+		dbsql.Named("p1", int64(1)),
+		dbsql.Named("p2", "a"),
+		dbsql.Named("p3", int64(2)),
+		dbsql.Named("p4", int64(3)),
+	}, args)
+}
+
+func TestWhereQuoting(t *testing.T) {
+	exp, err := boolexpr.Parse(`meta[" OR 1=1 OR "] = 5`)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		dialect Dialect
+		where   string
+	}{
+		{SQLite, `"meta["" OR 1=1 OR ""]" = ?`},
+		{Postgres, `"meta["" OR 1=1 OR ""]" = $1`},
+	}
+
+	for _, tc := range tcs {
+		where, args, err := Where(exp, tc.dialect, nil)
+		require.NoError(t, err, tc.dialect.Name)
+		assert.Equal(t, tc.where, where, tc.dialect.Name)
+		assert.Equal(t, []any{int64(5)}, args, tc.dialect.Name)
+	}
+}
+
+func TestWhereFunctions(t *testing.T) {
+	exp, err := boolexpr.Parse(`min(a, b) < max(a, 1) and len(trim(s)) > 0`)
+	require.NoError(t, err)
+
+	where, args, err := Where(exp, Postgres, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `LEAST("a", "b") < GREATEST("a", $1) AND LENGTH(TRIM("s")) > $2`, where)
+	assert.Equal(t, []any{int64(1), int64(0)}, args)
+
+	exp, err = boolexpr.Parse(`t < now()`)
+	require.NoError(t, err)
+
+	where, args, err = Where(exp, Postgres, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `"t" < NOW()`, where)
+	assert.Empty(t, args)
+}
+
+func TestWhereOperators(t *testing.T) {
+	ops := boolexpr.NewOperators()
+	require.NoError(t, ops.Register("in_cidr", func(l, r any) (bool, error) { return false, nil }))
+
+	exp, err := boolexpr.Parse(`ip in_cidr "10.0.0.0/8" and n > 1`, boolexpr.WithOperators(ops))
+	require.NoError(t, err)
+
+	_, _, err = Where(exp, Postgres, nil)
+	var uerr *UnsupportedError
+	require.ErrorAs(t, err, &uerr)
+	assert.Equal(t, "in_cidr", uerr.Op)
+
+	d := Postgres
+	d.Operators = map[string]func(l, r string) string{
+		"in_cidr": func(l, r string) string { return l + "::inet << " + r + "::inet" },
+	}
+
+	where, args, err := Where(exp, d, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `"ip"::inet << $1::inet AND "n" > $2`, where)
+	assert.Equal(t, []any{"10.0.0.0/8", int64(1)}, args)
+}
+
+func TestWhereColumns(t *testing.T) {
+	columns := ColumnMap(map[string]string{
+		"age":           "u.age",
+		"name":          `u."full name"`,
+		`meta["owner"]`: "u.owner_id",
+	})
+
+	exp, err := boolexpr.Parse(`age > 18 and name starts_with "J" and meta["owner"] = 1`)
+	require.NoError(t, err)
+
+	where, _, err := Where(exp, SQLite, columns)
+	require.NoError(t, err)
+	assert.Equal(t, `u.age > ? AND u."full name" LIKE ? ESCAPE '\' AND u.owner_id = ?`, where)
+
+	exp, err = boolexpr.Parse(`age > 18 and password = "x"`)
+	require.NoError(t, err)
+
+	_, _, err = Where(exp, SQLite, columns)
+	require.ErrorIs(t, err, ErrUnknownColumn)
+
+	var serr *Error
+	require.ErrorAs(t, err, &serr)
+	assert.Equal(t, boolexpr.Position{Offset: 13, Line: 1, Column: 14}, serr.Start)
+	assert.Equal(t, boolexpr.Position{Offset: 21, Line: 1, Column: 22}, serr.End)
+}
+
+func TestWhereUnsupported(t *testing.T) {
+	tcs := []struct {
+		input   string
+		dialect Dialect
+		op      string
+	}{
+		{`x = 1 or s match "a"`, Dialect{Name: "plain", Placeholder: Question}, "match"},
+		{`s contains t`, SQLite, "contains with a non-string-literal operand"},
+		{`tags contains 1`, SQLite, "contains with a non-string-literal operand"},
+		{`s starts_with t`, Postgres, "starts_with with a non-string-literal operand"},
+		{`x in tags`, Postgres, "in with a non-string-literal operand"},
+		{`lower(s) = "a"`, Dialect{Name: "plain", Placeholder: Question}, "lower"},
+		{`t - u > 1h`, Postgres, "duration"},
+		{`x exists`, Postgres, "exists"},
+		{`s imatch t`, Postgres, "imatch with a non-string-literal operand"},
+		{`tags icontains "a" and s icontains t`, SQLite, "icontains with a non-string-literal operand"},
+		{`s imatch "a"`, Dialect{Name: "plain", Placeholder: Question}, "imatch"},
+		{`s glob "[ab]*"`, SQLite, "glob with a character class"},
+		{`s glob t`, SQLite, "glob with a non-string-literal operand"},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			exp, err := boolexpr.Parse(tc.input)
+			require.NoError(t, err)
+
+			_, _, err = Where(exp, tc.dialect, nil)
+
+			var uerr *UnsupportedError
+			require.ErrorAs(t, err, &uerr)
+			assert.Equal(t, tc.dialect.Name, uerr.Dialect)
+			assert.Equal(t, tc.op, uerr.Op)
+		})
+	}
+
+	t.Run("zero value", func(t *testing.T) {
+		_, _, err := Where(boolexpr.Expression{}, SQLite, nil)
+		require.Error(t, err)
+	})
+}
+
+func init() {
+	// REGEXP calls regexp(pattern, value), which SQLite leaves to the
+	// application. It matches like "match" does.
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		pattern, ok := args[0].(string)
+		if !ok {
+			return nil, errors.New("regexp: pattern is not a string")
+		}
+
+		value, ok := args[1].(string)
+		if !ok {
+			return false, nil
+		}
+
+		return regexp.MatchString(pattern, value)
+	})
+}
+
+// TestWhereSQLite runs every translated expression against an in-memory
+// SQLite table and checks that it selects exactly the rows the expression
+// evaluates to true for.
+func TestWhereSQLite(t *testing.T) {
+	db, err := dbsql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Pragmas hold per connection, and each connection of :memory: is its own
+	// database.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`PRAGMA case_sensitive_like = ON`)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER, name TEXT, age INTEGER, score REAL, active BOOLEAN)`)
+	require.NoError(t, err)
+
+	rows := []boolexpr.SymbolsMap{
+		{"id": 1, "name": "John", "age": 30, "score": 4.5, "active": true},
+		{"id": 2, "name": "jane", "age": 17, "score": 3.0, "active": false},
+		{"id": 3, "name": "50% off_sale", "age": 45, "score": 1.25, "active": true},
+		{"id": 4, "name": `back\slash`, "age": 18, "score": 5.0, "active": false},
+		{"id": 5, "name": "Joanna", "age": 62, "score": 2.5, "active": true},
+	}
+
+	for _, r := range rows {
+		_, err := db.Exec(`INSERT INTO users VALUES (?, ?, ?, ?, ?)`, r["id"], r["name"], r["age"], r["score"], r["active"])
+		require.NoError(t, err)
+	}
+
+	inputs := []string{
+		`age >= 18`,
+		`age > 17.5 and score <= 4.5`,
+		`active`,
+		`not active or age = 45`,
+		`active == true and age != 30`,
+		`age in (17, 18, 62)`,
+		`age not in (17, 18) and id in (1, 2, 3)`,
+		`score in (3, 5)`,
+		`name = "John" or name = "jane"`,
+		`name contains "o"`,
+		`name contains "%"`,
+		`name contains "_"`,
+		`name contains "\\"`,
+		`name excludes "an"`,
+		`name starts_with "Jo"`,
+		`name starts_with "jo"`,
+		`name ends_with "e"`,
+		`"an" in name`,
+		`"an" not in name`,
+		`name match "^J[a-z]+$"`,
+		`!(age < 18 or name match "sale")`,
+		`id > age`,
+		`age * 2 - id > 60 and score / 2 < 2`,
+		`-(age - 40) > 0 or age % 2 = 1`,
+		`name + "!" = "John!" or "x" + name = "xjane"`,
+		`lower(name) starts_with "jo"`,
+		`upper(name) + "?" = "JANE?"`,
+		`len(name) > 5`,
+		`abs(age - 40) < 10`,
+		`round(score) = 5 or round(score * 2) = 9`,
+		`floor(score) = 2 or ceil(score) = 2`,
+		`max(age, 40) = 40 and min(score, 3) < 2.6`,
+		`max(age) > 40`,
+		`name icontains "JO"`,
+		`name istarts_with "j" or name iends_with "SLASH"`,
+		`name equals_fold "JANE" or name equals_fold "joanna"`,
+		`name imatch "^j[a-z]+$"`,
+		`name like "J%" or name like "%\\%%"`,
+		`name like "_o%" and not name like "%a"`,
+		`name glob "*a*" or name glob "?ohn"`,
+		`name glob "*\\\\*"`,
+	}
+
+	for _, input := range inputs {
+		input := input
+		t.Run(input, func(t *testing.T) {
+			exp, err := boolexpr.Parse(input)
+			require.NoError(t, err)
+
+			var want []int
+			for _, r := range rows {
+				ok, err := boolexpr.EvalExpression(exp, r)
+				require.NoError(t, err)
+				if ok {
+					want = append(want, r["id"].(int))
+				}
+			}
+
+			where, args, err := Where(exp, SQLite, nil)
+			require.NoError(t, err)
+
+			res, err := db.Query(fmt.Sprintf(`SELECT id FROM users WHERE %s ORDER BY id`, where), args...)
+			require.NoError(t, err)
+			defer res.Close()
+
+			var got []int
+			for res.Next() {
+				var id int
+				require.NoError(t, res.Scan(&id))
+				got = append(got, id)
+			}
+			require.NoError(t, res.Err())
+
+			assert.Equal(t, want, got, "WHERE %s %v", where, args)
+		})
+	}
+
+	t.Run("hostile path key", func(t *testing.T) {
+		exp, err := boolexpr.Parse(`meta[" OR 1=1 OR "] = 5`)
+		require.NoError(t, err)
+
+		where, args, err := Where(exp, SQLite, nil)
+		require.NoError(t, err)
+
+		// The key stays inside the identifier, which SQLite reads as a
+		// string when it names no column: no row matches.
+		res, err := db.Query(`SELECT id FROM users WHERE `+where, args...)
+		require.NoError(t, err)
+		defer res.Close()
+		assert.False(t, res.Next())
+		require.NoError(t, res.Err())
+	})
+
+	t.Run("named placeholders", func(t *testing.T) {
+		exp, err := boolexpr.Parse(`age >= 18 and name starts_with "Jo"`)
+		require.NoError(t, err)
+
+		d := SQLite
+		d.Placeholder = Named
+		where, args, err := Where(exp, d, nil)
+		require.NoError(t, err)
+
+		var ids []int
+		res, err := db.Query(`SELECT id FROM users WHERE `+where+` ORDER BY id`, args...)
+		require.NoError(t, err)
+		defer res.Close()
+		for res.Next() {
+			var id int
+			require.NoError(t, res.Scan(&id))
+			ids = append(ids, id)
+		}
+		assert.Equal(t, []int{1, 5}, ids)
+	})
+}
+
+// TestWhereSQLiteNull checks that expressions evaluated with
+// MissingThreeValued select the same rows as their translation, NULL columns
+// included.
+func TestWhereSQLiteNull(t *testing.T) {
+	db, err := dbsql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER, name TEXT, age INTEGER, active BOOLEAN)`)
+	require.NoError(t, err)
+
+	rows := []boolexpr.SymbolsMap{
+		{"id": 1, "name": "John", "age": 30, "active": true},
+		{"id": 2, "name": nil, "age": 17, "active": false},
+		{"id": 3, "name": "jane", "age": nil, "active": nil},
+		{"id": 4, "name": nil, "age": nil, "active": true},
+	}
+
+	for _, r := range rows {
+		_, err := db.Exec(`INSERT INTO users VALUES (?, ?, ?, ?)`, r["id"], r["name"], r["age"], r["active"])
+		require.NoError(t, err)
+	}
+
+	inputs := []string{
+		`age > 18`,
+		`not age > 18`,
+		`age > 18 or name = "jane"`,
+		`not (age > 18 and active)`,
+		`not active`,
+		`age = null`,
+		`not name != null`,
+		`name is null and age is not null`,
+		`not (age is null)`,
+		`age in (17, 30) or not active`,
+		`age + 1 > 18 or lower(name) = "john"`,
+	}
+
+	for _, input := range inputs {
+		input := input
+		t.Run(input, func(t *testing.T) {
+			exp, err := boolexpr.Parse(input, boolexpr.WithMissingSymbols(boolexpr.MissingThreeValued))
+			require.NoError(t, err)
+
+			var want []int
+			for _, r := range rows {
+				ok, err := boolexpr.EvalExpression(exp, r)
+				require.NoError(t, err)
+				if ok {
+					want = append(want, r["id"].(int))
+				}
+			}
+
+			where, args, err := Where(exp, SQLite, nil)
+			require.NoError(t, err)
+
+			res, err := db.Query(`SELECT id FROM users WHERE `+where+` ORDER BY id`, args...)
+			require.NoError(t, err)
+			defer res.Close()
+
+			var got []int
+			for res.Next() {
+				var id int
+				require.NoError(t, res.Scan(&id))
+				got = append(got, id)
+			}
+			require.NoError(t, res.Err())
+
+			assert.Equal(t, want, got, "WHERE %s %v", where, args)
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package boolexpr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// StructSymbols implements [Symbols] over a Go struct, so domain objects can
+// be evaluated without copying their fields into a [SymbolsMap]. Symbols are
+// the struct's exported fields, including those promoted from embedded
+// structs, and its exported methods taking no argument and returning a value,
+// or a value and an error. Fields and methods are read on each lookup, so the
+// struct may change between evaluations.
+//
+// A field is named by its `boolexpr:"name"` tag, or else by the snake_case of
+// its Go name: UserID is user_id. A field tagged `boolexpr:"-"` is left out.
+// Methods are named by the snake_case of their Go name.
+//
+// Values of named types are converted to the kinds evaluation understands: a
+// type Status string reads as a string, any integer type as int, float32 as
+// float64, and slices of those as []string, []int, []float64 or []bool.
+// Pointers are followed, a nil pointer reading as nil. Fields and methods
+// promoted through a nil embedded pointer are missing, and a method that
+// panics fails its lookup with an error.
+type StructSymbols struct {
+	v reflect.Value // pointer to the struct
+	t *structType
+}
+
+// NewStructSymbols returns the [StructSymbols] of v, a struct or a pointer to
+// one. A pointer is read through on each lookup, and gives access to methods
+// with a pointer receiver; a struct is copied. The reflection needed to map
+// names to fields and methods is done once per struct type and cached.
+func NewStructSymbols(v any) (*StructSymbols, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+
+	switch {
+	case rv.Kind() == reflect.Struct:
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		rv = ptr
+	case rv.Kind() == reflect.Pointer && rv.Type().Elem().Kind() == reflect.Struct:
+		if rv.IsNil() {
+			return nil, errors.New("NewStructSymbols called with a nil pointer")
+		}
+	default:
+		return nil, fmt.Errorf("NewStructSymbols called with %T; want a struct or a pointer to one", v)
+	}
+
+	return &StructSymbols{v: rv, t: structTypeOf(rv.Type())}, nil
+}
+
+func (s *StructSymbols) Get(key string) (any, error) {
+	f, ok := s.t.symbols[key]
+	if !ok {
+		return nil, fmt.Errorf("Symbol: %s, %w", key, ErrSymbolNotFound)
+	}
+
+	v, err := f.get(s.v)
+	if err != nil {
+		return nil, fmt.Errorf("Symbol: %s, %w", key, err)
+	}
+
+	return structValue(v)
+}
+
+// structType maps the symbol names of a pointer to struct type to the way
+// each one is read.
+type structType struct {
+	symbols map[string]structSymbol
+}
+
+// structSymbol is a field, by its index path through embedded structs, or a
+// method, by its index in the method set of the pointer type and the index
+// path of the embedded struct it is promoted from, if any.
+type structSymbol struct {
+	index    []int
+	method   int
+	isMethod bool
+	hasErr   bool
+}
+
+func (f structSymbol) get(ptr reflect.Value) (reflect.Value, error) {
+	v, err := field(ptr, f.index)
+	if err != nil || !f.isMethod {
+		return v, err
+	}
+
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return reflect.Value{}, fmt.Errorf("embedded %s is nil, %w", v.Type(), ErrSymbolNotFound)
+	}
+
+	return f.call(ptr)
+}
+
+// field returns the field at index of the struct ptr points to, following
+// the embedded pointers on the way.
+func field(ptr reflect.Value, index []int) (reflect.Value, error) {
+	v := ptr.Elem()
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, fmt.Errorf("embedded %s is nil, %w", v.Type(), ErrSymbolNotFound)
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, nil
+}
+
+// call calls the method f of ptr, returning a panic as an error.
+func (f structSymbol) call(ptr reflect.Value) (v reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = reflect.Value{}, fmt.Errorf("panicked: %v", r)
+		}
+	}()
+
+	out := ptr.Method(f.method).Call(nil)
+	if f.hasErr && !out[1].IsNil() {
+		return reflect.Value{}, out[1].Interface().(error)
+	}
+
+	return out[0], nil
+}
+
+// structTypes caches the structType of each pointer to struct type.
+var structTypes sync.Map // map[reflect.Type]*structType
+
+func structTypeOf(ptr reflect.Type) *structType {
+	if t, ok := structTypes.Load(ptr); ok {
+		return t.(*structType)
+	}
+
+	t := &structType{symbols: map[string]structSymbol{}}
+
+	// Fields promoted from deeper embedded structs are shadowed by shallower
+	// ones, and are ambiguous at the same depth, as in Go.
+	depth := map[string]int{}
+	ambiguous := map[string]bool{}
+	var embedded []reflect.StructField
+	for _, f := range reflect.VisibleFields(ptr.Elem()) {
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, f)
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+
+		if d, seen := depth[name]; seen {
+			if d == len(f.Index) {
+				ambiguous[name] = true
+			}
+			if d <= len(f.Index) {
+				continue
+			}
+		}
+
+		depth[name] = len(f.Index)
+		delete(ambiguous, name)
+		t.symbols[name] = structSymbol{index: f.Index}
+	}
+
+	for name := range ambiguous {
+		delete(t.symbols, name)
+	}
+
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	for i := 0; i < ptr.NumMethod(); i++ {
+		m := ptr.Method(i)
+		mt := m.Type // the receiver is its first argument
+		if mt.NumIn() != 1 {
+			continue
+		}
+
+		hasErr := mt.NumOut() == 2 && mt.Out(1) == errorType
+		if mt.NumOut() != 1 && !hasErr {
+			continue
+		}
+
+		name := snakeCase(m.Name)
+		if _, ok := t.symbols[name]; ok {
+			continue
+		}
+
+		t.symbols[name] = structSymbol{index: promotedFrom(embedded, m.Name), method: i, isMethod: true, hasErr: hasErr}
+	}
+
+	actual, _ := structTypes.LoadOrStore(ptr, t)
+	return actual.(*structType)
+}
+
+// promotedFrom returns the index path of the shallowest of the embedded
+// structs whose method set has the method name, which it is promoted from, or
+// nil when there is none or more than one at that depth.
+func promotedFrom(embedded []reflect.StructField, name string) []int {
+	var index []int
+	ambiguous := false
+	for _, f := range embedded {
+		t := f.Type
+		if t.Kind() != reflect.Pointer {
+			t = reflect.PointerTo(t)
+		}
+		if _, ok := t.MethodByName(name); !ok {
+			continue
+		}
+
+		switch {
+		case index == nil || len(f.Index) < len(index):
+			index, ambiguous = f.Index, false
+		case len(f.Index) == len(index):
+			ambiguous = true
+		}
+	}
+
+	if ambiguous {
+		return nil
+	}
+
+	return index
+}
+
+// fieldName returns the symbol name of f, and false when its tag leaves it
+// out.
+func fieldName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("boolexpr")
+	switch {
+	case tag == "-":
+		return "", false
+	case ok && tag != "":
+		return tag, true
+	default:
+		return snakeCase(f.Name), true
+	}
+}
+
+// snakeCase converts a Go identifier to snake_case, keeping initialisms
+// together: UserID is user_id and HTTPServer is http_server.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					sb.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+// structValue converts a field or method result to a value evaluation
+// understands, by its kind rather than its type, but for times and
+// durations, which are kept as such.
+func structValue(v reflect.Value) (any, error) {
+	switch v.Type() {
+	case reflect.TypeFor[time.Duration]():
+		return time.Duration(v.Int()), nil
+	case reflect.TypeFor[*time.Time]():
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		return v.Elem().Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u <= math.MaxInt {
+			return int(u), nil
+		}
+
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		if v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Struct {
+			break
+		}
+
+		return structValue(v.Elem())
+	case reflect.Slice:
+		if s, ok := sliceValue(v); ok {
+			return s, nil
+		}
+	}
+
+	if !v.CanInterface() {
+		return nil, fmt.Errorf("%w, %s", ErrSymbolTypeUnknown, v.Type())
+	}
+
+	return v.Interface(), nil
+}
+
+// sliceValue converts a slice of a named bool, integer, float or string type
+// to the slice of the underlying kind, and reports false for other slices.
+func sliceValue(v reflect.Value) (any, bool) {
+	if v.CanInterface() {
+		switch s := v.Interface().(type) {
+		case []string, []int, []float64, []bool:
+			return s, true
+		}
+	}
+
+	n := v.Len()
+	switch v.Type().Elem().Kind() {
+	case reflect.String:
+		s := make([]string, n)
+		for i := range s {
+			s[i] = v.Index(i).String()
+		}
+		return s, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s := make([]int, n)
+		for i := range s {
+			s[i] = int(v.Index(i).Int())
+		}
+		return s, true
+	case reflect.Float32, reflect.Float64:
+		s := make([]float64, n)
+		for i := range s {
+			s[i] = v.Index(i).Float()
+		}
+		return s, true
+	case reflect.Bool:
+		s := make([]bool, n)
+		for i := range s {
+			s[i] = v.Index(i).Bool()
+		}
+		return s, true
+	default:
+		return nil, false
+	}
+}
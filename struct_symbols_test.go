@@ -0,0 +1,252 @@
+package boolexpr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStatus string
+
+type testLevel uint8
+
+type testAudit struct {
+	CreatedBy string
+	Version   int
+}
+
+type testAccount struct {
+	Plan   string
+	Seats  int
+	Status testStatus
+}
+
+func (a testAccount) Paid() bool { return a.Plan != "free" }
+
+func (a testAudit) Initial() string { return a.CreatedBy[:1] }
+
+type testUser struct {
+	*testAccount
+	testAudit
+
+	ID        int64
+	UserID    string
+	Name      string `boolexpr:"full_name"`
+	Password  string `boolexpr:"-"`
+	Age       uint16
+	Score     float32
+	Active    bool
+	Level     testLevel
+	Tags      []string
+	Roles     []testStatus
+	Scores    []float32
+	Nickname  *string
+	Manager   *testUser
+	Version   int // shadows testAudit.Version
+	HTTPProxy string
+	CreatedAt time.Time
+	DeletedAt *time.Time
+	Timeout   time.Duration
+
+	secret string
+}
+
+func (u testUser) IsAdult() bool { return u.Age >= 18 }
+
+func (u *testUser) DisplayName() (string, error) {
+	if u.Name == "" {
+		return "", errors.New("no name")
+	}
+
+	return u.Name + " (" + u.UserID + ")", nil
+}
+
+func (u testUser) Greet(greeting string) string { return greeting + " " + u.Name }
+
+func TestStructSymbols(t *testing.T) {
+	nick := "bob"
+	u := &testUser{
+		testAccount: &testAccount{Plan: "pro", Seats: 5, Status: "active"},
+		testAudit:   testAudit{CreatedBy: "admin", Version: 1},
+		ID:          42,
+		UserID:      "u-42",
+		Name:        "Robert",
+		Password:    "hunter2",
+		Age:         30,
+		Score:       4.5,
+		Active:      true,
+		Level:       3,
+		Tags:        []string{"a", "b"},
+		Roles:       []testStatus{"admin", "dev"},
+		Scores:      []float32{1.5},
+		Nickname:    &nick,
+		Version:     2,
+		HTTPProxy:   "proxy",
+		CreatedAt:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Timeout:     90 * time.Second,
+		secret:      "s",
+	}
+
+	syms, err := NewStructSymbols(u)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		key      string
+		expected any
+	}{
+		{"id", 42},
+		{"user_id", "u-42"},
+		{"full_name", "Robert"},
+		{"age", 30},
+		{"score", 4.5},
+		{"active", true},
+		{"level", 3},
+		{"tags", []string{"a", "b"}},
+		{"roles", []string{"admin", "dev"}},
+		{"scores", []float64{1.5}},
+		{"nickname", "bob"},
+		{"manager", nil},
+		{"version", 2},
+		{"http_proxy", "proxy"},
+		{"created_at", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"deleted_at", nil},
+		{"timeout", 90 * time.Second},
+		{"plan", "pro"},
+		{"seats", 5},
+		{"status", "active"},
+		{"created_by", "admin"},
+		{"paid", true},
+		{"initial", "a"},
+		{"is_adult", true},
+		{"display_name", "Robert (u-42)"},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.key, func(t *testing.T) {
+			v, err := syms.Get(tc.key)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+
+	for _, key := range []string{"name", "password", "secret", "greet", "test_account", "test_audit", "Name"} {
+		_, err := syms.Get(key)
+		assert.ErrorIs(t, err, ErrSymbolNotFound, key)
+	}
+
+	t.Run("evaluation", func(t *testing.T) {
+		res, err := Eval(`status = "active" and plan in ("pro", "team") and level > 2 and roles contains "admin" and is_adult`, syms)
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+
+	t.Run("times and durations", func(t *testing.T) {
+		res, err := Eval(`created_at >= 2024-01-01 and created_at + timeout < 2024-01-02T00:02:00Z and timeout > 1m`, syms)
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+
+	t.Run("reads the current values", func(t *testing.T) {
+		u.Age = 12
+		v, err := syms.Get("is_adult")
+		require.NoError(t, err)
+		assert.Equal(t, false, v)
+	})
+
+	t.Run("method error", func(t *testing.T) {
+		syms, err := NewStructSymbols(&testUser{})
+		require.NoError(t, err)
+
+		_, err = syms.Get("display_name")
+		require.EqualError(t, err, "Symbol: display_name, no name")
+	})
+
+	t.Run("nil embedded pointer", func(t *testing.T) {
+		syms, err := NewStructSymbols(testUser{})
+		require.NoError(t, err)
+
+		_, err = syms.Get("plan")
+		require.ErrorIs(t, err, ErrSymbolNotFound)
+
+		_, err = syms.Get("paid")
+		require.ErrorIs(t, err, ErrSymbolNotFound, "a method promoted through it is missing too")
+
+		res, err := Eval(`paid is null`, syms, WithMissingSymbols(MissingNull))
+		require.NoError(t, err)
+		assert.True(t, res)
+	})
+
+	t.Run("method panic", func(t *testing.T) {
+		syms, err := NewStructSymbols(&testUser{})
+		require.NoError(t, err)
+
+		_, err = syms.Get("initial")
+		require.ErrorContains(t, err, "Symbol: initial, panicked: runtime error: slice bounds out of range")
+		assert.NotErrorIs(t, err, ErrSymbolNotFound)
+
+		_, err = Eval(`initial = "a"`, syms)
+		var eerr *EvalError
+		require.ErrorAs(t, err, &eerr)
+	})
+
+	t.Run("struct value has no pointer methods", func(t *testing.T) {
+		syms, err := NewStructSymbols(testUser{Name: "x", Age: 20})
+		require.NoError(t, err)
+
+		v, err := syms.Get("is_adult")
+		require.NoError(t, err)
+		assert.Equal(t, true, v)
+
+		v, err = syms.Get("display_name")
+		require.NoError(t, err, "a struct is copied to a pointer, so pointer methods are available too")
+		assert.Equal(t, "x ()", v)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		for _, v := range []any{nil, 1, "x", (*testUser)(nil), []testUser{}} {
+			_, err := NewStructSymbols(v)
+			assert.Error(t, err, "%T", v)
+		}
+	})
+}
+
+func TestStructSymbolsAmbiguous(t *testing.T) {
+	type a struct{ Name string }
+	type b struct{ Name string }
+	type both struct {
+		a
+		b
+		Plan     string `boolexpr:"kind"`
+		Category string `boolexpr:"kind"`
+	}
+
+	syms, err := NewStructSymbols(both{a: a{"x"}, b: b{"y"}})
+	require.NoError(t, err)
+
+	for _, key := range []string{"name", "kind"} {
+		_, err = syms.Get(key)
+		assert.ErrorIs(t, err, ErrSymbolNotFound, key)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tcs := map[string]string{
+		"Name":       "name",
+		"UserID":     "user_id",
+		"HTTPServer": "http_server",
+		"CreatedAt":  "created_at",
+		"Address2":   "address2",
+		"Level2Name": "level2_name",
+		"A":          "a",
+		"ID":         "id",
+		"IsHTTPS":    "is_https",
+	}
+
+	for in, out := range tcs {
+		assert.Equal(t, out, snakeCase(in), in)
+	}
+}
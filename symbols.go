@@ -1,9 +1,12 @@
 package boolexpr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Symbols supplies the value of each symbol referenced by an expression during
@@ -17,19 +20,59 @@ type Symbols interface {
 	Get(string) (any, error)
 }
 
+// ContextSymbols is a [Symbols] that can also look a symbol up under a
+// [context.Context], so a lookup made by [EvalExpressionContext] or
+// [Program.EvalContext] is canceled with the evaluation and can read its
+// deadline and values. Other evaluations call Get.
+type ContextSymbols interface {
+	Symbols
+	// GetContext is Get under ctx. It should return ctx.Err(), possibly
+	// wrapped, when it gives up because ctx is done.
+	GetContext(ctx context.Context, name string) (any, error)
+}
+
+// BatchSymbols is a [Symbols] that can also look several symbols up in one
+// call, such as a remote store answering a single request for them all.
+// [CachedSymbols.GetMany] uses it to fill its cache, as does evaluation with
+// [WithPrefetch]. Evaluation without prefetching looks each symbol up with Get
+// as it reaches it, batching nothing.
+type BatchSymbols interface {
+	Symbols
+	// GetMany returns the values of the named symbols. A symbol absent from
+	// the map is missing; an error fails the lookup of all of them.
+	GetMany(names []string) (map[string]any, error)
+}
+
+// BatchContextSymbols is a [BatchSymbols] that can also look several symbols
+// up under a [context.Context], as [ContextSymbols] does one, so a batch
+// looked up by [CachedSymbols.GetManyContext] or a prefetching
+// [EvalExpressionContext] is canceled with it. Other lookups call GetMany.
+type BatchContextSymbols interface {
+	BatchSymbols
+	// GetManyContext is GetMany under ctx. It should return ctx.Err(),
+	// possibly wrapped, when it gives up because ctx is done.
+	GetManyContext(ctx context.Context, names []string) (map[string]any, error)
+}
+
 // SymbolsMap is the simplest [Symbols] implementation: a map from symbol name
-// to value. A value may be a literal (string, int, float64, bool), a slice for
-// use with contains/excludes, or a function that is evaluated lazily on each
-// lookup (see [resolveSymbol] for the accepted function signatures).
+// to value. A value may be a literal (string, int, float64, bool, time.Time,
+// time.Duration), a slice for use with contains/excludes, or a function that
+// is evaluated lazily on each lookup (see [resolveSymbol] for the accepted
+// function signatures).
 type SymbolsMap map[string]any
 
 func (s SymbolsMap) Get(key string) (any, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is Get, passing ctx to a function value that takes one.
+func (s SymbolsMap) GetContext(ctx context.Context, key string) (any, error) {
 	v, ok := s[key]
 	if !ok {
 		return v, fmt.Errorf("Symbol: %s, %w", key, ErrSymbolNotFound)
 	}
 
-	resolved, err := resolveSymbol(v)
+	resolved, err := resolveSymbol(ctx, v)
 	if err != nil {
 		return nil, fmt.Errorf("Symbol: %s, %w", key, err)
 	}
@@ -38,11 +81,39 @@ func (s SymbolsMap) Get(key string) (any, error) {
 }
 
 type symbolEntry struct {
-	once sync.Once
+	mu   sync.Mutex
+	done atomic.Bool
 	raw  any
 	val  any
 	err  error
 	used atomic.Bool
+	// batch is the batch filling the entry of a [CachedSymbols], if any.
+	batch *symbolBatch
+}
+
+// load fills the entry with the value and error fetch returns, once: later
+// loads return them without calling it again. An error because ctx was done
+// is returned but not kept, so a later load under a live ctx fetches again.
+func (e *symbolEntry) load(ctx context.Context, fetch func() (any, error)) (any, error) {
+	if e.done.Load() {
+		return e.val, e.err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done.Load() {
+		return e.val, e.err
+	}
+
+	val, err := fetch()
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil, err
+	}
+
+	e.val, e.err = val, err
+	e.done.Store(true)
+
+	return val, err
 }
 
 // CachedMap implements Symbols interface, wraps map[string]any and keeps
@@ -57,36 +128,59 @@ type CachedMap struct {
 }
 
 func (s *CachedMap) Get(key string) (any, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext is Get, passing ctx to a function value that takes one. As the
+// function is called once, later lookups get its result under the ctx of the
+// first, unless it failed because that ctx was done: the function is then
+// called again by the next lookup.
+func (s *CachedMap) GetContext(ctx context.Context, key string) (any, error) {
+	e, val, err := s.load(ctx, key)
+	if err == nil {
+		e.used.Store(true)
+	}
+
+	return val, err
+}
+
+// fetch caches the value of key ahead of its use, as prefetching does,
+// without marking it as used.
+func (s *CachedMap) fetch(ctx context.Context, key string) {
+	_, _, _ = s.load(ctx, key)
+}
+
+// load returns the entry of key, if any, and its value.
+func (s *CachedMap) load(ctx context.Context, key string) (*symbolEntry, any, error) {
 	idx, ok := s.index[key]
 	if !ok {
-		return nil, fmt.Errorf("symbol: %s, %w", key, ErrSymbolNotFound)
+		return nil, nil, fmt.Errorf("symbol: %s, %w", key, ErrSymbolNotFound)
 	}
 
 	e := &s.entries[idx]
-	e.once.Do(func() {
+	val, err := e.load(ctx, func() (val any, err error) {
 		defer func() {
 			if r := recover(); r != nil {
-				e.err = fmt.Errorf("symbol: %s panicked: %v", key, r)
+				val, err = nil, fmt.Errorf("symbol: %s panicked: %v", key, r)
 			}
 		}()
 
-		resolved, err := resolveSymbol(e.raw)
+		resolved, err := resolveSymbol(ctx, e.raw)
 		if err != nil {
-			e.err = fmt.Errorf("symbol: %s, %w", key, err)
-			return
+			return nil, fmt.Errorf("symbol: %s, %w", key, err)
 		}
 
-		e.val = resolved
-		e.used.Store(true)
+		return resolved, nil
 	})
 
-	return e.val, e.err
+	return e, val, err
 }
 
 // Used returns the symbols that were actually accessed during evaluation,
 // mapped to their resolved values. Because evaluation short-circuits, symbols
-// guarded by an already-decided "and"/"or" are absent. Call it after
-// evaluating to learn which inputs influenced the result.
+// guarded by an already-decided "and"/"or" are absent, even when
+// [WithPrefetch] looked them up ahead of it. Call it after evaluating to
+// learn which inputs influenced the result.
 func (s *CachedMap) Used() map[string]any {
 	result := make(map[string]any)
 
@@ -119,13 +213,16 @@ func NewCachedMap(m map[string]any) *CachedMap {
 // evaluation. Non-function values are returned unchanged. Functions matching
 // one of the supported signatures are called and their result used; the
 // error-returning variants abort evaluation when they return a non-nil error.
+// Functions taking a [context.Context] are called with ctx.
 //
 // Supported function signatures are, for T in
-// {bool, int, string, float64, []string, []int, []float64, []bool, any}:
+// {bool, int, string, float64, []string, []int, []float64, []bool, any,
+// time.Time, time.Duration}:
 //
 //	func() T
 //	func() (T, error)
-func resolveSymbol(v any) (any, error) {
+//	func(context.Context) (T, error)
+func resolveSymbol(ctx context.Context, v any) (any, error) {
 	switch i := v.(type) {
 	case func() bool:
 		return i(), nil
@@ -163,6 +260,36 @@ func resolveSymbol(v any) (any, error) {
 		return i(), nil
 	case func() (any, error):
 		return i()
+	case func() time.Time:
+		return i(), nil
+	case func() (time.Time, error):
+		return i()
+	case func() time.Duration:
+		return i(), nil
+	case func() (time.Duration, error):
+		return i()
+	case func(context.Context) (bool, error):
+		return i(ctx)
+	case func(context.Context) (int, error):
+		return i(ctx)
+	case func(context.Context) (string, error):
+		return i(ctx)
+	case func(context.Context) (float64, error):
+		return i(ctx)
+	case func(context.Context) ([]string, error):
+		return i(ctx)
+	case func(context.Context) ([]int, error):
+		return i(ctx)
+	case func(context.Context) ([]float64, error):
+		return i(ctx)
+	case func(context.Context) ([]bool, error):
+		return i(ctx)
+	case func(context.Context) (any, error):
+		return i(ctx)
+	case func(context.Context) (time.Time, error):
+		return i(ctx)
+	case func(context.Context) (time.Duration, error):
+		return i(ctx)
 	default:
 		return i, nil
 	}
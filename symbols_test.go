@@ -1,8 +1,10 @@
 package boolexpr
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -71,6 +73,22 @@ func TestCachedMap(t *testing.T) {
 		assert.Equal(t, expected, s.Used())
 	})
 
+	t.Run("times and durations", func(t *testing.T) {
+		created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		s := NewCachedMap(map[string]any{
+			"created": func() time.Time { return created },
+			"expires": func() (time.Time, error) { return created.Add(time.Hour), nil },
+			"ttl":     func() time.Duration { return time.Hour },
+		})
+
+		res, err := Eval("created < expires and expires - created = ttl and ttl >= 60m", s)
+		assert.NoError(t, err)
+		assert.True(t, res)
+
+		expected := map[string]any{"created": created, "expires": created.Add(time.Hour), "ttl": time.Hour}
+		assert.Equal(t, expected, s.Used())
+	})
+
 	t.Run("i a function returned error, still records symbols", func(t *testing.T) {
 		s := NewCachedMap(map[string]any{
 			"x": func() int { return 1 },
@@ -86,3 +104,80 @@ func TestCachedMap(t *testing.T) {
 		assert.Equal(t, expected, s.Used())
 	})
 }
+
+func TestSymbolsContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	value := func(ctx context.Context) (string, error) {
+		v, ok := ctx.Value(ctxKey{}).(string)
+		if !ok {
+			return "", ErrSymbolNotFound
+		}
+		return v, nil
+	}
+
+	t.Run("SymbolsMap", func(t *testing.T) {
+		var _ ContextSymbols = SymbolsMap{}
+		s := SymbolsMap{"x": value}
+
+		v, err := s.GetContext(ctx, "x")
+		assert.NoError(t, err)
+		assert.Equal(t, "v", v)
+
+		_, err = s.Get("x")
+		assert.ErrorIs(t, err, ErrSymbolNotFound)
+	})
+
+	t.Run("CachedMap", func(t *testing.T) {
+		var _ ContextSymbols = NewCachedMap(nil)
+		s := NewCachedMap(map[string]any{"x": value})
+
+		v, err := s.GetContext(ctx, "x")
+		assert.NoError(t, err)
+		assert.Equal(t, "v", v)
+		assert.Equal(t, map[string]any{"x": "v"}, s.Used())
+	})
+
+	t.Run("CachedSymbols", func(t *testing.T) {
+		var _ ContextSymbols = NewCachedSymbols(nil)
+		var underlying contextSymbols
+		s := NewCachedSymbols(&underlying)
+
+		v, err := s.GetContext(context.WithValue(ctx, ctxKey{}, map[string]any{"x": 1}), "x")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v)
+		assert.Zero(t, underlying.gets)
+
+		s = NewCachedSymbols(SymbolsMap{"x": value})
+		v, err = s.GetContext(ctx, "x")
+		assert.NoError(t, err)
+		assert.Equal(t, "v", v)
+	})
+
+	t.Run("canceled lookups are not cached", func(t *testing.T) {
+		calls := 0
+		value := func(ctx context.Context) (int, error) {
+			calls++
+			return calls, ctx.Err()
+		}
+
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		for name, s := range map[string]ContextSymbols{
+			"CachedMap":     NewCachedMap(map[string]any{"x": value}),
+			"CachedSymbols": NewCachedSymbols(SymbolsMap{"x": value}),
+		} {
+			calls = 0
+			_, err := s.GetContext(canceled, "x")
+			assert.ErrorIs(t, err, context.Canceled, name)
+
+			v, err := s.GetContext(context.Background(), "x")
+			assert.NoError(t, err, name)
+			assert.Equal(t, 2, v, name)
+
+			v, err = s.Get("x")
+			assert.NoError(t, err, name)
+			assert.Equal(t, 2, v, name)
+		}
+	})
+}
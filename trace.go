@@ -0,0 +1,431 @@
+package boolexpr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/emad-elsaid/boolexpr/internal"
+)
+
+// TraceKind is the kind of node a [Trace] records.
+type TraceKind uint8
+
+const (
+	TraceOr TraceKind = iota + 1
+	TraceAnd
+	TraceNot
+	TraceCompare
+	// TraceValue is a bare value used as a condition, such as a bool symbol.
+	TraceValue
+	// TraceNullTest is a test such as "x is null" or "x exists".
+	TraceNullTest
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceOr:
+		return "or"
+	case TraceAnd:
+		return "and"
+	case TraceNot:
+		return "not"
+	case TraceCompare:
+		return "compare"
+	case TraceValue:
+		return "value"
+	case TraceNullTest:
+		return "null test"
+	default:
+		return "unknown"
+	}
+}
+
+// Trace records how [EvalExpressionTrace] reached its result, one node per
+// operator of the expression. Parentheses leave no node of their own, and a
+// chain of "and" or "or" is a single node with a child per operand.
+type Trace struct {
+	Kind TraceKind
+	// Text is the canonical source text of the node, as written by
+	// [Expression.String].
+	Text string
+	// Result is the value the node evaluated to. It is false for a skipped
+	// node, or one whose evaluation failed.
+	Result bool
+	// Unknown is set on a node that is neither true nor false under
+	// [MissingThreeValued]; its Result is false.
+	Unknown bool
+	// Skipped is set on the operands of "and" and "or" that short-circuiting
+	// did not evaluate. A skipped node has no children.
+	Skipped bool
+	// Err is the error that stopped evaluation, set on the failing node and on
+	// each of its ancestors.
+	Err error
+	// Op is the operator of a comparison, spelled as in Text.
+	Op string
+	// Left and Right are the resolved operands of a comparison. A list operand
+	// is a []any of its elements; symbols evaluation did not reach are nil,
+	// like null ones.
+	Left, Right any
+	// Value is the resolved value of a bare value, or of the operand of a
+	// null test.
+	Value    any
+	Children []*Trace
+
+	// unreached holds the operands evaluation did not reach, to tell them
+	// from null ones: 0 for Left or Value, 1 for Right and 2+i for the i-th
+	// element of a list Right.
+	unreached []int
+}
+
+// EvalExpressionTrace evaluates e against syms with opts exactly like
+// [EvalExpression], and also returns a [Trace] of the evaluation: the resolved operands and
+// result of every comparison visited, and which operands of "and" and "or"
+// were skipped. It answers why an expression evaluated the way it did; print
+// the trace to see it as a tree.
+//
+// When evaluation fails the trace is still returned, up to the failing node.
+// Tracing allocates for every node, so prefer [EvalExpression] when the trace
+// is not needed.
+func EvalExpressionTrace(e Expression, syms Symbols, opts ...Option) (bool, *Trace, error) {
+	if e.e == nil {
+		return false, nil, errors.New("EvalExpressionTrace called on zero-value Expression; use Parse to obtain a valid Expression")
+	}
+
+	syms = prefetch(context.Background(), e.e, withOptions(syms, opts, e.missing))
+	t := tracer{syms: syms, values: map[any]evalVal{}}
+	trace, err := t.boolExpr(e.e)
+	if err != nil {
+		return false, trace, err
+	}
+
+	return trace.Result, trace, nil
+}
+
+// tracer evaluates an expression node by node. It is also the Symbols the
+// comparisons are evaluated against, so evaluation records in values what it
+// computes for the symbols, calls and arithmetic of their operands, which the
+// trace shows without computing them a second time.
+type tracer struct {
+	syms   Symbols
+	values map[any]evalVal
+}
+
+func (t *tracer) Get(key string) (any, error) {
+	return t.syms.Get(key)
+}
+
+// traced records the value v evaluation computed for node, a symbol or call
+// *Value or an arithmetic *Operand, when it evaluates against a tracer.
+func traced(syms Symbols, node any, v evalVal) {
+	if t, ok := syms.(*tracer); ok {
+		t.values[node] = v
+	}
+}
+
+func (t *tracer) boolExpr(b *BoolExpr) (*Trace, error) {
+	if len(b.OrOps) == 0 {
+		return t.andExpr(&b.And)
+	}
+
+	node := &Trace{Kind: TraceOr, Text: nodeText(func(sb *strings.Builder) { writeBoolExpr(sb, b, precOr) })}
+	child, err := t.andExpr(&b.And)
+	node.Children = append(node.Children, child)
+	if err != nil {
+		node.Err = err
+		return node, err
+	}
+
+	res, unknown := child.Result, child.Unknown
+	for i := range b.OrOps {
+		if res {
+			node.Children = append(node.Children, skippedAndExpr(&b.OrOps[i].And))
+			continue
+		}
+
+		child, err := t.andExpr(&b.OrOps[i].And)
+		node.Children = append(node.Children, child)
+		if err != nil {
+			node.Err = err
+			return node, err
+		}
+
+		res, unknown = child.Result, unknown || child.Unknown
+	}
+
+	node.Result, node.Unknown = res, unknown && !res
+	return node, nil
+}
+
+func (t *tracer) andExpr(a *AndExpr) (*Trace, error) {
+	if len(a.AndOps) == 0 {
+		return t.expr(a.Expr)
+	}
+
+	node := &Trace{Kind: TraceAnd, Text: nodeText(func(sb *strings.Builder) { writeAndExpr(sb, a, precOr) })}
+	child, err := t.expr(a.Expr)
+	node.Children = append(node.Children, child)
+	if err != nil {
+		node.Err = err
+		return node, err
+	}
+
+	// An unknown operand doesn't decide the result, so it reads as true.
+	res, unknown := child.Result || child.Unknown, child.Unknown
+	for _, op := range a.AndOps {
+		if !res {
+			node.Children = append(node.Children, skippedExpr(op.Expr))
+			continue
+		}
+
+		child, err := t.expr(op.Expr)
+		node.Children = append(node.Children, child)
+		if err != nil {
+			node.Err = err
+			return node, err
+		}
+
+		res, unknown = child.Result || child.Unknown, unknown || child.Unknown
+	}
+
+	node.Result, node.Unknown = res && !unknown, res && unknown
+	return node, nil
+}
+
+func (t *tracer) expr(x Expr) (*Trace, error) {
+	switch e := x.(type) {
+	case *Compare:
+		clear(t.values)
+		node := &Trace{Kind: TraceCompare, Text: exprText(e), Op: opSource(e.Op)}
+		res, err := evalCompare(e, t)
+		node.Left, node.Right = t.arithOperand(node, 0, &e.Left), t.arithOperand(node, 1, &e.Right)
+		if err == errUnknown {
+			node.Unknown = true
+			return node, nil
+		}
+		if err != nil {
+			node.Err = newEvalError(e.Pos, e.EndPos, err)
+			return node, node.Err
+		}
+
+		node.Result = res
+		return node, nil
+	case *BoolValue:
+		clear(t.values)
+		node := &Trace{Kind: TraceValue, Text: exprText(e)}
+		res, err := evalBoolValue(e, t)
+		node.Value = t.operand(node, 0, &e.Value)
+		if err == errUnknown {
+			node.Unknown = true
+			return node, nil
+		}
+		if err != nil {
+			node.Err = newEvalError(e.Value.Pos, e.Value.EndPos, err)
+			return node, node.Err
+		}
+
+		node.Result = res
+		return node, nil
+	case *NullTest:
+		clear(t.values)
+		node := &Trace{Kind: TraceNullTest, Text: exprText(e), Op: nullTestOp(e)}
+		res, err := evalNullTest(e, t)
+		node.Value = t.arithOperand(node, 0, &e.Operand)
+		if err != nil {
+			node.Err = newEvalError(e.Pos, e.EndPos, err)
+			return node, node.Err
+		}
+
+		node.Result = res
+		return node, nil
+	case *SubExpr:
+		return t.boolExpr(&e.BoolExpr)
+	case *NotExpr:
+		node := &Trace{Kind: TraceNot, Text: exprText(e)}
+		child, err := t.expr(e.Expr)
+		node.Children = append(node.Children, child)
+		if err != nil {
+			node.Err = err
+			return node, err
+		}
+
+		node.Result, node.Unknown = !child.Result && !child.Unknown, child.Unknown
+		return node, nil
+	default:
+		return nil, fmt.Errorf("Expr type is unhandled %T", x)
+	}
+}
+
+// arithOperand returns the value of o, the i-th operand of node, as computed
+// by the comparison just evaluated, or nil when it was not.
+func (t *tracer) arithOperand(node *Trace, i int, o *Operand) any {
+	if v := o.Value(); v != nil {
+		return t.operand(node, i, v)
+	}
+
+	return t.computed(node, i, o)
+}
+
+// operand returns the value of v, the i-th operand of node, as resolved by
+// the comparison just evaluated.
+func (t *tracer) operand(node *Trace, i int, v *Value) any {
+	switch {
+	case v.Symbol != nil, v.Call != nil:
+		return t.computed(node, i, v)
+	case v.List != nil:
+		vals := make([]any, len(v.List.Values))
+		for j := range v.List.Values {
+			vals[j] = t.operand(node, 2+j, &v.List.Values[j])
+		}
+
+		return vals
+	default:
+		val, _ := evalValue(v, nil)
+		return val.toAny()
+	}
+}
+
+// computed returns the value evaluation recorded for key, the i-th operand
+// of node, or nil when it computed none, which node records as unreached.
+func (t *tracer) computed(node *Trace, i int, key any) any {
+	val, ok := t.values[key]
+	if !ok {
+		node.unreached = append(node.unreached, i)
+		return nil
+	}
+
+	return val.toAny()
+}
+
+// skippedAndExpr and skippedExpr describe an operand short-circuiting did not
+// evaluate, with the node it would have been traced as.
+func skippedAndExpr(a *AndExpr) *Trace {
+	if len(a.AndOps) == 0 {
+		return skippedExpr(a.Expr)
+	}
+
+	return &Trace{Kind: TraceAnd, Skipped: true, Text: nodeText(func(sb *strings.Builder) { writeAndExpr(sb, a, precOr) })}
+}
+
+func skippedExpr(x Expr) *Trace {
+	switch e := x.(type) {
+	case *Compare:
+		return &Trace{Kind: TraceCompare, Skipped: true, Text: exprText(e), Op: opSource(e.Op)}
+	case *BoolValue:
+		return &Trace{Kind: TraceValue, Skipped: true, Text: exprText(e)}
+	case *NullTest:
+		return &Trace{Kind: TraceNullTest, Skipped: true, Text: exprText(e), Op: nullTestOp(e)}
+	case *NotExpr:
+		return &Trace{Kind: TraceNot, Skipped: true, Text: exprText(e)}
+	case *SubExpr:
+		if len(e.BoolExpr.OrOps) == 0 {
+			return skippedAndExpr(&e.BoolExpr.And)
+		}
+
+		return &Trace{Kind: TraceOr, Skipped: true, Text: nodeText(func(sb *strings.Builder) { writeBoolExpr(sb, &e.BoolExpr, precOr) })}
+	default:
+		return &Trace{Skipped: true}
+	}
+}
+
+func nodeText(write func(sb *strings.Builder)) string {
+	var sb strings.Builder
+	write(&sb)
+	return sb.String()
+}
+
+func exprText(x Expr) string {
+	return nodeText(func(sb *strings.Builder) { writeExpr(sb, x, precOr) })
+}
+
+// String renders the trace as an indented tree, one node per line, marked ✓
+// when it evaluated to true, ✗ when false, "?" when unknown, "-" when skipped
+// and "!" when it failed. Comparisons are followed by their resolved operands,
+// "?" for those evaluation did not reach:
+//
+//	✗ age >= 18 and country in ("NL", "BE")
+//	  ✓ age >= 18 (21 >= 18)
+//	  ✗ country in ("NL", "BE") ("DE" in ("NL", "BE"))
+func (t *Trace) String() string {
+	var sb strings.Builder
+	t.write(&sb, 0)
+	return sb.String()
+}
+
+func (t *Trace) write(sb *strings.Builder, depth int) {
+	if depth > 0 {
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(strings.Repeat("  ", depth))
+
+	switch {
+	case t.Skipped:
+		sb.WriteString("- ")
+	case t.Err != nil:
+		sb.WriteString("! ")
+	case t.Unknown:
+		sb.WriteString("? ")
+	case t.Result:
+		sb.WriteString("✓ ")
+	default:
+		sb.WriteString("✗ ")
+	}
+	sb.WriteString(t.Text)
+
+	switch {
+	case t.Skipped:
+		sb.WriteString(" (skipped)")
+	case t.Err != nil && len(t.Children) == 0:
+		// The error is only shown once, on the node that failed.
+		fmt.Fprintf(sb, " (%v)", t.Err)
+	case t.Kind == TraceCompare:
+		fmt.Fprintf(sb, " (%s %s %s)", t.formatOperand(0, t.Left), t.Op, t.formatOperand(1, t.Right))
+	case t.Kind == TraceNullTest:
+		fmt.Fprintf(sb, " (%s %s)", t.formatOperand(0, t.Value), t.Op)
+	case t.Kind == TraceValue && t.formatOperand(0, t.Value) != t.Text:
+		// A literal is its own value.
+		fmt.Fprintf(sb, " (%s)", t.formatOperand(0, t.Value))
+	}
+
+	for _, c := range t.Children {
+		c.write(sb, depth+1)
+	}
+}
+
+// formatOperand writes v, the i-th operand of t, as it would be written as a
+// literal, so strings are quoted and lists parenthesized, or as "?" when
+// evaluation did not reach it.
+func (t *Trace) formatOperand(i int, v any) string {
+	if v == nil && slices.Contains(t.unreached, i) {
+		return "?"
+	}
+
+	switch val := v.(type) {
+	case string:
+		return strconv.Quote(val)
+	case time.Time:
+		return formatTime(val)
+	case time.Duration:
+		return formatDuration(val)
+	case []any:
+		parts := make([]string, len(val))
+		for j, e := range val {
+			// Only the elements of a list Right are numbered.
+			k := -1
+			if i == 1 {
+				k = 2 + j
+			}
+			parts[j] = t.formatOperand(k, e)
+		}
+
+		return "(" + strings.Join(parts, ", ") + ")"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(val)
+	}
+}
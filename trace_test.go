@@ -0,0 +1,200 @@
+package boolexpr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalExpressionTrace(t *testing.T) {
+	exp, err := Parse(`age >= 18 and (country in ("NL", "BE") or vip) and not banned`)
+	require.NoError(t, err)
+
+	calls := 0
+	syms := SymbolsMap{
+		"age":     21,
+		"country": "DE",
+		"vip": func() bool {
+			calls++
+			return false
+		},
+		"banned": false,
+	}
+
+	res, trace, err := EvalExpressionTrace(exp, syms)
+	require.NoError(t, err)
+	assert.False(t, res)
+	assert.Equal(t, 1, calls, "symbols are resolved once")
+
+	assert.Equal(t, &Trace{
+		Kind: TraceAnd,
+		Text: `age >= 18 and (country in ("NL", "BE") or vip) and not banned`,
+		Children: []*Trace{
+			{Kind: TraceCompare, Text: `age >= 18`, Op: ">=", Left: 21, Right: 18, Result: true},
+			{
+				Kind: TraceOr,
+				Text: `country in ("NL", "BE") or vip`,
+				Children: []*Trace{
+					{Kind: TraceCompare, Text: `country in ("NL", "BE")`, Op: "in", Left: "DE", Right: []any{"NL", "BE"}},
+					{Kind: TraceValue, Text: `vip`, Value: false},
+				},
+			},
+			{Kind: TraceNot, Text: `not banned`, Skipped: true},
+		},
+	}, trace)
+
+	assert.Equal(t, `✗ age >= 18 and (country in ("NL", "BE") or vip) and not banned
+  ✓ age >= 18 (21 >= 18)
+  ✗ country in ("NL", "BE") or vip
+    ✗ country in ("NL", "BE") ("DE" in ("NL", "BE"))
+    ✗ vip (false)
+  - not banned (skipped)`, trace.String())
+
+	t.Run("result matches EvalExpression", func(t *testing.T) {
+		for _, input := range []string{
+			`a or b and c`,
+			`not (a and not b) or x > 1.5`,
+			`(a or b) and (c or x in (1, y))`,
+			`x = 1 and true or false`,
+		} {
+			exp, err := Parse(input)
+			require.NoError(t, err)
+
+			syms := SymbolsMap{"a": false, "b": true, "c": true, "x": 2, "y": 3}
+			want, err := EvalExpression(exp, syms)
+			require.NoError(t, err)
+
+			got, trace, err := EvalExpressionTrace(exp, syms)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, input)
+			assert.Equal(t, want, trace.Result, input)
+		}
+	})
+
+	t.Run("skipped or operands", func(t *testing.T) {
+		exp, err := Parse(`a or (b and c) or d = 1`)
+		require.NoError(t, err)
+
+		res, trace, err := EvalExpressionTrace(exp, SymbolsMap{"a": true})
+		require.NoError(t, err)
+		assert.True(t, res)
+		assert.Equal(t, `✓ a or b and c or d = 1
+  ✓ a (true)
+  - b and c (skipped)
+  - d = 1 (skipped)`, trace.String())
+		assert.Equal(t, TraceAnd, trace.Children[1].Kind)
+		assert.Equal(t, TraceCompare, trace.Children[2].Kind)
+	})
+
+	t.Run("calls", func(t *testing.T) {
+		exp, err := Parse(`len(tags) > 2 and lower(name) = "ada"`)
+		require.NoError(t, err)
+
+		res, trace, err := EvalExpressionTrace(exp, SymbolsMap{"tags": []string{"a", "b"}, "name": "Ada"})
+		require.NoError(t, err)
+		assert.False(t, res)
+		assert.Equal(t, `✗ len(tags) > 2 and lower(name) = "ada"
+  ✗ len(tags) > 2 (2 > 2)
+  - lower(name) = "ada" (skipped)`, trace.String())
+	})
+
+	t.Run("functions are called once", func(t *testing.T) {
+		calls := 0
+		fns := NewFunctions()
+		require.NoError(t, fns.Register("tick", func(n int) int {
+			calls++
+			return n + calls
+		}))
+
+		exp, err := Parse(`tick(x) + 1 = 3 and x in (tick(x), 5)`, WithFunctions(fns))
+		require.NoError(t, err)
+
+		_, err = EvalExpression(exp, SymbolsMap{"x": 1})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+
+		calls = 0
+		res, trace, err := EvalExpressionTrace(exp, SymbolsMap{"x": 1})
+		require.NoError(t, err)
+		assert.False(t, res)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, `✗ tick(x) + 1 = 3 and x in (tick(x), 5)
+  ✓ tick(x) + 1 = 3 (3 = 3)
+  ✗ x in (tick(x), 5) (1 in (3, 5))`, trace.String())
+	})
+
+	t.Run("null and unreached operands", func(t *testing.T) {
+		exp, err := Parse(`x in (gone, 1, y, z) and gone = null and x != gone`)
+		require.NoError(t, err)
+
+		res, trace, err := EvalExpressionTrace(exp, SymbolsMap{"x": 1, "gone": nil, "y": 2})
+		require.NoError(t, err)
+		assert.True(t, res)
+		assert.Nil(t, trace.Children[0].Right.([]any)[2], "y was not reached")
+		assert.Equal(t, `✓ x in (gone, 1, y, z) and gone = null and x != gone
+  ✓ x in (gone, 1, y, z) (1 in (null, 1, ?, ?))
+  ✓ gone = null (null = null)
+  ✓ x != gone (1 != null)`, trace.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		exp, err := Parse(`a and x > 1`)
+		require.NoError(t, err)
+
+		res, trace, err := EvalExpressionTrace(exp, SymbolsMap{"a": true})
+		require.ErrorIs(t, err, ErrSymbolNotFound)
+		assert.False(t, res)
+
+		var evalErr *EvalError
+		require.True(t, errors.As(trace.Children[1].Err, &evalErr))
+		assert.Equal(t, err, trace.Err)
+		assert.Equal(t, `! a and x > 1
+  ✓ a (true)
+  ! x > 1 (1:7: Symbol: x, Symbol not found)`, trace.String())
+	})
+
+	t.Run("three-valued", func(t *testing.T) {
+		exp, err := Parse(`not (age > 18 or vip) and name is not null`, WithMissingSymbols(MissingThreeValued))
+		require.NoError(t, err)
+
+		res, trace, err := EvalExpressionTrace(exp, SymbolsMap{"vip": false, "name": "Ada"})
+		require.NoError(t, err)
+		assert.False(t, res)
+		assert.True(t, trace.Unknown)
+		assert.Equal(t, `? not (age > 18 or vip) and name is not null
+  ? not (age > 18 or vip)
+    ? age > 18 or vip
+      ? age > 18 (null > 18)
+      ✗ vip (false)
+  ✓ name is not null ("Ada" is not null)`, trace.String())
+	})
+
+	t.Run("options", func(t *testing.T) {
+		parsed := NewFunctions()
+		require.NoError(t, parsed.Register("allowed", func(user string) bool { return false }))
+		exp, err := Parse(`allowed(user) and now() < 2000-01-01 and banned is null`, WithFunctions(parsed))
+		require.NoError(t, err)
+
+		request := NewFunctions()
+		require.NoError(t, request.Register("allowed", func(user string) bool { return user == "ada" }))
+		clock := func() time.Time { return time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+		res, trace, err := EvalExpressionTrace(exp, SymbolsMap{"user": "ada"},
+			WithFunctions(request), WithClock(clock), WithMissingSymbols(MissingNull))
+		require.NoError(t, err)
+		assert.True(t, res)
+		assert.Equal(t, `✓ allowed(user) and now() < 2000-01-01 and banned is null
+  ✓ allowed(user) (true)
+  ✓ now() < 2000-01-01 (1999-01-01 < 2000-01-01)
+  ✓ banned is null (null is null)`, trace.String())
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		_, trace, err := EvalExpressionTrace(Expression{}, SymbolsMap{})
+		require.Error(t, err)
+		assert.Nil(t, trace)
+	})
+}